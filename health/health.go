@@ -0,0 +1,281 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// Estados posibles de un chequeo y del reporte completo
+const (
+	StatusOK       = "ok"
+	StatusFail     = "fail"
+	StatusDegraded = "degraded"
+)
+
+// Valores por defecto de Options
+const (
+	DefaultTimeout  = 2 * time.Second
+	DefaultCacheTTL = 2 * time.Second
+)
+
+// CheckFunc verifica una dependencia. Retorna nil si está disponible.
+// Debe respetar la cancelación del contexto, que vence al cumplirse el timeout del chequeo.
+type CheckFunc func(ctx context.Context) error
+
+// Options configura el comportamiento del registro de chequeos
+type Options struct {
+	// Timeout es el tiempo máximo por chequeo. Por defecto 2 segundos.
+	Timeout time.Duration
+	// CacheTTL es cuánto tiempo se reutiliza el último reporte. Por defecto 2 segundos; negativo desactiva la cache.
+	CacheTTL time.Duration
+}
+
+// CheckOption modifica el registro de un chequeo
+type CheckOption func(*registeredCheck)
+
+// Optional marca el chequeo como no crítico: si falla el servicio queda "degraded" pero sigue listo
+func Optional() CheckOption {
+	return func(rc *registeredCheck) {
+		rc.optional = true
+	}
+}
+
+// WithTimeout reemplaza el timeout por defecto para este chequeo
+func WithTimeout(timeout time.Duration) CheckOption {
+	return func(rc *registeredCheck) {
+		rc.timeout = timeout
+	}
+}
+
+type registeredCheck struct {
+	name     string
+	check    CheckFunc
+	timeout  time.Duration
+	optional bool
+}
+
+// CheckResult es el resultado de un chequeo individual
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+	Optional  bool    `json:"optional,omitempty"`
+}
+
+// Report es la respuesta de /health/ready
+type Report struct {
+	Status    string                 `json:"status"`
+	CheckedAt time.Time              `json:"checked_at"`
+	Checks    map[string]CheckResult `json:"checks"`
+}
+
+// Registry guarda los chequeos de dependencias de un servicio
+type Registry struct {
+	opts Options
+
+	mu     sync.Mutex
+	checks []registeredCheck
+
+	runMu    sync.Mutex
+	cached   *Report
+	cachedAt time.Time
+}
+
+// New crea un registro de chequeos vacío
+func New(opts Options) *Registry {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.CacheTTL == 0 {
+		opts.CacheTTL = DefaultCacheTTL
+	}
+	return &Registry{opts: opts}
+}
+
+// Register agrega un chequeo con el nombre indicado. Los nombres deben ser únicos.
+func (r *Registry) Register(name string, check CheckFunc, opts ...CheckOption) {
+	rc := registeredCheck{name: name, check: check, timeout: r.opts.Timeout}
+	for _, opt := range opts {
+		opt(&rc)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.checks {
+		if existing.name == name {
+			panic(fmt.Sprintf("health check %s already registered", name))
+		}
+	}
+	r.checks = append(r.checks, rc)
+}
+
+// Check ejecuta todos los chequeos en paralelo, o retorna el último reporte si sigue vigente
+func (r *Registry) Check(ctx context.Context) Report {
+	r.runMu.Lock()
+	defer r.runMu.Unlock()
+
+	if r.cached != nil && r.opts.CacheTTL > 0 && time.Since(r.cachedAt) < r.opts.CacheTTL {
+		return *r.cached
+	}
+
+	r.mu.Lock()
+	checks := make([]registeredCheck, len(r.checks))
+	copy(checks, r.checks)
+	r.mu.Unlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, rc := range checks {
+		wg.Add(1)
+		go func(i int, rc registeredCheck) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, rc)
+		}(i, rc)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, CheckedAt: time.Now().UTC(), Checks: make(map[string]CheckResult, len(checks))}
+	for i, rc := range checks {
+		result := results[i]
+		report.Checks[rc.name] = result
+		if result.Status == StatusOK {
+			continue
+		}
+		if rc.optional {
+			if report.Status == StatusOK {
+				report.Status = StatusDegraded
+			}
+			continue
+		}
+		report.Status = StatusFail
+	}
+
+	r.cached = &report
+	r.cachedAt = time.Now()
+	return report
+}
+
+// runCheck ejecuta un chequeo con su timeout y convierte los panics en fallas
+func runCheck(parent context.Context, rc registeredCheck) (result CheckResult) {
+	ctx, cancel := context.WithTimeout(parent, rc.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				done <- fmt.Errorf("check panicked: %v", recovered)
+			}
+		}()
+		done <- rc.check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("check timed out after %s", rc.timeout)
+	}
+
+	result = CheckResult{
+		Status:    StatusOK,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		Optional:  rc.optional,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Names retorna los nombres de los chequeos registrados en orden alfabético
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.checks))
+	for _, rc := range r.checks {
+		names = append(names, rc.name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LiveHandler responde 200 mientras el proceso esté vivo; no consulta dependencias
+func (r *Registry) LiveHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": StatusOK})
+	}
+}
+
+// ReadyHandler ejecuta los chequeos y responde 200 si todos los críticos pasan, o 503 si alguno falla
+func (r *Registry) ReadyHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := r.Check(c.Request.Context())
+		status := http.StatusOK
+		if report.Status == StatusFail {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, report)
+	}
+}
+
+// RegisterRoutes monta /health/live y /health/ready. /health se mantiene como liveness
+// porque es lo que consultan testhelpers.WaitForHealth y los chequeos entre servicios.
+func (r *Registry) RegisterRoutes(router gin.IRoutes) {
+	router.GET("/health", r.LiveHandler())
+	router.GET("/health/live", r.LiveHandler())
+	router.GET("/health/ready", r.ReadyHandler())
+}
+
+///////////////////////////////////////////////////////////////
+//				Chequeos de dependencias comunes
+///////////////////////////////////////////////////////////////
+
+// MongoCheck verifica la conexión con Mongo haciendo ping al primario
+func MongoCheck(client *mongo.Client) CheckFunc {
+	return func(ctx context.Context) error {
+		return client.Ping(ctx, readpref.Primary())
+	}
+}
+
+// HTTPCheck verifica que la URL responda con un status 2xx
+func HTTPCheck(url string) CheckFunc {
+	client := &http.Client{}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("received non-OK HTTP status: %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+// UsuariosCheck verifica que DueligUsuarios esté disponible. baseURL ejemplo: "http://localhost:8080"
+func UsuariosCheck(baseURL string) CheckFunc {
+	return HTTPCheck(baseURL + "/health")
+}
+
+// SaveFilesCheck verifica que el servicio de archivos esté disponible. baseURL ejemplo: "http://localhost:8081"
+func SaveFilesCheck(baseURL string) CheckFunc {
+	return HTTPCheck(baseURL + "/health")
+}
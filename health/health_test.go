@@ -0,0 +1,187 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/edwinrubio/DueligUtils/testhelpers/fakes"
+	"github.com/gin-gonic/gin"
+)
+
+func passing(ctx context.Context) error { return nil }
+
+func failing(ctx context.Context) error { return errors.New("connection refused") }
+
+// blocking espera la cancelación del contexto, como un chequeo que respeta el timeout
+func blocking(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRegistryCheck(t *testing.T) {
+	type check struct {
+		name     string
+		fn       CheckFunc
+		optional bool
+	}
+	tests := []struct {
+		name       string
+		checks     []check
+		wantStatus string
+		// wantFailed son los chequeos que deben quedar en fail
+		wantFailed []string
+	}{
+		{"sin chequeos", nil, StatusOK, nil},
+		{"todos pasan", []check{{"mongo", passing, false}, {"usuarios", passing, false}}, StatusOK, nil},
+		{"falla un crítico", []check{{"mongo", failing, false}, {"usuarios", passing, false}}, StatusFail, []string{"mongo"}},
+		{"falla un opcional", []check{{"mongo", passing, false}, {"clamd", failing, true}}, StatusDegraded, []string{"clamd"}},
+		{"fallan crítico y opcional", []check{{"mongo", failing, false}, {"clamd", failing, true}}, StatusFail, []string{"mongo", "clamd"}},
+		{"timeout", []check{{"lento", blocking, false}}, StatusFail, []string{"lento"}},
+		{"panic", []check{{"roto", func(context.Context) error { panic("nil map") }, false}}, StatusFail, []string{"roto"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := New(Options{Timeout: 20 * time.Millisecond, CacheTTL: -1})
+			for _, c := range tt.checks {
+				var opts []CheckOption
+				if c.optional {
+					opts = append(opts, Optional())
+				}
+				registry.Register(c.name, c.fn, opts...)
+			}
+
+			report := registry.Check(context.Background())
+			if report.Status != tt.wantStatus {
+				t.Errorf("Status = %s, se esperaba %s", report.Status, tt.wantStatus)
+			}
+			failed := map[string]bool{}
+			for _, name := range tt.wantFailed {
+				failed[name] = true
+			}
+			for name, result := range report.Checks {
+				if (result.Status == StatusFail) != failed[name] {
+					t.Errorf("chequeo %s = %+v", name, result)
+				}
+				if result.Status == StatusFail && result.Error == "" {
+					t.Errorf("chequeo %s falló sin error", name)
+				}
+			}
+		})
+	}
+}
+
+func TestRegistryCheckRunsInParallelWithPerCheckTimeout(t *testing.T) {
+	registry := New(Options{Timeout: time.Second, CacheTTL: -1})
+	registry.Register("a", blocking, WithTimeout(50*time.Millisecond))
+	registry.Register("b", blocking, WithTimeout(50*time.Millisecond))
+	registry.Register("c", blocking, WithTimeout(50*time.Millisecond))
+
+	start := time.Now()
+	report := registry.Check(context.Background())
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("los chequeos tardaron %s; deben correr en paralelo con su propio timeout", elapsed)
+	}
+	if report.Status != StatusFail {
+		t.Errorf("Status = %s", report.Status)
+	}
+}
+
+func TestRegistryCheckCache(t *testing.T) {
+	var calls atomic.Int32
+	counting := func(context.Context) error {
+		calls.Add(1)
+		return nil
+	}
+
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		wantCalls int32
+	}{
+		{"con cache", time.Minute, 1},
+		{"sin cache", -1, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls.Store(0)
+			registry := New(Options{CacheTTL: tt.ttl})
+			registry.Register("mongo", counting)
+			for range 3 {
+				registry.Check(context.Background())
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("el chequeo se ejecutó %d veces, se esperaban %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRegisterDuplicatePanics(t *testing.T) {
+	registry := New(Options{})
+	registry.Register("mongo", passing)
+	defer func() {
+		if recover() == nil {
+			t.Error("se esperaba un panic por el nombre repetido")
+		}
+	}()
+	registry.Register("mongo", passing)
+}
+
+func TestRoutes(t *testing.T) {
+	saveFiles := fakes.NewSaveFiles()
+	defer saveFiles.Close()
+
+	tests := []struct {
+		name       string
+		failNext   int
+		path       string
+		wantStatus int
+		wantReport string
+	}{
+		{"liveness", http.StatusServiceUnavailable, "/health", http.StatusOK, ""},
+		{"liveness explícito", http.StatusServiceUnavailable, "/health/live", http.StatusOK, ""},
+		{"listo", 0, "/health/ready", http.StatusOK, StatusOK},
+		{"dependencia caída", http.StatusServiceUnavailable, "/health/ready", http.StatusServiceUnavailable, StatusFail},
+		{"dependencia con error del servidor", http.StatusInternalServerError, "/health/ready", http.StatusServiceUnavailable, StatusFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saveFiles.Reset()
+			if tt.failNext != 0 {
+				saveFiles.FailNext(1, tt.failNext)
+			}
+
+			registry := New(Options{CacheTTL: -1})
+			registry.Register("savefiles", SaveFilesCheck(saveFiles.URL))
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			registry.RegisterRoutes(router)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("%s = %d %s, se esperaba %d", tt.path, rec.Code, rec.Body, tt.wantStatus)
+			}
+			if tt.wantReport == "" {
+				if len(saveFiles.Requests()) != 0 {
+					t.Error("liveness no debe consultar las dependencias")
+				}
+				return
+			}
+			var report Report
+			if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+			if report.Status != tt.wantReport || report.Checks["savefiles"].Status != tt.wantReport {
+				t.Errorf("reporte inesperado: %+v", report)
+			}
+		})
+	}
+}
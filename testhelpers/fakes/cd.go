@@ -0,0 +1,58 @@
+package fakes
+
+import (
+	"net/http"
+	"sync"
+)
+
+// CD fakes DueligCD: GET /api/v1/cd/verifyownership?idCD=&idPropietario= answers
+// 200 for registered owners and 403 otherwise.
+type CD struct {
+	*Server
+
+	mu     sync.Mutex
+	owners map[string]map[string]bool
+}
+
+// NewCD starts a cd fake with no owners registered.
+func NewCD() *CD {
+	c := &CD{owners: make(map[string]map[string]bool)}
+	c.Server = newServer(c.handle)
+	return c
+}
+
+// SetOwner registers idPropietario as owner of the centro deportivo idCD.
+func (c *CD) SetOwner(idCD, idPropietario string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.owners[idCD] == nil {
+		c.owners[idCD] = make(map[string]bool)
+	}
+	c.owners[idCD][idPropietario] = true
+}
+
+// RemoveOwner revokes ownership of idCD for idPropietario.
+func (c *CD) RemoveOwner(idCD, idPropietario string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.owners[idCD], idPropietario)
+}
+
+func (c *CD) handle(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/cd/verifyownership":
+		query := r.URL.Query()
+		c.mu.Lock()
+		owner := c.owners[query.Get("idCD")][query.Get("idPropietario")]
+		c.mu.Unlock()
+		if !owner {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "not owner"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"owner": true})
+	case r.Method == http.MethodGet && r.URL.Path == "/health":
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+}
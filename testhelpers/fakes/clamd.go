@@ -0,0 +1,173 @@
+package fakes
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// EICAR is the standard antivirus test string; the clamd fake reports it as
+// "Eicar-Test-Signature", like a real clamd.
+const EICAR = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!H+H*`
+
+// Clamd fakes a ClamAV daemon on a local TCP port. It understands the
+// null-terminated zINSTREAM and zPING commands, reports streams that contain a
+// registered signature as "stream: <name> FOUND" and enforces StreamMaxLength.
+type Clamd struct {
+	listener net.Listener
+
+	mu         sync.Mutex
+	signatures map[string][]byte
+	maxLength  int64
+	delay      time.Duration
+	dropNext   int
+	scanned    [][]byte
+	wg         sync.WaitGroup
+}
+
+// NewClamd starts a clamd fake that detects EICAR, with a 25 MB StreamMaxLength.
+func NewClamd() *Clamd {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("fakes: clamd listen: " + err.Error())
+	}
+	c := &Clamd{
+		listener:   listener,
+		signatures: map[string][]byte{"Eicar-Test-Signature": []byte(EICAR)},
+		maxLength:  25 << 20,
+	}
+	c.wg.Add(1)
+	go c.accept()
+	return c
+}
+
+// Addr is the host:port to pass to utils.NewClamdScanner.
+func (c *Clamd) Addr() string {
+	return c.listener.Addr().String()
+}
+
+// Close stops the listener and waits for open connections to finish.
+func (c *Clamd) Close() {
+	c.listener.Close()
+	c.wg.Wait()
+}
+
+// AddSignature makes streams containing pattern be reported as infected with name.
+func (c *Clamd) AddSignature(name string, pattern []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.signatures[name] = pattern
+}
+
+// SetStreamMaxLength changes the size after which INSTREAM answers with a size-limit ERROR.
+func (c *Clamd) SetStreamMaxLength(n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxLength = n
+}
+
+// SetDelay delays every reply, to exercise client timeouts.
+func (c *Clamd) SetDelay(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.delay = d
+}
+
+// DropNext closes the next n connections without answering.
+func (c *Clamd) DropNext(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dropNext = n
+}
+
+// Scanned returns the content of every completed INSTREAM, in arrival order.
+func (c *Clamd) Scanned() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]byte(nil), c.scanned...)
+}
+
+func (c *Clamd) accept() {
+	defer c.wg.Done()
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			return
+		}
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			defer conn.Close()
+			c.serve(conn)
+		}()
+	}
+}
+
+func (c *Clamd) serve(conn net.Conn) {
+	c.mu.Lock()
+	drop := c.dropNext > 0
+	if drop {
+		c.dropNext--
+	}
+	delay, maxLength := c.delay, c.maxLength
+	c.mu.Unlock()
+	if drop {
+		return
+	}
+
+	reader := bufio.NewReader(conn)
+	command, err := reader.ReadString(0)
+	if err != nil {
+		return
+	}
+
+	var reply string
+	switch command {
+	case "zPING\x00":
+		reply = "PONG"
+	case "zINSTREAM\x00":
+		reply = c.instream(reader, maxLength)
+	default:
+		reply = "UNKNOWN COMMAND"
+	}
+
+	time.Sleep(delay)
+	conn.Write([]byte(reply + "\x00"))
+}
+
+// instream reads the length-prefixed chunks until the zero-length terminator.
+func (c *Clamd) instream(reader io.Reader, maxLength int64) string {
+	var data []byte
+	var size [4]byte
+	for {
+		if _, err := io.ReadFull(reader, size[:]); err != nil {
+			return "INSTREAM: read error ERROR"
+		}
+		n := int64(binary.BigEndian.Uint32(size[:]))
+		if n == 0 {
+			break
+		}
+		if int64(len(data))+n > maxLength {
+			return "INSTREAM size limit exceeded. ERROR"
+		}
+		chunk := make([]byte, n)
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			return "INSTREAM: read error ERROR"
+		}
+		data = append(data, chunk...)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scanned = append(c.scanned, data)
+	for name, pattern := range c.signatures {
+		if bytes.Contains(data, pattern) {
+			return "stream: " + name + " FOUND"
+		}
+	}
+	return "stream: OK"
+}
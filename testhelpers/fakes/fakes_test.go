@@ -0,0 +1,273 @@
+package fakes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// upload posts data as the "file" part of a multipart form, as utils.SaveFiles does.
+func upload(t *testing.T, url, filename, kind string, data []byte) *http.Response {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("Kindfile", kind)
+	part, _ := writer.CreateFormFile("file", filename)
+	part.Write(data)
+	writer.Close()
+
+	resp, err := http.Post(url, writer.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func decode(t *testing.T, resp *http.Response) map[string]any {
+	t.Helper()
+	defer resp.Body.Close()
+	var body map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding %d response: %v", resp.StatusCode, err)
+	}
+	return body
+}
+
+func TestServerFaultInjection(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(s *Server)
+		// want lists the expected status of consecutive GET /health requests; 0 means a network error
+		want []int
+	}{
+		{
+			name: "scripted responses are consumed in order",
+			setup: func(s *Server) {
+				s.On(http.MethodGet, "/health", Response{Status: http.StatusTeapot}, Response{Status: http.StatusAccepted})
+			},
+			want: []int{http.StatusTeapot, http.StatusAccepted, http.StatusOK},
+		},
+		{
+			name: "FailNext overrides scripted responses",
+			setup: func(s *Server) {
+				s.On(http.MethodGet, "/health", Response{Status: http.StatusTeapot})
+				s.FailNext(2, http.StatusBadGateway)
+			},
+			want: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusTeapot, http.StatusOK},
+		},
+		{
+			name:  "DropNext closes the connection",
+			setup: func(s *Server) { s.DropNext(1) },
+			want:  []int{0, http.StatusOK},
+		},
+		{
+			name: "Reset clears scripts and faults",
+			setup: func(s *Server) {
+				s.On(http.MethodGet, "/health", Response{Status: http.StatusTeapot})
+				s.FailNext(1, http.StatusBadGateway)
+				s.Reset()
+			},
+			want: []int{http.StatusOK},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := NewCD()
+			defer fake.Close()
+			tt.setup(fake.Server)
+
+			for i, want := range tt.want {
+				resp, err := http.Get(fake.URL + "/health")
+				if want == 0 {
+					if err == nil {
+						resp.Body.Close()
+						t.Fatalf("request %d: got %d, want a network error", i, resp.StatusCode)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("request %d: %v", i, err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != want {
+					t.Errorf("request %d: got %d, want %d", i, resp.StatusCode, want)
+				}
+			}
+		})
+	}
+}
+
+func TestServerScriptedResponse(t *testing.T) {
+	fake := NewSaveFiles()
+	defer fake.Close()
+	fake.On(http.MethodPost, "/SaveFiles", Response{
+		Status:  http.StatusCreated,
+		Body:    map[string]string{"file_path": "Images/scripted.png"},
+		Headers: map[string]string{"X-Fake": "1"},
+		Delay:   20 * time.Millisecond,
+	})
+
+	start := time.Now()
+	resp := upload(t, fake.URL+"/SaveFiles", "a.png", "Images", []byte("png"))
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("scripted Delay ignored, answered in %v", elapsed)
+	}
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("X-Fake") != "1" {
+		t.Errorf("got %d %v", resp.StatusCode, resp.Header)
+	}
+	if body := decode(t, resp); body["file_path"] != "Images/scripted.png" {
+		t.Errorf("body = %v", body)
+	}
+	if len(fake.Files()) != 0 {
+		t.Error("a scripted response must not run the default handler")
+	}
+}
+
+func TestSaveFilesRoundTrip(t *testing.T) {
+	fake := NewSaveFiles()
+	defer fake.Close()
+
+	resp := upload(t, fake.URL+"/SaveFiles", "reporte.pdf", "Documents", []byte("%PDF-1.7"))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("upload = %d", resp.StatusCode)
+	}
+	path, _ := decode(t, resp)["file_path"].(string)
+	if !strings.HasPrefix(path, "Documents/") || !fake.HasFile(path) {
+		t.Fatalf("file_path %q not stored", path)
+	}
+
+	recorded := fake.RequestsTo("/SaveFiles")
+	if len(recorded) != 1 || recorded[0].Fields["Kindfile"] != "Documents" || len(recorded[0].Files) != 1 {
+		t.Fatalf("recorded requests: %+v", recorded)
+	}
+	if file := recorded[0].Files[0]; file.Filename != "reporte.pdf" || string(file.Data) != "%PDF-1.7" {
+		t.Errorf("recorded file: %+v", file)
+	}
+
+	body, _ := json.Marshal(map[string]string{"Url": "https://cdn.example/foto.jpg", "Kindfile": "Images"})
+	resp, err := http.Post(fake.URL+"/ImagesFromUrl", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromURL, _ := decode(t, resp)["file_path"].(string)
+	if fake.Files()[fromURL].SourceURL != "https://cdn.example/foto.jpg" {
+		t.Errorf("ImagesFromUrl stored %+v", fake.Files()[fromURL])
+	}
+
+	for _, want := range []int{http.StatusOK, http.StatusNotFound} {
+		req, _ := http.NewRequest(http.MethodDelete, fake.URL+"/DeleteFile?file_path="+path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("DELETE = %d, want %d", resp.StatusCode, want)
+		}
+	}
+	if fake.HasFile(path) {
+		t.Error("deleted file is still stored")
+	}
+}
+
+func TestUsuariosLoginAndValidateJWT(t *testing.T) {
+	fake := NewUsuarios()
+	defer fake.Close()
+
+	tests := []struct {
+		name     string
+		password string
+		want     int
+	}{
+		{"valid credentials", SeedPassword, http.StatusOK},
+		{"wrong password", "otra", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]string{"correo": SeedJugadorEmail, "password": tt.password})
+			resp, err := http.Post(fake.URL+"/api/v1/usuarios/login", "application/json", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := decode(t, resp)
+			if resp.StatusCode != tt.want {
+				t.Fatalf("login = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if tt.want == http.StatusOK && got["access_token"] == "" {
+				t.Error("login did not return an access_token")
+			}
+		})
+	}
+
+	validate := func(headers map[string]string) int {
+		req, _ := http.NewRequest(http.MethodPost, fake.URL+"/api/v1/ValidateJWT", nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	session := map[string]string{"Authorization": "Bearer " + fake.IssueToken(fake.UserID(SeedJugadorEmail)), "Client-Type": "web"}
+	if got := validate(session); got != http.StatusOK {
+		t.Errorf("ValidateJWT = %d, want 200", got)
+	}
+	if got := validate(map[string]string{"Client-Type": "web"}); got != http.StatusUnauthorized {
+		t.Errorf("ValidateJWT without Authorization = %d, want 401", got)
+	}
+	fake.SetSessionValid(false)
+	if got := validate(session); got != http.StatusUnauthorized {
+		t.Errorf("ValidateJWT with invalid session = %d, want 401", got)
+	}
+}
+
+func TestCDOwnership(t *testing.T) {
+	fake := NewCD()
+	defer fake.Close()
+	fake.SetOwner("cd-1", "user-1")
+
+	verify := func(idCD, idPropietario string) int {
+		resp, err := http.Get(fake.URL + "/api/v1/cd/verifyownership?idCD=" + idCD + "&idPropietario=" + idPropietario)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if got := verify("cd-1", "user-1"); got != http.StatusOK {
+		t.Errorf("owner = %d, want 200", got)
+	}
+	if got := verify("cd-1", "user-2"); got != http.StatusForbidden {
+		t.Errorf("other user = %d, want 403", got)
+	}
+	fake.RemoveOwner("cd-1", "user-1")
+	if got := verify("cd-1", "user-1"); got != http.StatusForbidden {
+		t.Errorf("removed owner = %d, want 403", got)
+	}
+	if got := fake.RequestsTo("/api/v1/cd/verifyownership"); len(got) != 3 || got[0].Query.Get("idCD") != "cd-1" {
+		t.Errorf("recorded %d requests", len(got))
+	}
+}
+
+func TestSetLatency(t *testing.T) {
+	fake := NewCD()
+	defer fake.Close()
+	fake.SetLatency(50 * time.Millisecond)
+
+	client := &http.Client{Timeout: 10 * time.Millisecond}
+	_, err := client.Get(fake.URL + "/health")
+	var timeout interface{ Timeout() bool }
+	if !errors.As(err, &timeout) || !timeout.Timeout() {
+		t.Errorf("got %v, want a client timeout", err)
+	}
+}
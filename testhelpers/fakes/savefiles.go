@@ -0,0 +1,146 @@
+package fakes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// StoredFile is a file kept by the savefiles fake.
+type StoredFile struct {
+	Path     string
+	Kindfile string
+	Filename string
+	Data     []byte
+	// SourceURL is set for files saved through ImagesFromUrl.
+	SourceURL string
+}
+
+// SaveFiles fakes the savefiles service. Any POST stores the uploaded "file" part
+// (or the ImagesFromUrl JSON body) and answers {"file_path": ...}; DELETE with
+// ?file_path= removes it.
+type SaveFiles struct {
+	*Server
+
+	mu    sync.Mutex
+	files map[string]StoredFile
+	seq   int
+}
+
+// NewSaveFiles starts an empty savefiles fake.
+func NewSaveFiles() *SaveFiles {
+	s := &SaveFiles{files: make(map[string]StoredFile)}
+	s.Server = newServer(s.handle)
+	return s
+}
+
+// Files returns a copy of the stored files keyed by path.
+func (s *SaveFiles) Files() map[string]StoredFile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := make(map[string]StoredFile, len(s.files))
+	for key, file := range s.files {
+		files[key] = file
+	}
+	return files
+}
+
+// HasFile reports whether filePath is currently stored.
+func (s *SaveFiles) HasFile(filePath string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, exists := s.files[filePath]
+	return exists
+}
+
+// PutFile stores a file directly, e.g. to seed an old file before testing UpdateFile.
+func (s *SaveFiles) PutFile(filePath string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[filePath] = StoredFile{Path: filePath, Filename: path.Base(filePath), Data: data}
+}
+
+func (s *SaveFiles) handle(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "ImagesFromUrl"):
+		s.imagesFromURL(w, r)
+	case r.Method == http.MethodPost:
+		s.upload(w, r)
+	case r.Method == http.MethodDelete:
+		s.delete(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/health":
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+}
+
+func (s *SaveFiles) upload(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(64 << 20); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "missing file"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	kind := r.FormValue("Kindfile")
+	filePath := s.store(StoredFile{Kindfile: kind, Filename: header.Filename, Data: data})
+	writeJSON(w, http.StatusOK, map[string]string{"file_path": filePath})
+}
+
+func (s *SaveFiles) imagesFromURL(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Url      string
+		Kindfile string
+		Acl      string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Url == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+		return
+	}
+
+	filePath := s.store(StoredFile{Kindfile: body.Kindfile, Filename: path.Base(body.Url), SourceURL: body.Url})
+	writeJSON(w, http.StatusOK, map[string]string{"file_path": filePath})
+}
+
+func (s *SaveFiles) delete(w http.ResponseWriter, r *http.Request) {
+	filePath := r.URL.Query().Get("file_path")
+
+	s.mu.Lock()
+	_, exists := s.files[filePath]
+	delete(s.files, filePath)
+	s.mu.Unlock()
+
+	if !exists {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "file not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "deleted"})
+}
+
+func (s *SaveFiles) store(file StoredFile) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	kind := file.Kindfile
+	if kind == "" {
+		kind = "Files"
+	}
+	file.Path = fmt.Sprintf("%s/%d-%s", kind, s.seq, file.Filename)
+	s.files[file.Path] = file
+	return file.Path
+}
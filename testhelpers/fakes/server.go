@@ -0,0 +1,265 @@
+package fakes
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Response is a scripted response returned instead of the fake's default behavior.
+// Body is written as-is when it is a string or []byte, otherwise it is encoded as JSON.
+type Response struct {
+	Status  int
+	Body    interface{}
+	Headers map[string]string
+	Delay   time.Duration
+}
+
+// RecordedFile is a file part received in a multipart request.
+type RecordedFile struct {
+	Field       string
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// RecordedRequest is a request received by a fake, kept for assertions.
+type RecordedRequest struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+	// Fields and Files are filled for multipart/form-data requests.
+	Fields map[string]string
+	Files  []RecordedFile
+	At     time.Time
+}
+
+// Server is the httptest-based core shared by every fake: scripted responses,
+// request recording and fault injection. Fakes add their default handlers on top.
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	requests    []RecordedRequest
+	scripted    map[string][]Response
+	latency     time.Duration
+	failStatus  int
+	failCount   int
+	dropCount   int
+	defaultFunc http.HandlerFunc
+}
+
+// newServer starts a fake whose unscripted requests are handled by defaultFunc.
+func newServer(defaultFunc http.HandlerFunc) *Server {
+	s := &Server{scripted: make(map[string][]Response), defaultFunc: defaultFunc}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func scriptKey(method, path string) string {
+	return strings.ToUpper(method) + " " + path
+}
+
+// On queues responses for method+path. Each request consumes one response;
+// once the queue is empty the fake's default behavior applies again.
+func (s *Server) On(method, path string, responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := scriptKey(method, path)
+	s.scripted[key] = append(s.scripted[key], responses...)
+}
+
+// SetLatency delays every response by d. Use zero to disable.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// FailNext makes the next n requests, on any path, return status with an error body.
+func (s *Server) FailNext(n int, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failCount = n
+	s.failStatus = status
+}
+
+// DropNext closes the connection without a response for the next n requests,
+// so callers observe a network error instead of an HTTP status. net/http retries
+// idempotent requests once on a reused connection, so GET and DELETE need n >= 2.
+func (s *Server) DropNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropCount = n
+}
+
+// Requests returns a copy of every recorded request in arrival order.
+func (s *Server) Requests() []RecordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	requests := make([]RecordedRequest, len(s.requests))
+	copy(requests, s.requests)
+	return requests
+}
+
+// RequestsTo returns the recorded requests whose path matches.
+func (s *Server) RequestsTo(path string) []RecordedRequest {
+	var matched []RecordedRequest
+	for _, req := range s.Requests() {
+		if req.Path == path {
+			matched = append(matched, req)
+		}
+	}
+	return matched
+}
+
+// Reset clears recorded requests, scripted responses and injected faults.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+	s.scripted = make(map[string][]Response)
+	s.latency = 0
+	s.failCount = 0
+	s.dropCount = 0
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	recorded := recordRequest(r)
+	// Restore the body so default handlers can read it again.
+	r.Body = io.NopCloser(bytes.NewReader(recorded.Body))
+
+	s.mu.Lock()
+	s.requests = append(s.requests, recorded)
+	latency := s.latency
+	drop := s.dropCount > 0
+	if drop {
+		s.dropCount--
+	}
+	fail := !drop && s.failCount > 0
+	failStatus := s.failStatus
+	if fail {
+		s.failCount--
+	}
+	var scripted *Response
+	key := scriptKey(r.Method, r.URL.Path)
+	if !drop && !fail && len(s.scripted[key]) > 0 {
+		scripted = &s.scripted[key][0]
+		s.scripted[key] = s.scripted[key][1:]
+	}
+	s.mu.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+
+	switch {
+	case drop:
+		dropConnection(w)
+	case fail:
+		writeJSON(w, failStatus, map[string]string{"error": http.StatusText(failStatus)})
+	case scripted != nil:
+		writeScripted(w, *scripted)
+	default:
+		s.defaultFunc(w, r)
+	}
+}
+
+func recordRequest(r *http.Request) RecordedRequest {
+	body, _ := io.ReadAll(r.Body)
+	recorded := RecordedRequest{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   body,
+		At:     time.Now(),
+	}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		clone := r.Clone(r.Context())
+		clone.Body = io.NopCloser(bytes.NewReader(body))
+		if err := clone.ParseMultipartForm(64 << 20); err == nil {
+			recorded.Fields = make(map[string]string)
+			for name, values := range clone.MultipartForm.Value {
+				if len(values) > 0 {
+					recorded.Fields[name] = values[0]
+				}
+			}
+			for field, headers := range clone.MultipartForm.File {
+				for _, fh := range headers {
+					f, err := fh.Open()
+					if err != nil {
+						continue
+					}
+					data, _ := io.ReadAll(f)
+					f.Close()
+					recorded.Files = append(recorded.Files, RecordedFile{
+						Field:       field,
+						Filename:    fh.Filename,
+						ContentType: fh.Header.Get("Content-Type"),
+						Data:        data,
+					})
+				}
+			}
+		}
+	}
+	return recorded
+}
+
+func writeScripted(w http.ResponseWriter, resp Response) {
+	if resp.Delay > 0 {
+		time.Sleep(resp.Delay)
+	}
+	for key, value := range resp.Headers {
+		w.Header().Set(key, value)
+	}
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	switch body := resp.Body.(type) {
+	case nil:
+		w.WriteHeader(status)
+	case string:
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	case []byte:
+		w.WriteHeader(status)
+		w.Write(body)
+	default:
+		writeJSON(w, status, body)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func dropConnection(w http.ResponseWriter) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
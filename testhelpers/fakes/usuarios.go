@@ -0,0 +1,130 @@
+package fakes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeSigningKey signs the JWTs issued by the fake. utils parses them unverified.
+var fakeSigningKey = []byte("duelig-fake-usuarios")
+
+// Seeded accounts, matching the ones testhelpers.LoginJugador and LoginCDO expect.
+const (
+	SeedJugadorEmail = "jugador1@duelig.co"
+	SeedCDOEmail     = "cdo1@duelig.co"
+	SeedPassword     = "Test1234!"
+)
+
+type fakeUser struct {
+	id       primitive.ObjectID
+	password string
+	rol      string
+}
+
+// Usuarios fakes DueligUsuarios: POST /api/v1/ValidateJWT, POST /api/v1/usuarios/login
+// and POST /api/v1/dcd/login.
+type Usuarios struct {
+	*Server
+
+	mu           sync.Mutex
+	users        map[string]fakeUser
+	sessionValid bool
+}
+
+// NewUsuarios starts a usuarios fake with the seeded jugador and CDO accounts.
+// By default ValidateJWT accepts any request carrying Authorization and Client-Type.
+func NewUsuarios() *Usuarios {
+	u := &Usuarios{users: make(map[string]fakeUser), sessionValid: true}
+	u.Server = newServer(u.handle)
+	u.AddUser(SeedJugadorEmail, SeedPassword, "Jugador")
+	u.AddUser(SeedCDOEmail, SeedPassword, "Dueniocentro")
+	return u
+}
+
+// AddUser registers an account that can log in and returns its generated ID.
+func (u *Usuarios) AddUser(email, password, rol string) primitive.ObjectID {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	id := primitive.NewObjectID()
+	u.users[strings.ToLower(email)] = fakeUser{id: id, password: password, rol: rol}
+	return id
+}
+
+// UserID returns the ID of a registered account, or NilObjectID if unknown.
+func (u *Usuarios) UserID(email string) primitive.ObjectID {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.users[strings.ToLower(email)].id
+}
+
+// SetSessionValid controls whether ValidateJWT returns 200 or 401.
+func (u *Usuarios) SetSessionValid(valid bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.sessionValid = valid
+}
+
+// IssueToken returns a JWT whose _id claim is userID, as DueligUsuarios does.
+func (u *Usuarios) IssueToken(userID primitive.ObjectID) string {
+	claims := jwt.MapClaims{
+		"_id": userID.Hex(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(fakeSigningKey)
+	return token
+}
+
+func (u *Usuarios) handle(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/ValidateJWT":
+		u.validateJWT(w, r)
+	case r.Method == http.MethodPost && (r.URL.Path == "/api/v1/usuarios/login" || r.URL.Path == "/api/v1/dcd/login"):
+		u.login(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/health":
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+}
+
+func (u *Usuarios) validateJWT(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	valid := u.sessionValid
+	u.mu.Unlock()
+
+	if !valid || r.Header.Get("Authorization") == "" || r.Header.Get("Client-Type") == "" {
+		http.Error(w, "invalid session", http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"valid": true})
+}
+
+func (u *Usuarios) login(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Correo   string `json:"correo"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+		return
+	}
+
+	u.mu.Lock()
+	user, exists := u.users[strings.ToLower(body.Correo)]
+	u.mu.Unlock()
+	if !exists || user.password != body.Password {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid credentials"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token":  u.IssueToken(user.id),
+		"refresh_token": u.IssueToken(user.id),
+	})
+}
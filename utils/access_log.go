@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// redactedValue reemplaza cualquier dato sensible en los logs
+const redactedValue = "[REDACTED]"
+
+// sensitiveHeaders siempre se redactan, sin importar la configuración
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-CSRF-Token", "X-Service-Key"}
+
+// sensitiveParamFragments redacta cualquier parámetro cuyo nombre contenga alguno de estos fragmentos
+var sensitiveParamFragments = []string{"password", "contrasena", "contraseña", "token", "secret", "signature", "apikey", "api_key"}
+
+// AccessLogConfig define cómo se registra cada solicitud atendida
+type AccessLogConfig struct {
+	// Output es el destino de los logs en JSON. Por defecto os.Stdout.
+	Output io.Writer
+	// SampleRates indica por ruta (plantilla de Gin o path) la fracción de respuestas exitosas que se registran.
+	// Por ejemplo {"/health": 0.01} registra una de cada cien. Los errores (status >= 400) siempre se registran.
+	SampleRates map[string]float64
+	// LogHeaders incluye las cabeceras de la solicitud, siempre redactadas
+	LogHeaders bool
+	// RedactHeaders agrega cabeceras a redactar además de las sensibles por defecto
+	RedactHeaders []string
+	// RedactParams agrega parámetros de query a redactar además de los sensibles por defecto
+	RedactParams []string
+}
+
+// AccessLogMiddleware registra en JSON cada solicitud al terminar: status, latencia, bytes,
+// IP del cliente, usuario, Client-Type, user agent y request ID.
+// Las credenciales de cabeceras y query nunca se escriben.
+func AccessLogMiddleware(cfg AccessLogConfig) gin.HandlerFunc {
+	output := cfg.Output
+	if output == nil {
+		output = os.Stdout
+	}
+	logger := slog.New(slog.NewJSONHandler(output, nil))
+
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		status := c.Writer.Status()
+		if !shouldSampleAccessLog(cfg.SampleRates, route, c.Request.URL.Path, status) {
+			return
+		}
+
+		bytesOut := c.Writer.Size()
+		if bytesOut < 0 {
+			bytesOut = 0
+		}
+
+		attrs := []slog.Attr{
+			slog.String("request_id", c.GetHeader("X-Request-ID")),
+			slog.String("method", c.Request.Method),
+			slog.String("route", route),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("query", RedactQuery(c.Request.URL.RawQuery, cfg.RedactParams...)),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int64("bytes_in", max(c.Request.ContentLength, 0)),
+			slog.Int("bytes_out", bytesOut),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("user_id", contextUserID(c)),
+			slog.String("client_type", c.GetHeader("Client-Type")),
+			slog.String("user_agent", c.Request.UserAgent()),
+		}
+		if cfg.LogHeaders {
+			attrs = append(attrs, slog.Any("headers", RedactHeaders(c.Request.Header, cfg.RedactHeaders...)))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		logger.LogAttrs(c.Request.Context(), level, "access", attrs...)
+	}
+}
+
+// shouldSampleAccessLog decide si una respuesta exitosa se registra según la tasa de su ruta
+func shouldSampleAccessLog(rates map[string]float64, route string, path string, status int) bool {
+	if status >= http.StatusBadRequest || len(rates) == 0 {
+		return true
+	}
+
+	rate, exists := rates[route]
+	if !exists {
+		rate, exists = rates[path]
+	}
+	if !exists || rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	return rand.Float64() < rate
+}
+
+// RedactHeaders retorna una copia plana de las cabeceras con las credenciales reemplazadas por [REDACTED]
+func RedactHeaders(headers http.Header, extra ...string) map[string]string {
+	redact := make(map[string]bool, len(sensitiveHeaders)+len(extra))
+	for _, name := range sensitiveHeaders {
+		redact[http.CanonicalHeaderKey(name)] = true
+	}
+	for _, name := range extra {
+		redact[http.CanonicalHeaderKey(name)] = true
+	}
+
+	result := make(map[string]string, len(headers))
+	for name, values := range headers {
+		if redact[http.CanonicalHeaderKey(name)] {
+			result[name] = redactedValue
+			continue
+		}
+		result[name] = strings.Join(values, ", ")
+	}
+	return result
+}
+
+// RedactQuery redacta los valores de tokens, contraseñas y otros secretos de un query string
+func RedactQuery(rawQuery string, extra ...string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		// Si no se puede parsear no se arriesga a escribir un secreto
+		return redactedValue
+	}
+
+	names := sortedKeys(values)
+	parts := make([]string, 0, len(values))
+	for _, name := range names {
+		for _, value := range values[name] {
+			if isSensitiveParam(name, extra) {
+				parts = append(parts, url.QueryEscape(name)+"="+redactedValue)
+				break
+			}
+			parts = append(parts, url.QueryEscape(name)+"="+url.QueryEscape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func isSensitiveParam(name string, extra []string) bool {
+	lower := strings.ToLower(name)
+	for _, fragment := range sensitiveParamFragments {
+		if strings.Contains(lower, fragment) {
+			return true
+		}
+	}
+	for _, param := range extra {
+		if strings.EqualFold(param, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRedactQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		extra []string
+		want  string
+	}{
+		{"vacío", "", nil, ""},
+		{"sin secretos", "page=2&q=futbol", nil, "page=2&q=futbol"},
+		{"token y contraseña", "access_token=abc&password=123&page=1", nil, "access_token=[REDACTED]&page=1&password=[REDACTED]"},
+		{"mayúsculas y fragmentos", "X-Api_Key=k&Contraseña=x&refreshToken=t", nil, "Contrase%C3%B1a=[REDACTED]&X-Api_Key=[REDACTED]&refreshToken=[REDACTED]"},
+		{"firma de URL", "expires=1&kid=a&signature=s", nil, "expires=1&kid=a&signature=[REDACTED]"},
+		{"valores repetidos", "token=a&token=b", nil, "token=[REDACTED]"},
+		{"parámetro extra", "codigo=1234&page=1", []string{"CODIGO"}, "codigo=[REDACTED]&page=1"},
+		{"query inválido", "a=%zz&token=x", nil, "[REDACTED]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactQuery(tt.query, tt.extra...); got != tt.want {
+				t.Errorf("RedactQuery(%q) = %q, se esperaba %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	headers := http.Header{
+		"Authorization": {"Bearer x"},
+		"Cookie":        {"session=1"},
+		"X-Csrf-Token":  {"c"},
+		"X-Service-Key": {"k"},
+		"X-Internal":    {"i"},
+		"Accept":        {"text/html", "application/json"},
+	}
+	got := RedactHeaders(headers, "x-internal")
+
+	want := map[string]string{
+		"Authorization": redactedValue,
+		"Cookie":        redactedValue,
+		"X-Csrf-Token":  redactedValue,
+		"X-Service-Key": redactedValue,
+		"X-Internal":    redactedValue,
+		"Accept":        "text/html, application/json",
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("%s = %q, se esperaba %q", name, got[name], value)
+		}
+	}
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		status      int
+		sampleRates map[string]float64
+		wantLogged  bool
+		wantLevel   string
+	}{
+		{"éxito", "/items/1?token=secreto&page=2", http.StatusOK, nil, true, "INFO"},
+		{"error del cliente", "/items/1", http.StatusNotFound, nil, true, "WARN"},
+		{"error del servidor", "/items/1", http.StatusBadGateway, nil, true, "ERROR"},
+		{"ruta muestreada en cero", "/items/1", http.StatusOK, map[string]float64{"/items/:id": 0}, false, ""},
+		{"errores siempre se registran", "/items/1", http.StatusInternalServerError, map[string]float64{"/items/:id": 0}, true, "ERROR"},
+		{"tasa completa", "/items/1", http.StatusOK, map[string]float64{"/items/:id": 1}, true, "INFO"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(AccessLogMiddleware(AccessLogConfig{Output: &buf, SampleRates: tt.sampleRates, LogHeaders: true}))
+			router.GET("/items/:id", func(c *gin.Context) { c.String(tt.status, "ok") })
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer secreto")
+			req.Header.Set("X-Request-ID", "req-1")
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			if !tt.wantLogged {
+				if buf.Len() != 0 {
+					t.Fatalf("no se esperaba log, se escribió %s", buf.String())
+				}
+				return
+			}
+			if strings.Contains(buf.String(), "secreto") {
+				t.Fatalf("el log contiene una credencial: %s", buf.String())
+			}
+
+			var entry map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("log que no es JSON: %s", buf.String())
+			}
+			if entry["level"] != tt.wantLevel || entry["route"] != "/items/:id" || entry["request_id"] != "req-1" {
+				t.Errorf("log inesperado: %v", entry)
+			}
+			if int(entry["status"].(float64)) != tt.status || entry["bytes_out"].(float64) != 2 {
+				t.Errorf("status o bytes_out inesperados: %v", entry)
+			}
+			if headers, _ := entry["headers"].(map[string]any); headers["Authorization"] != redactedValue {
+				t.Errorf("Authorization no se redactó: %v", entry["headers"])
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime/multipart"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UploadResult es el resultado de subir un archivo
+type UploadResult struct {
+	Path string
+	// SHA256 es el hash en hexadecimal de los bytes guardados, para verificar la integridad al descargarlos
+	SHA256 string
+	// Deduplicated es true cuando no se enviaron bytes porque el mismo contenido ya estaba guardado
+	Deduplicated bool
+}
+
+// DedupeStore relaciona el hash de un contenido con la ruta donde ya está guardado
+type DedupeStore interface {
+	// Lookup retorna la ruta guardada para la clave, y false si no existe
+	Lookup(ctx context.Context, key string) (string, bool, error)
+	// Remember guarda la ruta de la clave
+	Remember(ctx context.Context, key string, path string) error
+	// Forget elimina las claves que apuntan a la ruta, por ejemplo después de borrar el archivo
+	Forget(ctx context.Context, path string) error
+}
+
+// errDedupeScopeRequired es el error de las subidas con WithDedupe sin scope
+var errDedupeScopeRequired = errors.New("WithDedupe necesita un scope que identifique al dueño del archivo")
+
+// dedupeKey arma la clave del contenido. Incluye el alcance, el endpoint y el Kindfile para que
+// un archivo privado nunca se resuelva con la ruta de uno público ni de otro usuario.
+func dedupeKey(scope, urlsavefiles, kindfile, sum string) string {
+	return scope + "|" + urlsavefiles + "|" + kindfile + "|" + sum
+}
+
+// forgetDeduplicated quita la ruta eliminada del almacén de deduplicación, si la subida usa uno
+func forgetDeduplicated(path string, cfg *uploadConfig, c *gin.Context) {
+	if cfg.dedupe == nil {
+		return
+	}
+	if err := cfg.dedupe.Forget(requestContext(c), path); err != nil {
+		Logger(c).Warn("No se pudo quitar el archivo del almacén de deduplicación", "file_path", path, "error", err)
+	}
+}
+
+// hashFileHeader calcula el SHA-256 del archivo del formulario en hexadecimal
+func hashFileHeader(file *multipart.FileHeader) (string, error) {
+	fileContent, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer fileContent.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, fileContent); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+///////////////////////////////////////////////////////////////
+//				Almacén en memoria
+///////////////////////////////////////////////////////////////
+
+// MemoryDedupeStore guarda las rutas en memoria. Sirve para pruebas y servicios de una sola instancia.
+type MemoryDedupeStore struct {
+	mu    sync.RWMutex
+	paths map[string]string
+}
+
+// NewMemoryDedupeStore crea un almacén vacío
+func NewMemoryDedupeStore() *MemoryDedupeStore {
+	return &MemoryDedupeStore{paths: make(map[string]string)}
+}
+
+func (s *MemoryDedupeStore) Lookup(_ context.Context, key string) (string, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	path, found := s.paths[key]
+	return path, found, nil
+}
+
+func (s *MemoryDedupeStore) Remember(_ context.Context, key string, path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paths[key] = path
+	return nil
+}
+
+func (s *MemoryDedupeStore) Forget(_ context.Context, path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, stored := range s.paths {
+		if stored == path {
+			delete(s.paths, key)
+		}
+	}
+	return nil
+}
+
+///////////////////////////////////////////////////////////////
+//				Almacén en MongoDB
+///////////////////////////////////////////////////////////////
+
+// MongoDedupeStore guarda las rutas en una colección de MongoDB, compartida entre instancias.
+// Cada documento tiene _id (la clave), path y created_at.
+type MongoDedupeStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoDedupeStore crea el almacén sobre la colección indicada
+func NewMongoDedupeStore(collection *mongo.Collection) *MongoDedupeStore {
+	return &MongoDedupeStore{collection: collection}
+}
+
+// EnsureIndexes crea el índice por path que usa Forget. Se llama una vez al iniciar el servicio.
+func (s *MongoDedupeStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "path", Value: 1}}})
+	return err
+}
+
+func (s *MongoDedupeStore) Lookup(ctx context.Context, key string) (string, bool, error) {
+	var doc struct {
+		Path string `bson:"path"`
+	}
+	err := s.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return doc.Path, true, nil
+}
+
+func (s *MongoDedupeStore) Remember(ctx context.Context, key string, path string) error {
+	// Si dos subidas iguales terminan a la vez se conserva la primera ruta
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": key},
+		bson.M{"$setOnInsert": bson.M{"path": path, "created_at": time.Now().UTC()}},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+func (s *MongoDedupeStore) Forget(ctx context.Context, path string) error {
+	_, err := s.collection.DeleteMany(ctx, bson.M{"path": path})
+	return err
+}
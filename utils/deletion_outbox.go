@@ -0,0 +1,311 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Estados de las entradas del outbox de eliminaciones
+const (
+	DeletionStatusPending = "pending"
+	DeletionStatusDead    = "dead"
+)
+
+// Valores por defecto del worker del outbox
+const (
+	DefaultDeletionLease     = time.Minute
+	DefaultDeletionBatchSize = 50
+)
+
+// deletionOutboxSize expone cuántas entradas hay en el outbox por estado; se actualiza en cada RunOnce
+var deletionOutboxSize = DefaultMetrics.NewGauge(
+	"duelig_file_deletion_outbox",
+	"Entradas del outbox de eliminaciones de archivos por estado.",
+	"status")
+
+// DeletionCounts resume el estado del outbox para monitoreo
+type DeletionCounts struct {
+	// Pending son las entradas que esperan un intento, incluidas las que tiene tomadas un worker
+	Pending int64
+	// Due son las pendientes cuya hora de reintento ya llegó; si crece, los workers no dan abasto
+	Due int64
+	// Dead son las que agotaron los intentos y requieren revisión manual
+	Dead int64
+}
+
+// errOutboxNoCredentials es el error de RunOnce cuando el outbox no tiene credenciales de servicio
+var errOutboxNoCredentials = errors.New("MongoDeletionOutbox necesita Headers con las credenciales de servicio para reintentar")
+
+// deletionOutboxDoc es el documento de cada eliminación pendiente en MongoDB
+type deletionOutboxDoc struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	FilePath      string             `bson:"file_path"`
+	URLDeleteFile string             `bson:"url_delete_file"`
+	Headers       map[string]string  `bson:"headers,omitempty"`
+	Reason        string             `bson:"reason,omitempty"`
+	Status        string             `bson:"status"`
+	Attempts      int                `bson:"attempts"`
+	LastError     string             `bson:"last_error,omitempty"`
+	NextAttempt   time.Time          `bson:"next_attempt"`
+	LeaseOwner    string             `bson:"lease_owner,omitempty"`
+	LeaseUntil    time.Time          `bson:"lease_until"`
+	CreatedAt     time.Time          `bson:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at"`
+}
+
+func (d deletionOutboxDoc) job() DeletionJob {
+	return DeletionJob{
+		FilePath:      d.FilePath,
+		URLDeleteFile: d.URLDeleteFile,
+		Headers:       d.Headers,
+		Reason:        d.Reason,
+		Attempts:      d.Attempts,
+		LastError:     d.LastError,
+		NextAttempt:   d.NextAttempt,
+		CreatedAt:     d.CreatedAt,
+	}
+}
+
+// MongoDeletionOutbox guarda las eliminaciones pendientes en una colección de MongoDB, así no se
+// pierden si el proceso se reinicia. Se usa con WithDeletionQueue y se procesa con Start en cada réplica.
+//
+// Varias réplicas pueden procesar la misma colección: cada una toma una entrada con un lease de
+// LeaseDuration y solo quien tiene el lease puede cerrarla. Si una réplica muere a mitad de un intento,
+// la entrada vuelve a estar disponible cuando vence el lease.
+//
+// Las entradas nunca guardan credenciales: Enqueue descarta Authorization, Cookie y las demás
+// cabeceras sensibles del job. Los reintentos se autentican con Headers, que es obligatorio.
+type MongoDeletionOutbox struct {
+	MaxAttempts   int
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration
+	LeaseDuration time.Duration
+	BatchSize     int
+	// Owner identifica a la réplica en los leases; por defecto es un UUID
+	Owner string
+	// Headers son las credenciales de servicio con las que se autentican los reintentos,
+	// por ejemplo {"X-Service-Key": "..."}. Sin ellas RunOnce retorna error.
+	Headers map[string]string
+
+	collection *mongo.Collection
+}
+
+// NewMongoDeletionOutbox crea el outbox sobre la colección indicada con los valores por defecto
+func NewMongoDeletionOutbox(collection *mongo.Collection) *MongoDeletionOutbox {
+	return &MongoDeletionOutbox{
+		MaxAttempts:   DefaultDeletionMaxAttempts,
+		BaseDelay:     DefaultDeletionBaseDelay,
+		MaxDelay:      DefaultDeletionMaxDelay,
+		LeaseDuration: DefaultDeletionLease,
+		BatchSize:     DefaultDeletionBatchSize,
+		Owner:         uuid.NewString(),
+		collection:    collection,
+	}
+}
+
+// EnsureIndexes crea el índice que usan los workers para tomar entradas. Se llama una vez al iniciar el servicio.
+func (o *MongoDeletionOutbox) EnsureIndexes(ctx context.Context) error {
+	_, err := o.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt", Value: 1}},
+	})
+	return err
+}
+
+// Enqueue guarda la eliminación. Si no trae NextAttempt, se programa según los intentos que ya lleva.
+func (o *MongoDeletionOutbox) Enqueue(ctx context.Context, job DeletionJob) error {
+	now := time.Now().UTC()
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = now
+	}
+	if job.NextAttempt.IsZero() {
+		job.NextAttempt = now
+		if job.Attempts > 0 {
+			job.NextAttempt = now.Add(deletionBackoff(job.Attempts, o.BaseDelay, o.MaxDelay))
+		}
+	}
+
+	_, err := o.collection.InsertOne(ctx, deletionOutboxDoc{
+		FilePath:      job.FilePath,
+		URLDeleteFile: job.URLDeleteFile,
+		Headers:       withoutCredentials(job.Headers),
+		Reason:        job.Reason,
+		Status:        DeletionStatusPending,
+		Attempts:      job.Attempts,
+		LastError:     job.LastError,
+		NextAttempt:   job.NextAttempt,
+		CreatedAt:     job.CreatedAt,
+		UpdatedAt:     now,
+	})
+	return err
+}
+
+// claim toma la siguiente entrada pendiente cuya hora llegó y que nadie tiene tomada.
+// Retorna nil si no hay ninguna.
+func (o *MongoDeletionOutbox) claim(ctx context.Context) (*deletionOutboxDoc, error) {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"status":       DeletionStatusPending,
+		"next_attempt": bson.M{"$lte": now},
+		"lease_until":  bson.M{"$lte": now},
+	}
+	update := bson.M{"$set": bson.M{
+		"lease_owner": o.Owner,
+		"lease_until": now.Add(o.LeaseDuration),
+		"updated_at":  now,
+	}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var doc deletionOutboxDoc
+	err := o.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// RunOnce procesa hasta BatchSize entradas y retorna cuántos archivos se eliminaron.
+// Al final actualiza las métricas con Counts.
+func (o *MongoDeletionOutbox) RunOnce(ctx context.Context) (int, error) {
+	if len(o.Headers) == 0 {
+		return 0, errOutboxNoCredentials
+	}
+
+	deleted := 0
+	for i := 0; i < o.BatchSize && ctx.Err() == nil; i++ {
+		doc, err := o.claim(ctx)
+		if err != nil {
+			return deleted, err
+		}
+		if doc == nil {
+			break
+		}
+
+		ok, err := o.attempt(ctx, doc)
+		if err != nil {
+			return deleted, err
+		}
+		if ok {
+			deleted++
+		}
+	}
+
+	counts, err := o.Counts(ctx)
+	if err != nil {
+		return deleted, err
+	}
+	deletionOutboxSize.Set(float64(counts.Pending), DeletionStatusPending)
+	deletionOutboxSize.Set(float64(counts.Dead), DeletionStatusDead)
+	return deleted, nil
+}
+
+// attempt elimina el archivo de la entrada tomada y la cierra o la reprograma.
+// Todas las escrituras filtran por lease_owner: si el lease venció y otra réplica tomó la entrada,
+// esta réplica ya no la modifica.
+func (o *MongoDeletionOutbox) attempt(ctx context.Context, doc *deletionOutboxDoc) (bool, error) {
+	job := doc.job()
+	owned := bson.M{"_id": doc.ID, "lease_owner": o.Owner}
+
+	deleteErr := runDeletion(ctx, job, o.Headers)
+	if deleteErr == nil {
+		deletionRetriesTotal.Inc("deleted")
+		BaseLogger().Info("Archivo eliminado en reintento", "file_path", job.FilePath, "reason", job.Reason, "attempts", job.Attempts+1)
+		_, err := o.collection.DeleteOne(ctx, owned)
+		return true, err
+	}
+
+	now := time.Now().UTC()
+	attempts := doc.Attempts + 1
+	set := bson.M{
+		"attempts":    attempts,
+		"last_error":  deleteErr.Error(),
+		"lease_owner": "",
+		"lease_until": time.Time{},
+		"updated_at":  now,
+	}
+	if attempts >= o.MaxAttempts {
+		set["status"] = DeletionStatusDead
+		deletionRetriesTotal.Inc("dead")
+		BaseLogger().Error("Se agotaron los reintentos de eliminación", "file_path", job.FilePath, "reason", job.Reason, "attempts", attempts, "error", deleteErr)
+	} else {
+		set["next_attempt"] = now.Add(deletionBackoff(attempts, o.BaseDelay, o.MaxDelay))
+		deletionRetriesTotal.Inc("retry")
+		BaseLogger().Warn("No se pudo eliminar el archivo, se reintentará", "file_path", job.FilePath, "attempts", attempts, "next_attempt", set["next_attempt"], "error", deleteErr)
+	}
+	_, err := o.collection.UpdateOne(ctx, owned, bson.M{"$set": set})
+	return false, err
+}
+
+// Start procesa el outbox cada interval en una goroutine hasta que se cancele ctx
+func (o *MongoDeletionOutbox) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := o.RunOnce(ctx); err != nil && ctx.Err() == nil {
+					BaseLogger().Error("Error al procesar el outbox de eliminaciones", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Counts cuenta las entradas del outbox por estado
+func (o *MongoDeletionOutbox) Counts(ctx context.Context) (DeletionCounts, error) {
+	var counts DeletionCounts
+	var err error
+	if counts.Pending, err = o.collection.CountDocuments(ctx, bson.M{"status": DeletionStatusPending}); err != nil {
+		return counts, err
+	}
+	due := bson.M{"status": DeletionStatusPending, "next_attempt": bson.M{"$lte": time.Now().UTC()}}
+	if counts.Due, err = o.collection.CountDocuments(ctx, due); err != nil {
+		return counts, err
+	}
+	if counts.Dead, err = o.collection.CountDocuments(ctx, bson.M{"status": DeletionStatusDead}); err != nil {
+		return counts, err
+	}
+	return counts, nil
+}
+
+// RetryDead vuelve a poner como pendientes las entradas muertas con los intentos en cero,
+// por ejemplo después de corregir la causa de las fallas. Retorna cuántas se reactivaron.
+func (o *MongoDeletionOutbox) RetryDead(ctx context.Context) (int64, error) {
+	now := time.Now().UTC()
+	result, err := o.collection.UpdateMany(ctx,
+		bson.M{"status": DeletionStatusDead},
+		bson.M{"$set": bson.M{"status": DeletionStatusPending, "attempts": 0, "next_attempt": now, "updated_at": now}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// withoutCredentials retorna una copia de las cabeceras sin las sensibles (Authorization, Cookie,
+// X-CSRF-Token...), para que la sesión del usuario no quede guardada en MongoDB
+func withoutCredentials(headers map[string]string) map[string]string {
+	clean := make(map[string]string, len(headers))
+	for name, value := range headers {
+		sensitive := slices.ContainsFunc(sensitiveHeaders, func(s string) bool { return strings.EqualFold(s, name) })
+		if !sensitive {
+			clean[name] = value
+		}
+	}
+	return clean
+}
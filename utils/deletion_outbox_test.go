@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/edwinrubio/DueligUtils/testhelpers/fakes"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// Las pruebas del outbox usan el despliegue simulado de mtest: no necesitan un servidor de MongoDB,
+// responden con lo que se programa en AddMockResponses y registran los comandos enviados.
+
+// outboxDocReply es la respuesta de findAndModify con el documento tomado, o sin documento si doc es nil
+func outboxDocReply(t *testing.T, doc *deletionOutboxDoc) bson.D {
+	t.Helper()
+	if doc == nil {
+		return mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil})
+	}
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value bson.D
+	if err := bson.Unmarshal(raw, &value); err != nil {
+		t.Fatal(err)
+	}
+	return mtest.CreateSuccessResponse(bson.E{Key: "value", Value: value})
+}
+
+// countReplies son las respuestas de los tres CountDocuments de Counts
+func countReplies(pending, due, dead int) []bson.D {
+	replies := make([]bson.D, 0, 3)
+	for _, n := range []int{pending, due, dead} {
+		replies = append(replies, mtest.CreateCursorResponse(0, "db.outbox", mtest.FirstBatch, bson.D{{Key: "n", Value: n}}))
+	}
+	return replies
+}
+
+// startedCommand retorna el primer comando enviado con ese nombre
+func startedCommand(mt *mtest.T, name string) bson.Raw {
+	mt.Helper()
+	for _, started := range mt.GetAllStartedEvents() {
+		if started.CommandName == name {
+			return started.Command
+		}
+	}
+	mt.Fatalf("no se envió %s", name)
+	return nil
+}
+
+// newTestOutbox crea un outbox sobre la colección simulada con credenciales de servicio
+func newTestOutbox(mt *mtest.T) *MongoDeletionOutbox {
+	outbox := NewMongoDeletionOutbox(mt.Coll)
+	outbox.Owner = "replica-1"
+	outbox.MaxAttempts = 3
+	outbox.BaseDelay = time.Minute
+	outbox.MaxDelay = 4 * time.Minute
+	outbox.BatchSize = 1
+	outbox.Headers = map[string]string{"X-Service-Key": "clave"}
+	return outbox
+}
+
+func TestMongoDeletionOutboxEnqueue(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("descarta las credenciales y programa el reintento", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		outbox := newTestOutbox(mt)
+
+		before := time.Now()
+		err := outbox.Enqueue(context.Background(), DeletionJob{
+			FilePath:      "Documents/1-a.txt",
+			URLDeleteFile: "http://archivos/DeleteFile",
+			Headers:       map[string]string{"Authorization": "Bearer usuario", "Cookie": "sesion=1", "X-Request-ID": "req-1"},
+			Reason:        "commit",
+			Attempts:      2,
+		})
+		if err != nil {
+			mt.Fatalf("Enqueue: %v", err)
+		}
+
+		var doc deletionOutboxDoc
+		if err := bson.Unmarshal(startedCommand(mt, "insert").Lookup("documents", "0").Document(), &doc); err != nil {
+			mt.Fatal(err)
+		}
+		if len(doc.Headers) != 1 || doc.Headers["X-Request-ID"] != "req-1" {
+			mt.Errorf("el documento guardó cabeceras sensibles: %v", doc.Headers)
+		}
+		if doc.Status != DeletionStatusPending || doc.Attempts != 2 || !doc.LeaseUntil.IsZero() {
+			mt.Errorf("documento inesperado: %+v", doc)
+		}
+		if wait := doc.NextAttempt.Sub(before); wait < 2*time.Minute-time.Second || wait > 2*time.Minute+time.Second {
+			mt.Errorf("el reintento se programó en %v, se esperaba 2m", wait)
+		}
+	})
+}
+
+func TestMongoDeletionOutboxRunOnce(t *testing.T) {
+	const path = "Documents/1-a.txt"
+	tests := []struct {
+		name     string
+		attempts int
+		// response es la respuesta del servicio de archivos; nil si el outbox no tiene entradas
+		response *fakes.Response
+		// write es el comando con el que se cierra la entrada: delete o update
+		write        string
+		wantDeleted  int
+		wantStatus   string
+		wantAttempts int
+	}{
+		{name: "sin entradas"},
+		{name: "se elimina", response: &fakes.Response{Status: http.StatusOK, Body: map[string]string{}}, write: "delete", wantDeleted: 1},
+		{name: "ya no existe", response: &fakes.Response{Status: http.StatusNotFound}, write: "delete", wantDeleted: 1},
+		{name: "falla y se reprograma", attempts: 1, response: &fakes.Response{Status: http.StatusInternalServerError}, write: "update", wantAttempts: 2},
+		{name: "agota los intentos", attempts: 2, response: &fakes.Response{Status: http.StatusInternalServerError}, write: "update", wantStatus: DeletionStatusDead, wantAttempts: 3},
+	}
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			saveFiles := fakes.NewSaveFiles()
+			defer saveFiles.Close()
+			outbox := newTestOutbox(mt)
+
+			var claimed *deletionOutboxDoc
+			if tt.response != nil {
+				saveFiles.On(http.MethodDelete, "/DeleteFile", *tt.response)
+				claimed = &deletionOutboxDoc{
+					ID:            primitive.NewObjectID(),
+					FilePath:      path,
+					URLDeleteFile: saveFiles.URL + "/DeleteFile",
+					Headers:       map[string]string{"X-Request-ID": "req-1"},
+					Status:        DeletionStatusPending,
+					Attempts:      tt.attempts,
+					LeaseOwner:    outbox.Owner,
+					LeaseUntil:    time.Now().Add(outbox.LeaseDuration),
+				}
+			}
+			mt.AddMockResponses(outboxDocReply(t, claimed))
+			if claimed != nil {
+				mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+			}
+			mt.AddMockResponses(countReplies(0, 0, 0)...)
+
+			before := time.Now().UTC()
+			deleted, err := outbox.RunOnce(context.Background())
+			if err != nil || deleted != tt.wantDeleted {
+				mt.Fatalf("RunOnce = %d, %v; se esperaba %d", deleted, err, tt.wantDeleted)
+			}
+
+			// La entrada solo se toma si está pendiente, su hora llegó y su lease venció
+			claim := startedCommand(mt, "findAndModify")
+			query := claim.Lookup("query")
+			if status := query.Document().Lookup("status").StringValue(); status != DeletionStatusPending {
+				mt.Errorf("se toman entradas en estado %q", status)
+			}
+			for _, field := range []string{"next_attempt", "lease_until"} {
+				limit, ok := query.Document().Lookup(field, "$lte").TimeOK()
+				if !ok || limit.Before(before.Truncate(time.Millisecond)) || limit.After(time.Now()) {
+					mt.Errorf("%s debe filtrar por $lte ahora, filtra por %v", field, limit)
+				}
+			}
+			set := claim.Lookup("update", "$set").Document()
+			if owner := set.Lookup("lease_owner").StringValue(); owner != outbox.Owner {
+				mt.Errorf("el lease se tomó a nombre de %q", owner)
+			}
+			if lease := set.Lookup("lease_until").Time().Sub(before); lease < outbox.LeaseDuration-time.Second || lease > outbox.LeaseDuration+time.Second {
+				mt.Errorf("el lease dura %v, se esperaba %v", lease, outbox.LeaseDuration)
+			}
+
+			requests := saveFiles.RequestsTo("/DeleteFile")
+			if claimed == nil {
+				if len(requests) != 0 {
+					mt.Error("sin entradas no se debe eliminar nada")
+				}
+				return
+			}
+			if len(requests) != 1 || requests[0].Header.Get("X-Service-Key") != "clave" || requests[0].Header.Get("X-Request-ID") != "req-1" {
+				mt.Fatalf("el reintento no usó las credenciales de servicio: %+v", requests)
+			}
+
+			// Las escrituras filtran por lease_owner: si el lease venció y otra réplica tomó
+			// la entrada, esta réplica ya no la modifica
+			write := startedCommand(mt, tt.write)
+			var filter bson.Raw
+			if tt.write == "delete" {
+				filter = write.Lookup("deletes", "0", "q").Document()
+			} else {
+				filter = write.Lookup("updates", "0", "q").Document()
+			}
+			if owner, _ := filter.Lookup("lease_owner").StringValueOK(); filter.Lookup("_id").ObjectID() != claimed.ID || owner != outbox.Owner {
+				mt.Errorf("la escritura no filtra por el lease: %v", filter)
+			}
+			if tt.write == "delete" {
+				return
+			}
+
+			update := write.Lookup("updates", "0", "u", "$set").Document()
+			if got := int(update.Lookup("attempts").AsInt64()); got != tt.wantAttempts {
+				mt.Errorf("attempts = %d, se esperaba %d", got, tt.wantAttempts)
+			}
+			if update.Lookup("lease_owner").StringValue() != "" || !update.Lookup("lease_until").Time().Equal(time.Time{}) {
+				mt.Error("el intento fallido debe liberar el lease")
+			}
+			status, hasStatus := update.Lookup("status").StringValueOK()
+			_, hasNext := update.Lookup("next_attempt").TimeOK()
+			if status != tt.wantStatus || hasStatus != (tt.wantStatus != "") || hasNext == hasStatus {
+				mt.Errorf("estado %q, next_attempt %v; se esperaba estado %q", status, hasNext, tt.wantStatus)
+			}
+			if hasNext {
+				// Con dos intentos la espera es 2 * BaseDelay
+				if wait := update.Lookup("next_attempt").Time().Sub(before); wait < 2*time.Minute-time.Second || wait > 2*time.Minute+time.Second {
+					mt.Errorf("el reintento se programó en %v, se esperaba 2m", wait)
+				}
+			}
+		})
+	}
+}
+
+func TestMongoDeletionOutboxRunOnceRequiresCredentials(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("sin Headers", func(mt *mtest.T) {
+		outbox := newTestOutbox(mt)
+		outbox.Headers = nil
+		if _, err := outbox.RunOnce(context.Background()); !errors.Is(err, errOutboxNoCredentials) {
+			mt.Fatalf("RunOnce = %v, se esperaba errOutboxNoCredentials", err)
+		}
+		if events := mt.GetAllStartedEvents(); len(events) != 0 {
+			mt.Errorf("sin credenciales no se debe tomar ninguna entrada, se enviaron %d comandos", len(events))
+		}
+	})
+}
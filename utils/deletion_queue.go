@@ -0,0 +1,257 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Valores por defecto de los reintentos de eliminación
+const (
+	DefaultDeletionMaxAttempts = 10
+	DefaultDeletionBaseDelay   = 5 * time.Second
+	DefaultDeletionMaxDelay    = 15 * time.Minute
+	DefaultDeletionMaxPending  = 1000
+)
+
+// Errores de MemoryDeletionQueue
+var (
+	errDeletionQueueNotStarted    = errors.New("la cola de eliminaciones no está en ejecución: se debe llamar Start antes de encolar")
+	errDeletionQueueFull          = errors.New("la cola de eliminaciones está llena")
+	errDeletionQueueNoCredentials = errors.New("MemoryDeletionQueue necesita Headers con las credenciales de servicio para reintentar")
+)
+
+// deletionRetriesTotal cuenta los reintentos de eliminación de las colas por resultado:
+// deleted (se eliminó), retry (falló y se reprograma) o dead (agotó los intentos)
+var deletionRetriesTotal = DefaultMetrics.NewCounter(
+	"duelig_file_deletion_retries_total",
+	"Total de reintentos de eliminación de archivos por resultado.",
+	"result")
+
+// DeletionJob es la eliminación pendiente de un archivo en el servicio de archivos
+type DeletionJob struct {
+	FilePath      string
+	URLDeleteFile string
+	// Headers son cabeceras no sensibles de la solicitud original, como X-Request-ID, para seguir el
+	// reintento en los logs. Nunca llevan credenciales del usuario: los reintentos se autentican con
+	// las credenciales de servicio de la cola.
+	Headers map[string]string
+	// Reason indica de dónde viene la eliminación, por ejemplo "commit" o "rollback"
+	Reason      string
+	Attempts    int
+	LastError   string
+	NextAttempt time.Time
+	CreatedAt   time.Time
+}
+
+// DeletionQueue recibe las eliminaciones que fallaron para reintentarlas más tarde
+type DeletionQueue interface {
+	Enqueue(ctx context.Context, job DeletionJob) error
+}
+
+// deletionBackoff es la espera antes del siguiente intento: se duplica con cada intento hasta maxDelay
+func deletionBackoff(attempts int, baseDelay, maxDelay time.Duration) time.Duration {
+	delay := baseDelay
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// deletionJobHeaders retorna las cabeceras de la solicitud que se pueden guardar con un DeletionJob.
+// Authorization, Cookie y X-CSRF-Token quedan fuera: la sesión del usuario no debe viajar a las colas.
+func deletionJobHeaders(c *gin.Context) map[string]string {
+	headers := make(map[string]string)
+	if c == nil || c.Request == nil {
+		return headers
+	}
+	for _, name := range []string{"Client-Type", "X-Request-ID"} {
+		if value := c.GetHeader(name); value != "" {
+			headers[name] = value
+		}
+	}
+	return headers
+}
+
+// runDeletion intenta eliminar el archivo del job con sus cabeceras más las credenciales de servicio
+// de la cola, que tienen prioridad. Un 404 significa que ya no existe y cuenta como éxito.
+func runDeletion(ctx context.Context, job DeletionJob, serviceHeaders map[string]string) error {
+	headers := make(map[string]string, len(job.Headers)+len(serviceHeaders))
+	for name, value := range job.Headers {
+		headers[name] = value
+	}
+	for name, value := range serviceHeaders {
+		headers[name] = value
+	}
+	err := deleteFileWithHeaders(ctx, job.FilePath, job.URLDeleteFile, headers)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// MemoryDeletionQueue reintenta las eliminaciones en memoria con espera exponencial.
+// Los jobs que agotan MaxAttempts pasan a Dead. Los pendientes se pierden si el proceso termina;
+// para no perderlos entre reinicios se usa una cola persistente.
+//
+// La cola solo acepta jobs mientras Start la está procesando, y a lo sumo MaxPending: sin un worker
+// o con el servicio de archivos caído, los jobs se acumularían en memoria sin límite.
+type MemoryDeletionQueue struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// MaxPending es el máximo de jobs pendientes; con la cola llena Enqueue retorna error
+	MaxPending int
+	// Headers son las credenciales de servicio con las que se autentican los reintentos,
+	// por ejemplo {"X-Service-Key": "..."}. Sin ellas RunOnce retorna error.
+	Headers map[string]string
+
+	// workers cuenta las goroutines de Start en ejecución
+	workers atomic.Int32
+	mu      sync.Mutex
+	pending []DeletionJob
+	dead    []DeletionJob
+}
+
+// NewMemoryDeletionQueue crea una cola con los valores por defecto
+func NewMemoryDeletionQueue() *MemoryDeletionQueue {
+	return &MemoryDeletionQueue{
+		MaxAttempts: DefaultDeletionMaxAttempts,
+		BaseDelay:   DefaultDeletionBaseDelay,
+		MaxDelay:    DefaultDeletionMaxDelay,
+		MaxPending:  DefaultDeletionMaxPending,
+	}
+}
+
+// DefaultDeletionQueue es la cola que usan BeginFileUpdate y UpdateFile si no se indica WithDeletionQueue.
+// Mientras el servicio no la inicie con DefaultDeletionQueue.Start, después de configurar sus
+// credenciales en DefaultDeletionQueue.Headers, no acepta jobs: las eliminaciones que fallan se
+// registran en el log y Commit y Rollback retornan el error.
+var DefaultDeletionQueue = NewMemoryDeletionQueue()
+
+// Enqueue agrega el job. Si no trae NextAttempt, se programa según los intentos que ya lleva.
+// Retorna error si la cola no está en ejecución o si ya tiene MaxPending jobs.
+func (q *MemoryDeletionQueue) Enqueue(_ context.Context, job DeletionJob) error {
+	if q.workers.Load() == 0 {
+		return errDeletionQueueNotStarted
+	}
+
+	now := time.Now()
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = now
+	}
+	if job.NextAttempt.IsZero() {
+		job.NextAttempt = now
+		if job.Attempts > 0 {
+			job.NextAttempt = now.Add(deletionBackoff(job.Attempts, q.BaseDelay, q.MaxDelay))
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.MaxPending > 0 && len(q.pending) >= q.MaxPending {
+		BaseLogger().Error("La cola de eliminaciones está llena, se descarta el job", "file_path", job.FilePath, "reason", job.Reason, "max_pending", q.MaxPending)
+		return errDeletionQueueFull
+	}
+	q.pending = append(q.pending, job)
+	return nil
+}
+
+// RunOnce intenta los jobs cuya hora ya llegó y retorna cuántos archivos se eliminaron.
+// Sin Headers retorna error sin intentar ninguno.
+func (q *MemoryDeletionQueue) RunOnce(ctx context.Context) (int, error) {
+	if len(q.Headers) == 0 {
+		return 0, errDeletionQueueNoCredentials
+	}
+	now := time.Now()
+
+	q.mu.Lock()
+	var due, waiting []DeletionJob
+	for _, job := range q.pending {
+		if job.NextAttempt.After(now) {
+			waiting = append(waiting, job)
+		} else {
+			due = append(due, job)
+		}
+	}
+	q.pending = waiting
+	q.mu.Unlock()
+
+	deleted := 0
+	for _, job := range due {
+		if ctx.Err() != nil {
+			// Los jobs que no se alcanzaron a intentar vuelven a la cola sin contar el intento
+			q.requeue(job)
+			continue
+		}
+
+		err := runDeletion(ctx, job, q.Headers)
+		if err == nil {
+			deleted++
+			deletionRetriesTotal.Inc("deleted")
+			BaseLogger().Info("Archivo eliminado en reintento", "file_path", job.FilePath, "reason", job.Reason, "attempts", job.Attempts+1)
+			continue
+		}
+
+		job.Attempts++
+		job.LastError = err.Error()
+		if job.Attempts >= q.MaxAttempts {
+			deletionRetriesTotal.Inc("dead")
+			BaseLogger().Error("Se agotaron los reintentos de eliminación", "file_path", job.FilePath, "reason", job.Reason, "attempts", job.Attempts, "error", err)
+			q.mu.Lock()
+			q.dead = append(q.dead, job)
+			q.mu.Unlock()
+			continue
+		}
+		job.NextAttempt = time.Now().Add(deletionBackoff(job.Attempts, q.BaseDelay, q.MaxDelay))
+		deletionRetriesTotal.Inc("retry")
+		BaseLogger().Warn("No se pudo eliminar el archivo, se reintentará", "file_path", job.FilePath, "attempts", job.Attempts, "next_attempt", job.NextAttempt, "error", err)
+		q.requeue(job)
+	}
+	return deleted, nil
+}
+
+func (q *MemoryDeletionQueue) requeue(job DeletionJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = append(q.pending, job)
+}
+
+// Start procesa la cola cada interval en una goroutine hasta que se cancele ctx.
+// Desde que se llama Start y hasta que se cancela ctx la cola acepta jobs.
+func (q *MemoryDeletionQueue) Start(ctx context.Context, interval time.Duration) {
+	q.workers.Add(1)
+	go func() {
+		defer q.workers.Add(-1)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := q.RunOnce(ctx); err != nil && ctx.Err() == nil {
+					BaseLogger().Error("Error al procesar la cola de eliminaciones", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Pending retorna una copia de los jobs que esperan un reintento
+func (q *MemoryDeletionQueue) Pending() []DeletionJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]DeletionJob(nil), q.pending...)
+}
+
+// Dead retorna una copia de los jobs que agotaron los reintentos, para revisarlos manualmente
+func (q *MemoryDeletionQueue) Dead() []DeletionJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]DeletionJob(nil), q.dead...)
+}
@@ -0,0 +1,278 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/edwinrubio/DueligUtils/testhelpers/fakes"
+)
+
+// startedDeletionQueue crea una cola con credenciales de servicio y en ejecución hasta que termine
+// la prueba. El intervalo es largo para que las pruebas la procesen con RunOnce.
+func startedDeletionQueue(t *testing.T) *MemoryDeletionQueue {
+	t.Helper()
+	queue := NewMemoryDeletionQueue()
+	queue.Headers = map[string]string{"X-Service-Key": "clave"}
+	queue.Start(t.Context(), time.Hour)
+	return queue
+}
+
+func TestDeletionBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{6, 30 * time.Second},
+		{1000, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := deletionBackoff(tt.attempts, time.Second, 30*time.Second); got != tt.want {
+			t.Errorf("deletionBackoff(%d) = %v, se esperaba %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryDeletionQueueEnqueue(t *testing.T) {
+	job := DeletionJob{FilePath: "Documents/1-a.txt", URLDeleteFile: "http://archivos/DeleteFile"}
+
+	queue := NewMemoryDeletionQueue()
+	if err := queue.Enqueue(context.Background(), job); !errors.Is(err, errDeletionQueueNotStarted) {
+		t.Fatalf("Enqueue sin Start = %v, se esperaba errDeletionQueueNotStarted", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queue.MaxPending = 2
+	queue.Start(ctx, time.Hour)
+	before := time.Now()
+	if err := queue.Enqueue(ctx, job); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	retried := job
+	retried.Attempts = 2
+	if err := queue.Enqueue(ctx, retried); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if err := queue.Enqueue(ctx, job); !errors.Is(err, errDeletionQueueFull) {
+		t.Errorf("Enqueue con la cola llena = %v, se esperaba errDeletionQueueFull", err)
+	}
+
+	pending := queue.Pending()
+	if len(pending) != 2 {
+		t.Fatalf("hay %d jobs pendientes, se esperaban 2", len(pending))
+	}
+	if pending[0].NextAttempt.After(time.Now()) || pending[0].CreatedAt.Before(before) {
+		t.Errorf("un job sin intentos debe quedar listo: %+v", pending[0])
+	}
+	// Con dos intentos la espera es el doble de BaseDelay
+	if wait := pending[1].NextAttempt.Sub(before); wait < 2*queue.BaseDelay || wait > 2*queue.BaseDelay+time.Second {
+		t.Errorf("el job con dos intentos se programó en %v", wait)
+	}
+
+	// Al cancelar el contexto de Start la cola deja de aceptar jobs
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for !errors.Is(queue.Enqueue(context.Background(), job), errDeletionQueueNotStarted) {
+		if time.Now().After(deadline) {
+			t.Fatal("la cola sigue aceptando jobs después de cancelar Start")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMemoryDeletionQueueRunOnce(t *testing.T) {
+	const path = "Documents/1-a.txt"
+	tests := []struct {
+		name string
+		// responses son las respuestas del servicio a cada intento de eliminación
+		responses    []fakes.Response
+		attempts     int
+		wantDeleted  int
+		wantAttempts int
+		wantPending  bool
+		wantDead     bool
+	}{
+		{name: "se elimina", wantDeleted: 1},
+		{name: "ya no existe", responses: []fakes.Response{{Status: http.StatusNotFound}}, wantDeleted: 1},
+		{name: "falla y se reprograma", responses: []fakes.Response{{Status: http.StatusInternalServerError}}, attempts: 1, wantAttempts: 2, wantPending: true},
+		{name: "agota los intentos", responses: []fakes.Response{{Status: http.StatusInternalServerError}}, attempts: 2, wantAttempts: 3, wantDead: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saveFiles := fakes.NewSaveFiles()
+			defer saveFiles.Close()
+			saveFiles.PutFile(path, []byte("huérfano"))
+			saveFiles.On(http.MethodDelete, "/DeleteFile", tt.responses...)
+
+			queue := startedDeletionQueue(t)
+			queue.MaxAttempts = 3
+			queue.BaseDelay = time.Minute
+			queue.MaxDelay = 4 * time.Minute
+			job := DeletionJob{
+				FilePath:      path,
+				URLDeleteFile: saveFiles.URL + "/DeleteFile",
+				Headers:       map[string]string{"X-Request-ID": "req-1"},
+				Attempts:      tt.attempts,
+				NextAttempt:   time.Now().Add(-time.Second),
+			}
+			if err := queue.Enqueue(context.Background(), job); err != nil {
+				t.Fatal(err)
+			}
+
+			before := time.Now()
+			deleted, err := queue.RunOnce(context.Background())
+			if err != nil || deleted != tt.wantDeleted {
+				t.Fatalf("RunOnce = %d, %v; se esperaba %d", deleted, err, tt.wantDeleted)
+			}
+			requests := saveFiles.RequestsTo("/DeleteFile")
+			if len(requests) != 1 {
+				t.Fatalf("se hicieron %d intentos, se esperaba 1", len(requests))
+			}
+			// El reintento se autentica con las credenciales de la cola y conserva el X-Request-ID
+			if requests[0].Header.Get("X-Service-Key") != "clave" || requests[0].Header.Get("X-Request-ID") != "req-1" {
+				t.Errorf("cabeceras del reintento inesperadas: %v", requests[0].Header)
+			}
+
+			pending, dead := queue.Pending(), queue.Dead()
+			if (len(pending) == 1) != tt.wantPending || (len(dead) == 1) != tt.wantDead {
+				t.Fatalf("pendientes %+v, muertos %+v", pending, dead)
+			}
+			switch {
+			case tt.wantPending:
+				// La espera se duplica con cada intento: con dos intentos es 2 * BaseDelay
+				if wait := pending[0].NextAttempt.Sub(before); wait < 2*time.Minute || wait > 2*time.Minute+time.Second {
+					t.Errorf("el reintento se programó en %v, se esperaba 2m", wait)
+				}
+				if pending[0].Attempts != tt.wantAttempts || pending[0].LastError == "" {
+					t.Errorf("job reprogramado inesperado: %+v", pending[0])
+				}
+				// Antes de su hora el job no se vuelve a intentar
+				if deleted, _ := queue.RunOnce(context.Background()); deleted != 0 || len(saveFiles.RequestsTo("/DeleteFile")) != 1 {
+					t.Error("el job se intentó antes de tiempo")
+				}
+			case tt.wantDead:
+				if dead[0].Attempts != tt.wantAttempts || dead[0].LastError == "" {
+					t.Errorf("job muerto inesperado: %+v", dead[0])
+				}
+			default:
+				if saveFiles.HasFile(path) && tt.responses == nil {
+					t.Error("el archivo no se eliminó")
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryDeletionQueueRunOnceRequiresCredentials(t *testing.T) {
+	saveFiles := fakes.NewSaveFiles()
+	defer saveFiles.Close()
+
+	queue := startedDeletionQueue(t)
+	queue.Enqueue(context.Background(), DeletionJob{FilePath: "Documents/1-a.txt", URLDeleteFile: saveFiles.URL + "/DeleteFile"})
+	queue.Headers = nil
+
+	if _, err := queue.RunOnce(context.Background()); !errors.Is(err, errDeletionQueueNoCredentials) {
+		t.Fatalf("RunOnce = %v, se esperaba errDeletionQueueNoCredentials", err)
+	}
+	if len(saveFiles.Requests()) != 0 || len(queue.Pending()) != 1 {
+		t.Error("sin credenciales no se debe intentar ni descartar ningún job")
+	}
+}
+
+// Un job que está intentando un RunOnce no lo toma otro RunOnce concurrente
+func TestMemoryDeletionQueueRunOnceConcurrent(t *testing.T) {
+	saveFiles := fakes.NewSaveFiles()
+	defer saveFiles.Close()
+	saveFiles.On(http.MethodDelete, "/DeleteFile", fakes.Response{Status: http.StatusNotFound, Delay: 100 * time.Millisecond})
+
+	queue := startedDeletionQueue(t)
+	queue.Enqueue(context.Background(), DeletionJob{FilePath: "Documents/1-a.txt", URLDeleteFile: saveFiles.URL + "/DeleteFile"})
+
+	results := make(chan int, 2)
+	for range 2 {
+		go func() {
+			deleted, _ := queue.RunOnce(context.Background())
+			results <- deleted
+		}()
+	}
+	if total := <-results + <-results; total != 1 {
+		t.Errorf("se eliminaron %d archivos, se esperaba 1", total)
+	}
+	if got := len(saveFiles.RequestsTo("/DeleteFile")); got != 1 {
+		t.Errorf("el job se intentó %d veces, se esperaba 1", got)
+	}
+}
+
+// Los jobs que no se alcanzan a intentar antes de cancelar vuelven a la cola sin contar el intento
+func TestMemoryDeletionQueueRunOnceCanceled(t *testing.T) {
+	saveFiles := fakes.NewSaveFiles()
+	defer saveFiles.Close()
+
+	queue := startedDeletionQueue(t)
+	for _, path := range []string{"Documents/1-a.txt", "Documents/2-b.txt"} {
+		queue.Enqueue(context.Background(), DeletionJob{FilePath: path, URLDeleteFile: saveFiles.URL + "/DeleteFile"})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if deleted, err := queue.RunOnce(ctx); deleted != 0 || err != nil {
+		t.Fatalf("RunOnce = %d, %v", deleted, err)
+	}
+	pending := queue.Pending()
+	if len(pending) != 2 || pending[0].Attempts != 0 || pending[1].Attempts != 0 {
+		t.Errorf("los jobs debían volver a la cola sin intentos: %+v", pending)
+	}
+	if len(saveFiles.Requests()) != 0 {
+		t.Error("con el contexto cancelado no se debe intentar ninguna eliminación")
+	}
+}
+
+func TestMemoryDeletionQueueStart(t *testing.T) {
+	saveFiles := fakes.NewSaveFiles()
+	defer saveFiles.Close()
+	const path = "Documents/1-a.txt"
+	saveFiles.PutFile(path, []byte("huérfano"))
+
+	queue := NewMemoryDeletionQueue()
+	queue.Headers = map[string]string{"X-Service-Key": "clave"}
+	queue.Start(t.Context(), 10*time.Millisecond)
+	if err := queue.Enqueue(context.Background(), DeletionJob{FilePath: path, URLDeleteFile: saveFiles.URL + "/DeleteFile"}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for saveFiles.HasFile(path) || len(queue.Pending()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Start no procesó la cola")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Sin una cola en ejecución las eliminaciones fallidas no se acumulan en DefaultDeletionQueue
+func TestFileUpdateWithoutStartedQueue(t *testing.T) {
+	saveFiles := fakes.NewSaveFiles()
+	defer saveFiles.Close()
+	const oldPath = "Documents/1-viejo.txt"
+	saveFiles.PutFile(oldPath, []byte("viejo"))
+
+	c := newFormContext(t, "file", "nuevo.txt", []byte(testText))
+	update, err := BeginFileUpdate("file", oldPath, saveFiles.URL+"/SaveFiles", saveFiles.URL+"/DeleteFile", c)
+	if err != nil {
+		t.Fatalf("BeginFileUpdate: %v", err)
+	}
+	saveFiles.On(http.MethodDelete, "/DeleteFile", fakes.Response{Status: http.StatusInternalServerError})
+
+	if err := update.Commit(); !errors.Is(err, errDeletionQueueNotStarted) {
+		t.Errorf("Commit = %v, se esperaba el error de la eliminación y errDeletionQueueNotStarted", err)
+	}
+	if len(DefaultDeletionQueue.Pending()) != 0 {
+		t.Error("DefaultDeletionQueue no debe guardar jobs si no está en ejecución")
+	}
+}
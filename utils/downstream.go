@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Nombres de los servicios de Duelig a los que llaman los helpers
+const (
+	serviceUsuarios  = "usuarios"
+	serviceSaveFiles = "savefiles"
+	serviceCD        = "cd"
+	// serviceTus es el servidor tus de TusClient, que puede ser cualquier servicio con TusHandler
+	serviceTus = "tus"
+)
+
+// downstreamClient es el cliente HTTP compartido para las llamadas entre servicios
+var downstreamClient = &http.Client{}
+
+// requestContext obtiene el contexto de la solicitud de Gin, o uno vacío si no existe
+func requestContext(c *gin.Context) context.Context {
+	if c == nil || c.Request == nil {
+		return context.Background()
+	}
+	return c.Request.Context()
+}
+
+// doDownstream ejecuta una solicitud hacia otro servicio de Duelig.
+// service identifica el servicio destino y operation la acción (validate_session, upload...).
+// Las fallas de red se retornan como *UpstreamError.
+func doDownstream(ctx context.Context, service string, operation string, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	req, span := startClientSpan(ctx, service, operation, req)
+	resp, err := downstreamClient.Do(req)
+	endClientSpan(span, resp, err)
+	recordDownstream(service, operation, start, resp, err)
+	if err != nil {
+		return nil, newUpstreamNetworkError(service, req, err)
+	}
+	return resp, nil
+}
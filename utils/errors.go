@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Errores centinela para clasificar las fallas con errors.Is
+var (
+	ErrNotFound            = errors.New("not found")
+	ErrUnauthorized        = errors.New("unauthorized")
+	ErrFileTooLarge        = errors.New("file too large")
+	ErrUnsupportedFileType = errors.New("unsupported file type")
+	ErrTooManyFiles        = errors.New("too many files")
+	ErrUpstreamUnavailable = errors.New("upstream service unavailable")
+	ErrInfected            = errors.New("file infected")
+	ErrScanUnavailable     = errors.New("malware scanner unavailable")
+	ErrUnsafeURL           = errors.New("unsafe url")
+)
+
+// maxUpstreamBodyExcerpt limita cuánto del cuerpo de la respuesta se guarda en el error
+const maxUpstreamBodyExcerpt = 512
+
+// UpstreamError describe una llamada fallida a otro servicio de Duelig.
+// Se puede inspeccionar con errors.As y se clasifica con errors.Is según el status.
+type UpstreamError struct {
+	Service    string
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+	RequestID  string
+	// Err es el error de red cuando no se obtuvo respuesta; en ese caso StatusCode es 0
+	Err error
+}
+
+func (e *UpstreamError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%s %s %s failed: %v", e.Service, e.Method, e.URL, e.Err)
+	}
+	return fmt.Sprintf("%s %s %s: received non-OK HTTP status: %d %s, response: %s",
+		e.Service, e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
+
+// Unwrap expone el error de red y el centinela que corresponde al status
+func (e *UpstreamError) Unwrap() []error {
+	var errs []error
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	if sentinel := sentinelForStatus(e.StatusCode); sentinel != nil {
+		errs = append(errs, sentinel)
+	}
+	return errs
+}
+
+// sentinelForStatus traduce el status de la respuesta al error centinela correspondiente
+func sentinelForStatus(status int) error {
+	switch {
+	case status == 0:
+		return ErrUpstreamUnavailable
+	case status == http.StatusNotFound:
+		return ErrNotFound
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrUnauthorized
+	case status == http.StatusRequestEntityTooLarge:
+		return ErrFileTooLarge
+	case status == http.StatusUnsupportedMediaType:
+		return ErrUnsupportedFileType
+	case status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout:
+		return ErrUpstreamUnavailable
+	}
+	return nil
+}
+
+// HTTPStatusFromError retorna el status HTTP que corresponde al error, para responder a los clientes.
+// Los 5xx de otros servicios retornan 502 y los errores sin clasificar retornan 500.
+func HTTPStatusFromError(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	var upstreamErr *UpstreamError
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrFileTooLarge), errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrInfected):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrUnsupportedFileType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrTooManyFiles), errors.Is(err, ErrUnsafeURL):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrOffsetMismatch):
+		return http.StatusConflict
+	case errors.Is(err, ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrInvalidSignature), errors.Is(err, ErrExpiredURL):
+		return http.StatusForbidden
+	case errors.Is(err, ErrUpstreamUnavailable):
+		return http.StatusBadGateway
+	case errors.Is(err, ErrScanUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &upstreamErr) && upstreamErr.StatusCode >= http.StatusInternalServerError:
+		// Un error interno de otro servicio se informa como falla del gateway, no como un error propio
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// newUpstreamError construye el error a partir de una respuesta no exitosa, leyendo un extracto del cuerpo
+func newUpstreamError(service string, req *http.Request, resp *http.Response) *UpstreamError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxUpstreamBodyExcerpt))
+	return &UpstreamError{
+		Service:    service,
+		Method:     req.Method,
+		URL:        redactURL(req),
+		StatusCode: resp.StatusCode,
+		Body:       strings.TrimSpace(string(body)),
+		RequestID:  req.Header.Get("X-Request-ID"),
+	}
+}
+
+// newUpstreamNetworkError construye el error cuando la llamada no obtuvo respuesta
+func newUpstreamNetworkError(service string, req *http.Request, err error) *UpstreamError {
+	return &UpstreamError{
+		Service:   service,
+		Method:    req.Method,
+		URL:       redactURL(req),
+		RequestID: req.Header.Get("X-Request-ID"),
+		Err:       err,
+	}
+}
+
+// redactURL evita que tokens del query string terminen en los mensajes de error
+func redactURL(req *http.Request) string {
+	u := *req.URL
+	u.RawQuery = RedactQuery(u.RawQuery)
+	return u.String()
+}
@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/edwinrubio/DueligUtils/testhelpers/fakes"
+	"github.com/gin-gonic/gin"
+)
+
+// newRequestContext crea un contexto de gin con una solicitud GET y las cabeceras indicadas
+func newRequestContext(headers map[string]string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	for name, value := range headers {
+		c.Request.Header.Set(name, value)
+	}
+	return c
+}
+
+func TestUpstreamErrorClassification(t *testing.T) {
+	tests := []struct {
+		status       int
+		wantSentinel error
+		wantHTTP     int
+	}{
+		{http.StatusNotFound, ErrNotFound, http.StatusNotFound},
+		{http.StatusUnauthorized, ErrUnauthorized, http.StatusUnauthorized},
+		{http.StatusForbidden, ErrUnauthorized, http.StatusUnauthorized},
+		{http.StatusRequestEntityTooLarge, ErrFileTooLarge, http.StatusRequestEntityTooLarge},
+		{http.StatusUnsupportedMediaType, ErrUnsupportedFileType, http.StatusUnsupportedMediaType},
+		{http.StatusBadGateway, ErrUpstreamUnavailable, http.StatusBadGateway},
+		{http.StatusServiceUnavailable, ErrUpstreamUnavailable, http.StatusBadGateway},
+		{http.StatusGatewayTimeout, ErrUpstreamUnavailable, http.StatusBadGateway},
+		{http.StatusInternalServerError, nil, http.StatusBadGateway},
+		{http.StatusConflict, nil, http.StatusInternalServerError},
+		{http.StatusBadRequest, nil, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			err := fmt.Errorf("contexto: %w", &UpstreamError{Service: serviceSaveFiles, StatusCode: tt.status})
+			if tt.wantSentinel != nil && !errors.Is(err, tt.wantSentinel) {
+				t.Errorf("el error de un %d debe clasificarse como %v", tt.status, tt.wantSentinel)
+			}
+			if got := HTTPStatusFromError(err); got != tt.wantHTTP {
+				t.Errorf("HTTPStatusFromError = %d, se esperaba %d", got, tt.wantHTTP)
+			}
+		})
+	}
+}
+
+func TestHTTPStatusFromError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"sin error", nil, http.StatusOK},
+		{"demasiado grande", ErrFileTooLarge, http.StatusRequestEntityTooLarge},
+		{"MaxBytesError", &http.MaxBytesError{Limit: 10}, http.StatusRequestEntityTooLarge},
+		{"infectado", ErrInfected, http.StatusUnprocessableEntity},
+		{"tipo no soportado envuelto", fmt.Errorf("a.exe: %w", ErrUnsupportedFileType), http.StatusUnsupportedMediaType},
+		{"demasiados archivos", ErrTooManyFiles, http.StatusBadRequest},
+		{"URL insegura", ErrUnsafeURL, http.StatusBadRequest},
+		{"offset", ErrOffsetMismatch, http.StatusConflict},
+		{"firma", ErrInvalidSignature, http.StatusForbidden},
+		{"vencida", ErrExpiredURL, http.StatusForbidden},
+		{"escáner caído", ErrScanUnavailable, http.StatusServiceUnavailable},
+		{"falla de red", &UpstreamError{Err: errors.New("connection refused")}, http.StatusBadGateway},
+		{"sin clasificar", errors.New("x"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTTPStatusFromError(tt.err); got != tt.want {
+				t.Errorf("HTTPStatusFromError(%v) = %d, se esperaba %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewUpstreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte("  " + strings.Repeat("x", 2*maxUpstreamBodyExcerpt)))
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+"/files?file_path=a.pdf&token=secreto", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	upstreamErr := newUpstreamError(serviceSaveFiles, req, resp)
+	if upstreamErr.StatusCode != http.StatusConflict || upstreamErr.Method != http.MethodDelete || upstreamErr.RequestID != "req-1" {
+		t.Errorf("error inesperado: %+v", upstreamErr)
+	}
+	if len(upstreamErr.Body) > maxUpstreamBodyExcerpt {
+		t.Errorf("el cuerpo guardado tiene %d bytes, el máximo es %d", len(upstreamErr.Body), maxUpstreamBodyExcerpt)
+	}
+	if strings.Contains(upstreamErr.Error(), "secreto") || !strings.Contains(upstreamErr.URL, "file_path=a.pdf") {
+		t.Errorf("la URL del error debe redactar solo los secretos: %s", upstreamErr.URL)
+	}
+}
+
+func TestVerifyCDOwnership(t *testing.T) {
+	tests := []struct {
+		name string
+		// scripted reemplaza la respuesta del fake; si es nil responde según los propietarios registrados
+		scripted  *fakes.Response
+		owner     bool
+		closed    bool
+		wantOwner bool
+		// wantFail indica que se espera un *UpstreamError, clasificado como wantErr si no es nil
+		wantFail bool
+		wantErr  error
+		wantHTTP int
+	}{
+		{name: "propietario", owner: true, wantOwner: true},
+		{name: "no es propietario", wantOwner: false},
+		{name: "centro inexistente", scripted: &fakes.Response{Status: http.StatusNotFound}, wantOwner: false},
+		{name: "error interno del servicio", scripted: &fakes.Response{Status: http.StatusInternalServerError}, wantFail: true, wantHTTP: http.StatusBadGateway},
+		{name: "servicio no disponible", scripted: &fakes.Response{Status: http.StatusServiceUnavailable}, wantFail: true, wantErr: ErrUpstreamUnavailable, wantHTTP: http.StatusBadGateway},
+		{name: "sesión rechazada", scripted: &fakes.Response{Status: http.StatusUnauthorized}, wantFail: true, wantErr: ErrUnauthorized, wantHTTP: http.StatusUnauthorized},
+		{name: "servicio caído", closed: true, wantFail: true, wantErr: ErrUpstreamUnavailable, wantHTTP: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cd := fakes.NewCD()
+			defer cd.Close()
+			if tt.owner {
+				cd.SetOwner("cd-1", "user-1")
+			}
+			if tt.scripted != nil {
+				cd.On(http.MethodGet, "/api/v1/cd/verifyownership", *tt.scripted)
+			}
+			if tt.closed {
+				cd.Close()
+			}
+
+			c := newRequestContext(map[string]string{"Authorization": "Bearer t", "X-Request-ID": "req-1"})
+			owner, err := VerifyCDOwnership(cd.URL, "cd-1", "user-1", c)
+			if !tt.wantFail {
+				if err != nil || owner != tt.wantOwner {
+					t.Fatalf("VerifyCDOwnership = %v, %v; se esperaba %v sin error", owner, err, tt.wantOwner)
+				}
+				if got := cd.RequestsTo("/api/v1/cd/verifyownership"); len(got) != 1 || got[0].Header.Get("Authorization") != "Bearer t" {
+					t.Error("la consulta debe llevar las cabeceras de la solicitud")
+				}
+				return
+			}
+
+			if owner {
+				t.Error("con error no puede informarse que es propietario")
+			}
+			var upstreamErr *UpstreamError
+			if !errors.As(err, &upstreamErr) || upstreamErr.Service != serviceCD {
+				t.Fatalf("VerifyCDOwnership = %v, se esperaba un *UpstreamError del servicio cd", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("el error %v debe clasificarse como %v", err, tt.wantErr)
+			}
+			if got := HTTPStatusFromError(err); got != tt.wantHTTP {
+				t.Errorf("HTTPStatusFromError = %d, se esperaba %d", got, tt.wantHTTP)
+			}
+		})
+	}
+}
+
+func TestDeleteFileErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		failNext int
+		wantErr  error
+	}{
+		{name: "eliminado", path: "Documents/1-a.pdf"},
+		{name: "no existe", path: "Documents/2-b.pdf", wantErr: ErrNotFound},
+		{name: "servicio no disponible", path: "Documents/1-a.pdf", failNext: http.StatusServiceUnavailable, wantErr: ErrUpstreamUnavailable},
+		{name: "sin permisos", path: "Documents/1-a.pdf", failNext: http.StatusForbidden, wantErr: ErrUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saveFiles := fakes.NewSaveFiles()
+			defer saveFiles.Close()
+			saveFiles.PutFile("Documents/1-a.pdf", []byte("%PDF-1.7"))
+			if tt.failNext != 0 {
+				saveFiles.FailNext(1, tt.failNext)
+			}
+
+			err := DeleteFile(tt.path, saveFiles.URL+"/DeleteFile", newRequestContext(nil))
+			if tt.wantErr == nil {
+				if err != nil || saveFiles.HasFile(tt.path) {
+					t.Fatalf("DeleteFile = %v", err)
+				}
+				return
+			}
+			var upstreamErr *UpstreamError
+			if !errors.Is(err, tt.wantErr) || !errors.As(err, &upstreamErr) {
+				t.Errorf("DeleteFile = %v, se esperaba un *UpstreamError clasificado como %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,388 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Nombres de los tipos de archivo (Kindfile) que entiende el servicio de archivos
+const (
+	KindImages       = "Images"
+	KindDocuments    = "Documents"
+	KindVideos       = "Videos"
+	KindAudio        = "Audio"
+	KindSpreadsheets = "Spreadsheets"
+)
+
+// MagicSignature reconoce un formato por los primeros bytes del archivo.
+// Se usa Magic en Offset, o Match para firmas que no son un prefijo fijo.
+type MagicSignature struct {
+	// ContentType es el tipo que se reporta cuando la firma coincide
+	ContentType string
+	// Covers son otros Content-Type que esta firma también verifica,
+	// por ejemplo la firma ZIP verifica .docx y .xlsx
+	Covers []string
+	Offset int
+	Magic  []byte
+	Match  func(header []byte) bool
+}
+
+func (s MagicSignature) matches(header []byte) bool {
+	if s.Match != nil {
+		return s.Match(header)
+	}
+	if len(s.Magic) == 0 || len(header) < s.Offset+len(s.Magic) {
+		return false
+	}
+	return bytes.Equal(header[s.Offset:s.Offset+len(s.Magic)], s.Magic)
+}
+
+func (s MagicSignature) verifies(contentType string) bool {
+	if normalizeContentType(s.ContentType) == contentType {
+		return true
+	}
+	for _, covered := range s.Covers {
+		if normalizeContentType(covered) == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// FileKind agrupa las extensiones, tipos MIME y firmas de un Kindfile
+type FileKind struct {
+	Name string
+	// Extensions relaciona cada extensión (con punto) con su Content-Type
+	Extensions map[string]string
+	// MIMETypes son los Content-Type que pertenecen a este tipo, además de los de Extensions
+	MIMETypes []string
+	// Signatures son las firmas con las que se verifica el contenido
+	Signatures []MagicSignature
+}
+
+// FileKindRegistry es el registro de tipos de archivo que usan la detección y la validación de subidas
+type FileKindRegistry struct {
+	mu    sync.RWMutex
+	kinds []FileKind
+}
+
+// NewFileKindRegistry crea un registro con los tipos indicados
+func NewFileKindRegistry(kinds ...FileKind) *FileKindRegistry {
+	r := &FileKindRegistry{}
+	for _, kind := range kinds {
+		if err := r.Register(kind); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// DefaultFileKinds es el registro que usan GetFileKind, SaveFilesAsImage y la detección de contenido
+var DefaultFileKinds = NewFileKindRegistry(defaultFileKinds()...)
+
+// RegisterFileKind agrega un tipo al registro por defecto. Se debe llamar al iniciar el servicio.
+func RegisterFileKind(kind FileKind) error {
+	return DefaultFileKinds.Register(kind)
+}
+
+// Register agrega un tipo de archivo. Si ya existe un tipo con el mismo nombre, se le agregan
+// las extensiones, tipos MIME y firmas. Una extensión no puede pertenecer a dos tipos.
+func (r *FileKindRegistry) Register(kind FileKind) error {
+	if kind.Name == "" {
+		return fmt.Errorf("file kind name is required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	extensions := make(map[string]string, len(kind.Extensions))
+	for ext, contentType := range kind.Extensions {
+		ext = normalizeExtension(ext)
+		for _, existing := range r.kinds {
+			if _, taken := existing.Extensions[ext]; taken && existing.Name != kind.Name {
+				return fmt.Errorf("extension %s already belongs to file kind %s", ext, existing.Name)
+			}
+		}
+		extensions[ext] = normalizeContentType(contentType)
+	}
+
+	for i := range r.kinds {
+		if r.kinds[i].Name != kind.Name {
+			continue
+		}
+		for ext, contentType := range extensions {
+			r.kinds[i].Extensions[ext] = contentType
+		}
+		r.kinds[i].MIMETypes = append(r.kinds[i].MIMETypes, kind.MIMETypes...)
+		r.kinds[i].Signatures = append(r.kinds[i].Signatures, kind.Signatures...)
+		return nil
+	}
+
+	kind.Extensions = extensions
+	kind.MIMETypes = append([]string(nil), kind.MIMETypes...)
+	kind.Signatures = append([]MagicSignature(nil), kind.Signatures...)
+	r.kinds = append(r.kinds, kind)
+	return nil
+}
+
+// Kind retorna el tipo registrado con ese nombre
+func (r *FileKindRegistry) Kind(name string) (FileKind, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, kind := range r.kinds {
+		if kind.Name == name {
+			return kind, true
+		}
+	}
+	return FileKind{}, false
+}
+
+// KindForExtension retorna el nombre del tipo al que pertenece la extensión del archivo, o ""
+func (r *FileKindRegistry) KindForExtension(filename string) string {
+	ext := normalizeExtension(filepath.Ext(filename))
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, kind := range r.kinds {
+		if _, exists := kind.Extensions[ext]; exists {
+			return kind.Name
+		}
+	}
+	return ""
+}
+
+// KindForContentType retorna el nombre del tipo al que pertenece el Content-Type, o ""
+func (r *FileKindRegistry) KindForContentType(contentType string) string {
+	contentType = normalizeContentType(contentType)
+	if contentType == "" {
+		return ""
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, kind := range r.kinds {
+		for _, mimeType := range kind.MIMETypes {
+			if normalizeContentType(mimeType) == contentType {
+				return kind.Name
+			}
+		}
+		for _, extType := range kind.Extensions {
+			if extType == contentType {
+				return kind.Name
+			}
+		}
+	}
+	return ""
+}
+
+// ContentTypeForExtension retorna el Content-Type de la extensión del archivo, o "" si no está registrada
+func (r *FileKindRegistry) ContentTypeForExtension(filename string) string {
+	ext := normalizeExtension(filepath.Ext(filename))
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, kind := range r.kinds {
+		if contentType, exists := kind.Extensions[ext]; exists {
+			return contentType
+		}
+	}
+	return ""
+}
+
+// Detect retorna el Content-Type de la primera firma que coincide con el inicio del archivo, o ""
+func (r *FileKindRegistry) Detect(header []byte) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, kind := range r.kinds {
+		for _, signature := range kind.Signatures {
+			if signature.matches(header) {
+				return normalizeContentType(signature.ContentType)
+			}
+		}
+	}
+	return ""
+}
+
+// CanVerify indica si hay alguna firma registrada que verifique el Content-Type
+func (r *FileKindRegistry) CanVerify(contentType string) bool {
+	contentType = normalizeContentType(contentType)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, kind := range r.kinds {
+		for _, signature := range kind.Signatures {
+			if signature.verifies(contentType) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Verify indica si el inicio del archivo coincide con alguna firma del Content-Type
+func (r *FileKindRegistry) Verify(header []byte, contentType string) bool {
+	contentType = normalizeContentType(contentType)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, kind := range r.kinds {
+		for _, signature := range kind.Signatures {
+			if signature.verifies(contentType) && signature.matches(header) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+func normalizeContentType(contentType string) string {
+	return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+}
+
+///////////////////////////////////////////////////////////////
+//				Tipos de archivo por defecto
+///////////////////////////////////////////////////////////////
+
+func defaultFileKinds() []FileKind {
+	zipSignature := []byte("PK\x03\x04")
+	oleSignature := []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1")
+
+	return []FileKind{
+		{
+			Name: KindImages,
+			Extensions: map[string]string{
+				".jpg":  "image/jpeg",
+				".jpeg": "image/jpeg",
+				".png":  "image/png",
+				".gif":  "image/gif",
+				".webp": "image/webp",
+				".svg":  "image/svg+xml",
+				".bmp":  "image/bmp",
+				".ico":  "image/x-icon",
+				".tiff": "image/tiff",
+				".tif":  "image/tiff",
+				".heic": "image/heic",
+				".heif": "image/heif",
+			},
+			MIMETypes: []string{"image/jpg", "image/vnd.microsoft.icon"},
+			Signatures: []MagicSignature{
+				{ContentType: "image/jpeg", Covers: []string{"image/jpg"}, Magic: []byte("\xFF\xD8\xFF")},
+				{ContentType: "image/png", Magic: []byte("\x89PNG\r\n\x1A\n")},
+				{ContentType: "image/gif", Magic: []byte("GIF87a")},
+				{ContentType: "image/gif", Magic: []byte("GIF89a")},
+				{ContentType: "image/webp", Match: riffForm("WEBP")},
+				{ContentType: "image/heic", Covers: []string{"image/heif"}, Match: isoBrand("heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1", "heif")},
+				{ContentType: "image/tiff", Magic: []byte("II*\x00")},
+				{ContentType: "image/tiff", Magic: []byte("MM\x00*")},
+				{ContentType: "image/bmp", Magic: []byte("BM")},
+				{ContentType: "image/x-icon", Covers: []string{"image/vnd.microsoft.icon"}, Magic: []byte("\x00\x00\x01\x00")},
+				{ContentType: "image/svg+xml", Match: isSVG},
+			},
+		},
+		{
+			Name: KindDocuments,
+			Extensions: map[string]string{
+				".pdf":  "application/pdf",
+				".doc":  "application/msword",
+				".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+				".odt":  "application/vnd.oasis.opendocument.text",
+				".txt":  "text/plain",
+			},
+			Signatures: []MagicSignature{
+				{ContentType: "application/pdf", Magic: []byte("%PDF-")},
+				{ContentType: "application/msword", Magic: oleSignature},
+				{
+					ContentType: "application/zip",
+					Covers: []string{
+						"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+						"application/vnd.oasis.opendocument.text",
+					},
+					Magic: zipSignature,
+				},
+			},
+		},
+		{
+			Name: KindSpreadsheets,
+			Extensions: map[string]string{
+				".xls":  "application/vnd.ms-excel",
+				".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+				".ods":  "application/vnd.oasis.opendocument.spreadsheet",
+				".csv":  "text/csv",
+			},
+			Signatures: []MagicSignature{
+				{ContentType: "application/vnd.ms-excel", Magic: oleSignature},
+				{
+					ContentType: "application/zip",
+					Covers: []string{
+						"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+						"application/vnd.oasis.opendocument.spreadsheet",
+					},
+					Magic: zipSignature,
+				},
+			},
+		},
+		{
+			Name: KindVideos,
+			Extensions: map[string]string{
+				".mp4":  "video/mp4",
+				".m4v":  "video/x-m4v",
+				".mov":  "video/quicktime",
+				".webm": "video/webm",
+				".avi":  "video/x-msvideo",
+				".3gp":  "video/3gpp",
+			},
+			Signatures: []MagicSignature{
+				{ContentType: "video/mp4", Covers: []string{"video/x-m4v"}, Match: isoBrand("isom", "iso2", "iso4", "iso5", "iso6", "mp41", "mp42", "avc1", "dash", "M4V ", "M4VH", "M4VP")},
+				{ContentType: "video/quicktime", Match: isoBrand("qt  ")},
+				{ContentType: "video/3gpp", Match: isoBrand("3gp4", "3gp5", "3gp6", "3gg6")},
+				{ContentType: "video/webm", Magic: []byte("\x1A\x45\xDF\xA3")},
+				{ContentType: "video/x-msvideo", Match: riffForm("AVI ")},
+			},
+		},
+		{
+			Name: KindAudio,
+			Extensions: map[string]string{
+				".mp3":  "audio/mpeg",
+				".m4a":  "audio/mp4",
+				".aac":  "audio/aac",
+				".wav":  "audio/wav",
+				".ogg":  "audio/ogg",
+				".flac": "audio/flac",
+			},
+			MIMETypes: []string{"audio/x-wav", "audio/mp3"},
+			Signatures: []MagicSignature{
+				{ContentType: "audio/mpeg", Covers: []string{"audio/mp3"}, Magic: []byte("ID3")},
+				{ContentType: "audio/mpeg", Covers: []string{"audio/mp3"}, Match: mpegAudioFrame},
+				{ContentType: "audio/mp4", Match: isoBrand("M4A ", "M4B ")},
+				{ContentType: "audio/aac", Match: adtsFrame},
+				{ContentType: "audio/wav", Covers: []string{"audio/x-wav"}, Match: riffForm("WAVE")},
+				{ContentType: "audio/ogg", Magic: []byte("OggS")},
+				{ContentType: "audio/flac", Magic: []byte("fLaC")},
+			},
+		},
+	}
+}
+
+// riffForm reconoce los contenedores RIFF (WebP, WAV, AVI) por su tipo de formulario
+func riffForm(form string) func([]byte) bool {
+	return func(header []byte) bool {
+		return len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == form
+	}
+}
+
+// mpegAudioFrame reconoce un MP3 sin etiqueta ID3 por la cabecera de su primer frame
+func mpegAudioFrame(header []byte) bool {
+	return len(header) >= 2 && header[0] == 0xFF && header[1]&0xE6 == 0xE2
+}
+
+// adtsFrame reconoce el AAC en formato ADTS
+func adtsFrame(header []byte) bool {
+	return len(header) >= 2 && header[0] == 0xFF && header[1]&0xF6 == 0xF0
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsSVG(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{"raíz svg", `<svg xmlns="http://www.w3.org/2000/svg"/>`, true},
+		{"raíz sin atributos", `<svg>`, true},
+		{"con prefijo de namespace", `<svg:svg xmlns:svg="http://www.w3.org/2000/svg"/>`, true},
+		{"declaración XML y BOM", "\xEF\xBB\xBF<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<svg/>", true},
+		{"comentarios", "<!-- Generator: Adobe Illustrator --><!-- <html> -->\n<svg/>", true},
+		{"doctype", `<?xml version="1.0"?><!DOCTYPE svg PUBLIC "-//W3C//DTD SVG 1.1//EN" "http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd"><svg/>`, true},
+		{"doctype con subconjunto interno", `<!DOCTYPE svg [<!ENTITY x "a>b">]><svg>&x;</svg>`, true},
+		{"instrucción de procesamiento", `<?xml-stylesheet href="a.css"?><svg/>`, true},
+		{"html con svg embebido", `<html><body><svg xmlns="http://www.w3.org/2000/svg"/></body></html>`, false},
+		{"doctype html", `<!DOCTYPE html><svg/>`, true},
+		{"otro XML con svg dentro", `<?xml version="1.0"?><feed><svg/></feed>`, false},
+		{"svg en un comentario", `<!-- <svg> --><html/>`, false},
+		{"elemento que empieza con svg", `<svgfoo/>`, false},
+		{"texto antes de la raíz", `hola <svg/>`, false},
+		{"comentario sin cerrar", `<!-- ` + strings.Repeat("x", 100), false},
+		{"doctype sin cerrar", `<!DOCTYPE svg [<!ENTITY x "y">`, false},
+		{"vacío", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isSVG([]byte(tt.header)); got != tt.want {
+				t.Errorf("isSVG(%q) = %v, se esperaba %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetFileKind(t *testing.T) {
+	tests := []struct {
+		contentType string
+		filename    string
+		want        string
+	}{
+		{"image/jpeg", "foto.jpg", KindImages},
+		{"image/heic", "IMG_0001.HEIC", KindImages},
+		{"image/svg+xml", "notas.txt", KindImages},
+		{"application/pdf", "foto.jpg", KindDocuments},
+		{"text/plain; charset=utf-8", "notas.txt", KindDocuments},
+		{"video/mp4", "clip.mp4", KindVideos},
+		{"audio/mpeg", "himno.mp3", KindAudio},
+		{"", "tabla.xlsx", KindSpreadsheets},
+		{"", "foto.PNG", KindImages},
+		{"", "programa.exe", ""},
+		{"application/x-msdownload", "programa.jpg", ""},
+	}
+	for _, tt := range tests {
+		if got := GetFileKind(tt.contentType, tt.filename); got != tt.want {
+			t.Errorf("GetFileKind(%q, %q) = %q, se esperaba %q", tt.contentType, tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestFileKindRegistryRegister(t *testing.T) {
+	registry := NewFileKindRegistry(defaultFileKinds()...)
+
+	models := FileKind{
+		Name:       "Models",
+		Extensions: map[string]string{"GLB": "model/gltf-binary"},
+		Signatures: []MagicSignature{{ContentType: "model/gltf-binary", Magic: []byte("glTF")}},
+	}
+	if err := registry.Register(models); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if got := registry.KindForExtension("cancha.glb"); got != "Models" {
+		t.Errorf("KindForExtension = %q, se esperaba Models", got)
+	}
+	if got := registry.Detect([]byte("glTF\x02\x00\x00\x00")); got != "model/gltf-binary" {
+		t.Errorf("Detect = %q", got)
+	}
+	if !registry.CanVerify("model/gltf-binary") || registry.Verify([]byte("PK\x03\x04"), "model/gltf-binary") {
+		t.Error("la firma registrada debe verificar el contenido")
+	}
+
+	// Registrar de nuevo un tipo existente le agrega extensiones
+	if err := registry.Register(FileKind{Name: KindImages, Extensions: map[string]string{".jxl": "image/jxl"}}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if got := registry.ContentTypeForExtension("a.jxl"); got != "image/jxl" || registry.KindForExtension("a.jpg") != KindImages {
+		t.Errorf("la extensión agregada no se registró en Images: %q", got)
+	}
+
+	if err := registry.Register(FileKind{Name: "Otro", Extensions: map[string]string{"jpg": "image/jpeg"}}); err == nil {
+		t.Error("una extensión no puede pertenecer a dos tipos")
+	}
+	if err := registry.Register(FileKind{}); err == nil {
+		t.Error("el nombre del tipo es obligatorio")
+	}
+	if DefaultFileKinds.KindForExtension("cancha.glb") != "" {
+		t.Error("registrar en otro registro no debe cambiar DefaultFileKinds")
+	}
+}
@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrFileUpdateDone indica que la actualización ya se confirmó o se revirtió
+var ErrFileUpdateDone = errors.New("file update already committed or rolled back")
+
+// FileUpdate es una actualización de archivo en dos fases: el archivo nuevo ya está guardado y
+// el viejo se elimina solo con Commit. Si la operación del servicio falla (por ejemplo la
+// actualización en Mongo), Rollback elimina el nuevo y el viejo queda intacto.
+//
+//	update, err := utils.BeginFileUpdate("foto", perfil.Foto, urlSave, urlDelete, c)
+//	if err != nil { ... }
+//	defer update.Rollback()
+//	if err := guardarPerfil(ctx, update.NewPath); err != nil { ... }
+//	update.Commit()
+type FileUpdate struct {
+	NewPath string
+	OldPath string
+	SHA256  string
+
+	urlDeleteFile string
+	deduplicated  bool
+	cfg           *uploadConfig
+	c             *gin.Context
+
+	mu   sync.Mutex
+	done bool
+}
+
+// BeginFileUpdate guarda el nuevo archivo del campo FileNameHeader y retorna la actualización pendiente.
+// Acepta las mismas opciones que SaveFiles, además de WithDeletionQueue.
+func BeginFileUpdate(FileNameHeader string, oldFilePath string, urlSaveFile string, urlDeleteFile string, g *gin.Context, opts ...UploadOption) (*FileUpdate, error) {
+	Logger(g).Debug("Guardando nuevo archivo", "field", FileNameHeader)
+	result, err := SaveFilesWithResult(urlSaveFile, g, FileNameHeader, opts...)
+	if err != nil {
+		Logger(g).Error("Error al guardar el nuevo archivo", "error", err)
+		return nil, fmt.Errorf("error al guardar el nuevo archivo: %w", err)
+	}
+	Logger(g).Info("Nuevo archivo guardado", "file_path", result.Path)
+
+	return &FileUpdate{
+		NewPath:       result.Path,
+		OldPath:       oldFilePath,
+		SHA256:        result.SHA256,
+		urlDeleteFile: urlDeleteFile,
+		deduplicated:  result.Deduplicated,
+		cfg:           newUploadConfig(g, opts),
+		c:             g,
+	}, nil
+}
+
+// Commit confirma la actualización eliminando el archivo viejo. Si la eliminación falla se encola
+// para reintentarla y Commit retorna nil; solo retorna error si tampoco se pudo encolar.
+func (u *FileUpdate) Commit() error {
+	if err := u.finish(); err != nil {
+		return err
+	}
+	// Con deduplicación el archivo nuevo puede ser el mismo viejo, y ese no se elimina
+	if u.OldPath == "" || u.OldPath == u.NewPath {
+		return nil
+	}
+	_, err := deleteOrEnqueue(u.OldPath, u.urlDeleteFile, "commit", u.cfg, u.c)
+	return err
+}
+
+// Rollback revierte la actualización eliminando el archivo nuevo; el viejo no se toca.
+// Igual que Commit, si la eliminación falla se encola para reintentarla.
+// Después de Commit retorna ErrFileUpdateDone, así que se puede usar con defer.
+func (u *FileUpdate) Rollback() error {
+	if err := u.finish(); err != nil {
+		return err
+	}
+	// Un archivo deduplicado ya existía antes de esta actualización y otros lo pueden estar usando
+	if u.deduplicated || u.NewPath == u.OldPath {
+		return nil
+	}
+	_, err := deleteOrEnqueue(u.NewPath, u.urlDeleteFile, "rollback", u.cfg, u.c)
+	return err
+}
+
+// finish marca la actualización como terminada, o retorna ErrFileUpdateDone si ya lo estaba
+func (u *FileUpdate) finish() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.done {
+		return ErrFileUpdateDone
+	}
+	u.done = true
+	return nil
+}
+
+// deleteOrEnqueue elimina el archivo y, si falla, lo deja en la cola de reintentos de cfg.
+// Retorna true si se eliminó; el error solo es distinto de nil si tampoco se pudo encolar.
+func deleteOrEnqueue(path string, urlDeleteFile string, reason string, cfg *uploadConfig, c *gin.Context) (bool, error) {
+	// La ruta deja de ser válida para deduplicación aunque la eliminación quede pendiente
+	defer forgetDeduplicated(path, cfg, c)
+
+	err := DeleteFile(path, urlDeleteFile, c)
+	if err == nil || errors.Is(err, ErrNotFound) {
+		Logger(c).Info("Archivo eliminado", "file_path", path, "reason", reason)
+		return true, nil
+	}
+
+	job := DeletionJob{
+		FilePath:      path,
+		URLDeleteFile: urlDeleteFile,
+		Headers:       deletionJobHeaders(c),
+		Reason:        reason,
+		Attempts:      1,
+		LastError:     err.Error(),
+	}
+	if queueErr := cfg.deletionQueue.Enqueue(requestContext(c), job); queueErr != nil {
+		Logger(c).Error("No se pudo eliminar el archivo ni encolar el reintento", "file_path", path, "reason", reason, "error", err, "queue_error", queueErr)
+		return false, fmt.Errorf("error al eliminar %s: %w", path, errors.Join(err, queueErr))
+	}
+	Logger(c).Warn("No se pudo eliminar el archivo, se encoló para reintentar", "file_path", path, "reason", reason, "error", err)
+	return false, nil
+}
@@ -0,0 +1,257 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/edwinrubio/DueligUtils/testhelpers/fakes"
+)
+
+// failingDedupeStore es un almacén que no responde, para verificar que la subida sigue sin él
+type failingDedupeStore struct{ *MemoryDedupeStore }
+
+func (*failingDedupeStore) Lookup(context.Context, string) (string, bool, error) {
+	return "", false, errors.New("almacén caído")
+}
+
+func TestSaveFilesDedupe(t *testing.T) {
+	const other = "otro,contenido\n3,4\n"
+	tests := []struct {
+		name string
+		// first y second son el contenido y el scope de cada subida
+		first, second           string
+		firstScope, secondScope string
+		store                   DedupeStore
+		wantDeduplicated        bool
+	}{
+		{name: "mismo contenido y scope", first: testText, second: testText, firstScope: "user-1", secondScope: "user-1", wantDeduplicated: true},
+		{name: "otro scope", first: testText, second: testText, firstScope: "user-1", secondScope: "user-2"},
+		{name: "otro contenido", first: testText, second: other, firstScope: "user-1", secondScope: "user-1"},
+		{name: "almacén caído", first: testText, second: testText, firstScope: "user-1", secondScope: "user-1", store: &failingDedupeStore{NewMemoryDedupeStore()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saveFiles := fakes.NewSaveFiles()
+			defer saveFiles.Close()
+			store := tt.store
+			if store == nil {
+				store = NewMemoryDedupeStore()
+			}
+			url := saveFiles.URL + "/SaveFiles"
+
+			first, err := SaveFilesWithResult(url, newFormContext(t, "file", "a.txt", []byte(tt.first)), "file", WithDedupe(store, tt.firstScope))
+			if err != nil || first.Deduplicated {
+				t.Fatalf("primera subida = %+v, %v", first, err)
+			}
+			second, err := SaveFilesWithResult(url, newFormContext(t, "file", "b.txt", []byte(tt.second)), "file", WithDedupe(store, tt.secondScope))
+			if err != nil {
+				t.Fatalf("segunda subida: %v", err)
+			}
+
+			sum := sha256.Sum256([]byte(tt.second))
+			if second.SHA256 != hex.EncodeToString(sum[:]) {
+				t.Errorf("SHA256 = %s, se esperaba el del contenido", second.SHA256)
+			}
+			if second.Deduplicated != tt.wantDeduplicated || (second.Path == first.Path) != tt.wantDeduplicated {
+				t.Errorf("segunda subida = %+v, primera en %s; se esperaba deduplicar: %v", second, first.Path, tt.wantDeduplicated)
+			}
+			wantUploads := 2
+			if tt.wantDeduplicated {
+				wantUploads = 1
+			}
+			if got := len(saveFiles.RequestsTo("/SaveFiles")); got != wantUploads {
+				t.Errorf("se enviaron %d archivos, se esperaban %d", got, wantUploads)
+			}
+		})
+	}
+}
+
+func TestSaveFilesDedupeRequiresScope(t *testing.T) {
+	saveFiles := fakes.NewSaveFiles()
+	defer saveFiles.Close()
+
+	c := newFormContext(t, "file", "a.txt", []byte(testText))
+	if _, err := SaveFiles(saveFiles.URL+"/SaveFiles", c, "file", WithDedupe(NewMemoryDedupeStore(), "")); !errors.Is(err, errDedupeScopeRequired) {
+		t.Fatalf("SaveFiles = %v, se esperaba errDedupeScopeRequired", err)
+	}
+	if len(saveFiles.Requests()) != 0 {
+		t.Error("sin scope no se debe enviar el archivo")
+	}
+}
+
+func TestFileUpdate(t *testing.T) {
+	const oldPath = "Documents/1-viejo.txt"
+	tests := []struct {
+		name string
+		// finish confirma o revierte la actualización y retorna el error de la segunda llamada
+		finish     func(u *FileUpdate) error
+		wantSecond error
+		wantNew    bool
+		wantOld    bool
+	}{
+		{
+			name:   "commit elimina el viejo",
+			finish: func(u *FileUpdate) error { u.Commit(); return u.Rollback() },
+			// Rollback después de Commit no elimina el nuevo, así se puede usar con defer
+			wantSecond: ErrFileUpdateDone, wantNew: true,
+		},
+		{
+			name:       "rollback elimina el nuevo",
+			finish:     func(u *FileUpdate) error { u.Rollback(); return u.Commit() },
+			wantSecond: ErrFileUpdateDone, wantOld: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saveFiles := fakes.NewSaveFiles()
+			defer saveFiles.Close()
+			saveFiles.PutFile(oldPath, []byte("viejo"))
+
+			c := newFormContext(t, "file", "nuevo.txt", []byte(testText))
+			update, err := BeginFileUpdate("file", oldPath, saveFiles.URL+"/SaveFiles", saveFiles.URL+"/DeleteFile", c)
+			if err != nil {
+				t.Fatalf("BeginFileUpdate: %v", err)
+			}
+			if !saveFiles.HasFile(update.NewPath) || !saveFiles.HasFile(oldPath) {
+				t.Fatal("antes de confirmar deben existir los dos archivos")
+			}
+
+			if err := tt.finish(update); !errors.Is(err, tt.wantSecond) {
+				t.Errorf("segunda llamada = %v, se esperaba %v", err, tt.wantSecond)
+			}
+			if saveFiles.HasFile(update.NewPath) != tt.wantNew || saveFiles.HasFile(oldPath) != tt.wantOld {
+				t.Errorf("nuevo existe: %v, viejo existe: %v; se esperaba %v y %v",
+					saveFiles.HasFile(update.NewPath), saveFiles.HasFile(oldPath), tt.wantNew, tt.wantOld)
+			}
+			if got := len(saveFiles.RequestsTo("/DeleteFile")); got != 1 {
+				t.Errorf("se hicieron %d eliminaciones, se esperaba 1", got)
+			}
+		})
+	}
+}
+
+// Con deduplicación el archivo nuevo puede ser el mismo viejo o uno que ya usa otro registro,
+// y ninguno de los dos se elimina
+func TestFileUpdateDeduplicated(t *testing.T) {
+	tests := []struct {
+		name string
+		// sameAsOld indica si el contenido ya guardado es el del archivo viejo
+		sameAsOld bool
+		rollback  bool
+	}{
+		{name: "mismo archivo, commit", sameAsOld: true},
+		{name: "mismo archivo, rollback", sameAsOld: true, rollback: true},
+		{name: "archivo de otro registro, rollback", rollback: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saveFiles := fakes.NewSaveFiles()
+			defer saveFiles.Close()
+			store := NewMemoryDedupeStore()
+			urlSave, urlDelete := saveFiles.URL+"/SaveFiles", saveFiles.URL+"/DeleteFile"
+
+			existing, err := SaveFilesWithResult(urlSave, newFormContext(t, "file", "a.txt", []byte(testText)), "file", WithDedupe(store, "user-1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			oldPath := "Documents/99-viejo.txt"
+			if tt.sameAsOld {
+				oldPath = existing.Path
+			} else {
+				saveFiles.PutFile(oldPath, []byte("viejo"))
+			}
+
+			c := newFormContext(t, "file", "b.txt", []byte(testText))
+			update, err := BeginFileUpdate("file", oldPath, urlSave, urlDelete, c, WithDedupe(store, "user-1"))
+			if err != nil {
+				t.Fatalf("BeginFileUpdate: %v", err)
+			}
+			if update.NewPath != existing.Path {
+				t.Fatalf("NewPath = %s, se esperaba la ruta deduplicada %s", update.NewPath, existing.Path)
+			}
+
+			if tt.rollback {
+				err = update.Rollback()
+			} else {
+				err = update.Commit()
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !saveFiles.HasFile(existing.Path) || !saveFiles.HasFile(oldPath) {
+				t.Error("no se debe eliminar ningún archivo")
+			}
+			if got := len(saveFiles.RequestsTo("/DeleteFile")); got != 0 {
+				t.Errorf("se hicieron %d eliminaciones, no se esperaba ninguna", got)
+			}
+		})
+	}
+}
+
+// Si el archivo viejo no se puede eliminar, Commit lo encola y la ruta deja de usarse para deduplicar
+func TestFileUpdateCommitQueuesFailedDeletion(t *testing.T) {
+	saveFiles := fakes.NewSaveFiles()
+	defer saveFiles.Close()
+	store := NewMemoryDedupeStore()
+	queue := startedDeletionQueue(t)
+	urlSave, urlDelete := saveFiles.URL+"/SaveFiles", saveFiles.URL+"/DeleteFile"
+
+	old, err := SaveFilesWithResult(urlSave, newFormContext(t, "file", "viejo.txt", []byte("viejo")), "file", WithDedupe(store, "user-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newMultiFormContext(t, map[string]string{"Authorization": "Bearer usuario", "X-Request-ID": "req-1"},
+		formFile{"file", "nuevo.txt", testText})
+	update, err := BeginFileUpdate("file", old.Path, urlSave, urlDelete, c, WithDedupe(store, "user-1"), WithDeletionQueue(queue))
+	if err != nil {
+		t.Fatalf("BeginFileUpdate: %v", err)
+	}
+	saveFiles.On(http.MethodDelete, "/DeleteFile", fakes.Response{Status: http.StatusInternalServerError})
+
+	if err := update.Commit(); err != nil {
+		t.Fatalf("Commit = %v, se esperaba nil al encolar la eliminación", err)
+	}
+	pending := queue.Pending()
+	if len(pending) != 1 || pending[0].FilePath != old.Path || pending[0].Reason != "commit" || pending[0].Attempts != 1 {
+		t.Fatalf("se esperaba %s en la cola, hay %+v", old.Path, pending)
+	}
+	if _, leaked := pending[0].Headers["Authorization"]; leaked || pending[0].Headers["X-Request-ID"] != "req-1" {
+		t.Errorf("cabeceras del job inesperadas: %v", pending[0].Headers)
+	}
+
+	// El mismo contenido ya no se resuelve con la ruta que se está eliminando
+	again, err := SaveFilesWithResult(urlSave, newFormContext(t, "file", "viejo.txt", []byte("viejo")), "file", WithDedupe(store, "user-1"))
+	if err != nil || again.Deduplicated {
+		t.Errorf("la ruta eliminada se reutilizó: %+v, %v", again, err)
+	}
+}
+
+func TestUpdateFile(t *testing.T) {
+	saveFiles := fakes.NewSaveFiles()
+	defer saveFiles.Close()
+	const oldPath = "Documents/1-viejo.txt"
+	saveFiles.PutFile(oldPath, []byte("viejo"))
+
+	c := newFormContext(t, "file", "nuevo.txt", []byte(testText))
+	newPath, err := UpdateFile("file", oldPath, saveFiles.URL+"/SaveFiles", saveFiles.URL+"/DeleteFile", c)
+	if err != nil {
+		t.Fatalf("UpdateFile: %v", err)
+	}
+	if !saveFiles.HasFile(newPath) || saveFiles.HasFile(oldPath) {
+		t.Error("UpdateFile debe guardar el nuevo y eliminar el viejo")
+	}
+
+	// Si el nuevo no se guarda, el viejo queda intacto
+	saveFiles.FailNext(1, http.StatusBadRequest)
+	if _, err := UpdateFile("file", newPath, saveFiles.URL+"/SaveFiles", saveFiles.URL+"/DeleteFile", newFormContext(t, "file", "otro.txt", []byte(testText))); err == nil {
+		t.Fatal("se esperaba un error al guardar")
+	}
+	if !saveFiles.HasFile(newPath) {
+		t.Error("el archivo anterior no se debe eliminar si falla la subida")
+	}
+}
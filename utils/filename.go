@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxFilenameBytes es el largo máximo, en bytes UTF-8, de los nombres que se envían al servicio de archivos
+const MaxFilenameBytes = 200
+
+// defaultFilename reemplaza los nombres que quedan vacíos después de limpiarlos
+const defaultFilename = "archivo"
+
+// filenameReplacer cambia los caracteres reservados en sistemas de archivos y cabeceras por guion bajo
+var filenameReplacer = strings.NewReplacer(
+	`"`, "_", `'`, "_", "<", "_", ">", "_", ":", "_", "|", "_", "?", "_", "*", "_", ";", "_",
+)
+
+// SanitizeFilename limpia el nombre de un archivo recibido del cliente:
+//   - Normaliza a Unicode NFC, así "ñ" o "á" escritos con tilde combinable quedan como un solo carácter
+//     y se conservan (Cancha Ñuñoa.jpg sigue siendo Cancha Ñuñoa.jpg).
+//   - Quita las carpetas ("../../etc/passwd" o "C:\fotos\a.jpg").
+//   - Elimina caracteres de control y de formato (CR, LF, NUL, marcas de dirección como U+202E).
+//   - Reemplaza comillas y caracteres reservados por "_" y colapsa los espacios.
+//   - Recorta a MaxFilenameBytes conservando la extensión y sin partir caracteres.
+func SanitizeFilename(name string) string {
+	name = norm.NFC.String(name)
+
+	// Quitar carpetas con cualquiera de los dos separadores
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == utf8.RuneError, unicode.IsControl(r), unicode.Is(unicode.Cf, r):
+			return -1
+		case unicode.IsSpace(r):
+			return ' '
+		}
+		return r
+	}, name)
+	name = filenameReplacer.Replace(name)
+	name = strings.Join(strings.Fields(name), " ")
+
+	// Los puntos y espacios al inicio o al final ocultan el archivo o confunden la extensión
+	name = strings.TrimRight(name, ". ")
+
+	ext := filepath.Ext(name)
+	base := strings.Trim(strings.TrimSuffix(name, ext), ". ")
+	if len(ext) > MaxFilenameBytes/4 {
+		// Una "extensión" tan larga es parte del nombre
+		base, ext = name, ""
+	}
+	if base == "" {
+		base = defaultFilename
+	}
+
+	return truncateUTF8(base, MaxFilenameBytes-len(ext)) + ext
+}
+
+// GenerateFilename crea un nombre aleatorio que conserva la extensión del original, en minúsculas
+func GenerateFilename(original string) string {
+	ext := strings.ToLower(filepath.Ext(SanitizeFilename(original)))
+	return uuid.NewString() + ext
+}
+
+// truncateUTF8 recorta s a lo sumo a n bytes sin partir un carácter
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return strings.TrimRight(s[:n], ". ")
+}
+
+// formDataParamEscaper escapa los valores de name y filename en Content-Disposition según RFC 7578
+// (sección 4.2) y el algoritmo de HTML: comillas, CR y LF se codifican con porcentaje
+var formDataParamEscaper = strings.NewReplacer(`"`, "%22", "\r", "%0D", "\n", "%0A")
+
+func escapeFormDataParam(value string) string {
+	return formDataParamEscaper.Replace(value)
+}
+
+// uploadFilename es el nombre con el que se envía el archivo: generado con WithGeneratedFilenames
+// o el original limpio con SanitizeFilename
+func (cfg *uploadConfig) uploadFilename(original string) string {
+	if cfg.generateNames {
+		return GenerateFilename(original)
+	}
+	return SanitizeFilename(original)
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/edwinrubio/DueligUtils/testhelpers/fakes"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"normaliza a NFC", "Cancha N\u0303un\u0303oa.jpg", "Cancha Ñuñoa.jpg"},
+		{"ruta relativa", "../../etc/passwd", "passwd"},
+		{"ruta de Windows", `C:\fotos\a.jpg`, "a.jpg"},
+		{"CR y LF", "a\r\nb.jpg", "ab.jpg"},
+		{"NUL", "a\x00.jpg", "a.jpg"},
+		{"marca de dirección", "foto\u202Egpj.exe", "fotogpj.exe"},
+		{"comillas y reservados", `a"b;c'd<e>f:g|h?i*.pdf`, "a_b_c_d_e_f_g_h_i_.pdf"},
+		{"espacios repetidos", "  muchos   espacios  .pdf", "muchos espacios.pdf"},
+		{"espacio unicode", "acta\u00A0final.pdf", "acta final.pdf"},
+		{"puntos al final", "nombre...", "nombre"},
+		{"solo extensión", ".htaccess", "archivo.htaccess"},
+		{"solo puntos", "...", "archivo"},
+		{"vacío", "", "archivo"},
+		{"UTF-8 inválido", "a\xff\xfeb.txt", "ab.txt"},
+		{"extensión demasiado larga", "a." + strings.Repeat("x", 60), "a." + strings.Repeat("x", 60)},
+		{"largo sin partir caracteres", strings.Repeat("ñ", 150) + ".jpg", strings.Repeat("ñ", 98) + ".jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SanitizeFilename(tt.in)
+			if got != tt.want {
+				t.Errorf("SanitizeFilename(%q) = %q, se esperaba %q", tt.in, got, tt.want)
+			}
+			if len(got) > MaxFilenameBytes {
+				t.Errorf("el nombre mide %d bytes, el máximo es %d", len(got), MaxFilenameBytes)
+			}
+			if SanitizeFilename(got) != got {
+				t.Errorf("limpiar de nuevo %q cambia el nombre", got)
+			}
+		})
+	}
+}
+
+func TestGenerateFilename(t *testing.T) {
+	uuidName := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+	tests := []struct {
+		original string
+		wantExt  string
+	}{
+		{"Foto.JPG", ".jpg"},
+		{"informe final.pdf", ".pdf"},
+		{"../../sin_extension", ""},
+		{"a.pdf\r\n", ".pdf"},
+	}
+	for _, tt := range tests {
+		got := GenerateFilename(tt.original)
+		if !uuidName.MatchString(got) || strings.TrimPrefix(got, uuidName.FindString(got)) != tt.wantExt {
+			t.Errorf("GenerateFilename(%q) = %q, se esperaba un UUID con la extensión %q", tt.original, got, tt.wantExt)
+		}
+	}
+	if GenerateFilename("a.jpg") == GenerateFilename("a.jpg") {
+		t.Error("los nombres generados deben ser distintos")
+	}
+}
+
+func TestEscapeFormDataParam(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"foto.jpg", "foto.jpg"},
+		{`a"b.jpg`, "a%22b.jpg"},
+		{"a\r\nContent-Type: text/html", "a%0D%0AContent-Type: text/html"},
+		{"Ñuñoa 100%.pdf", "Ñuñoa 100%.pdf"},
+	}
+	for _, tt := range tests {
+		if got := escapeFormDataParam(tt.in); got != tt.want {
+			t.Errorf("escapeFormDataParam(%q) = %q, se esperaba %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// El servicio de archivos recibe el nombre limpio o el generado, nunca el original del cliente
+func TestSaveFilesFilename(t *testing.T) {
+	const original = "../../informe \u202Efdp.txt"
+	tests := []struct {
+		name  string
+		opts  []UploadOption
+		check func(stored string) bool
+	}{
+		{name: "nombre limpio", check: func(stored string) bool { return stored == "informe fdp.txt" }},
+		{
+			name: "nombre generado", opts: []UploadOption{WithGeneratedFilenames()},
+			check: func(stored string) bool {
+				return strings.HasSuffix(stored, ".txt") && !strings.Contains(stored, "informe")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saveFiles := fakes.NewSaveFiles()
+			defer saveFiles.Close()
+
+			c := newFormContext(t, "file", original, []byte(testText))
+			path, err := SaveFiles(saveFiles.URL+"/SaveFiles", c, "file", tt.opts...)
+			if err != nil {
+				t.Fatalf("SaveFiles: %v", err)
+			}
+			if stored := saveFiles.Files()[path].Filename; !tt.check(stored) {
+				t.Errorf("el archivo se guardó como %q", stored)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// ResizeToFit reduce la imagen para que su lado mayor no supere maxDimension, manteniendo la proporción.
+// Las imágenes más pequeñas, o con maxDimension en cero, se retornan sin cambios.
+// Se usa un promedio por área, que evita el aliasing al reducir fotos grandes.
+func ResizeToFit(src image.Image, maxDimension int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if maxDimension <= 0 || (width <= maxDimension && height <= maxDimension) {
+		return src
+	}
+
+	dstWidth, dstHeight := maxDimension, maxDimension
+	if width >= height {
+		dstHeight = max(1, int(math.Round(float64(height)*float64(maxDimension)/float64(width))))
+	} else {
+		dstWidth = max(1, int(math.Round(float64(width)*float64(maxDimension)/float64(height))))
+	}
+	return resampleArea(toRGBA(src), dstWidth, dstHeight)
+}
+
+// toRGBA convierte la imagen a RGBA (alfa premultiplicado) con origen en (0, 0)
+func toRGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Src)
+	return dst
+}
+
+// areaWeights son los pesos de los píxeles de origen que cubre un píxel de destino
+type areaWeights struct {
+	start   int
+	weights []float32
+}
+
+// areaFilter calcula, para cada píxel de destino, qué fracción de cada píxel de origen le corresponde
+func areaFilter(srcLen, dstLen int) []areaWeights {
+	scale := float64(srcLen) / float64(dstLen)
+	filter := make([]areaWeights, dstLen)
+	for i := range filter {
+		lo := float64(i) * scale
+		hi := lo + scale
+		start := int(lo)
+		end := min(int(math.Ceil(hi)), srcLen)
+
+		weights := make([]float32, end-start)
+		for j := start; j < end; j++ {
+			weights[j-start] = float32((math.Min(hi, float64(j+1)) - math.Max(lo, float64(j))) / scale)
+		}
+		filter[i] = areaWeights{start: start, weights: weights}
+	}
+	return filter
+}
+
+// resampleArea reduce la imagen fila por fila: cada fila de origen se reduce en horizontal y se suma,
+// con su peso, a la fila de destino que cubre. Así la memoria adicional es de una o dos filas de
+// destino y no depende del alto de la imagen original.
+func resampleArea(src *image.RGBA, dstWidth, dstHeight int) *image.RGBA {
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	columns := areaFilter(srcWidth, dstWidth)
+	rows := areaFilter(srcHeight, dstHeight)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	line := make([]float32, dstWidth*4)
+	acc := make([]float32, dstWidth*4)
+	for y, row := range rows {
+		clear(acc)
+		for k, rowWeight := range row.weights {
+			// Pasada horizontal de la fila de origen: srcWidth -> dstWidth
+			srcRow := src.Pix[(row.start+k)*src.Stride:]
+			for x, column := range columns {
+				var r, g, b, a float32
+				for j, weight := range column.weights {
+					offset := (column.start + j) * 4
+					r += weight * float32(srcRow[offset])
+					g += weight * float32(srcRow[offset+1])
+					b += weight * float32(srcRow[offset+2])
+					a += weight * float32(srcRow[offset+3])
+				}
+				line[x*4], line[x*4+1], line[x*4+2], line[x*4+3] = r, g, b, a
+			}
+			// Pasada vertical: la fila reducida se suma con el peso que le corresponde
+			for i, value := range line {
+				acc[i] += rowWeight * value
+			}
+		}
+
+		out := dst.Pix[y*dst.Stride:]
+		for i, value := range acc {
+			out[i] = clampUint8(value)
+		}
+	}
+	return dst
+}
+
+func clampUint8(value float32) uint8 {
+	switch {
+	case value <= 0:
+		return 0
+	case value >= 255:
+		return 255
+	}
+	return uint8(value + 0.5)
+}
@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // registra el decodificador GIF para image.Decode
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Nombres de las variantes por defecto
+const (
+	VariantThumbnail = "thumbnail"
+	VariantMedium    = "medium"
+	VariantOriginal  = "original"
+)
+
+// DefaultImageQuality es la calidad JPEG con la que se codifican las variantes por defecto
+const DefaultImageQuality = 85
+
+// MaxImagePixels limita el tamaño de las imágenes que se decodifican, para que una imagen
+// pequeña en bytes pero enorme en píxeles no agote la memoria del servicio. En RGBA cada
+// píxel ocupa 4 bytes, así que una imagen en el límite usa cerca de 100 MB.
+const MaxImagePixels = 24_000_000
+
+// ImageVariant es un tamaño que se genera y se sube a partir de la imagen original
+type ImageVariant struct {
+	// Name se agrega al nombre del archivo, por ejemplo foto_thumbnail.jpg
+	Name string
+	// MaxDimension es el tamaño máximo del lado mayor, en píxeles; con cero se conserva el tamaño
+	MaxDimension int
+	// Quality es la calidad JPEG de esta variante; con cero se usa la de WithImageQuality
+	Quality int
+}
+
+// DefaultImageVariants son las variantes que genera SaveImageVariants si no se indica WithImageVariants
+var DefaultImageVariants = []ImageVariant{
+	{Name: VariantThumbnail, MaxDimension: 200},
+	{Name: VariantMedium, MaxDimension: 1024},
+	{Name: VariantOriginal, MaxDimension: 2560},
+}
+
+// errVariantsDeleteURLRequired es el error de SaveImageVariants sin la URL para eliminar las variantes
+var errVariantsDeleteURLRequired = errors.New("SaveImageVariants necesita la URL de eliminación para revertir las variantes subidas")
+
+// ImageVariantPaths son las rutas donde quedó guardada cada variante
+type ImageVariantPaths struct {
+	Thumbnail string
+	Medium    string
+	Original  string
+	// Variants tiene la ruta de cada variante por nombre, incluidas las personalizadas
+	Variants map[string]string
+}
+
+// SaveImageVariants decodifica la imagen del formulario (JPEG, PNG o GIF), genera cada variante
+// reduciendo su tamaño, la vuelve a codificar y la sube al servicio de archivos.
+// Los JPEG se codifican como JPEG con la calidad configurada; PNG y GIF se codifican como PNG
+// para conservar la transparencia. La imagen se decodifica y se convierte a RGBA una sola vez para
+// todas las variantes. Si una variante falla, las ya subidas se eliminan con urlDeleteFile, que es
+// obligatoria: sin ella la función falla antes de leer el archivo.
+func SaveImageVariants(urlsavefiles string, urlDeleteFile string, c *gin.Context, Filename string, opts ...UploadOption) (*ImageVariantPaths, error) {
+	if urlDeleteFile == "" {
+		return nil, errVariantsDeleteURLRequired
+	}
+	cfg := newUploadConfig(c, opts)
+
+	file, err := c.FormFile(Filename)
+	if err != nil {
+		Logger(c).Error("Error al obtener el archivo del formulario", "field", Filename, "error", err)
+		return nil, err
+	}
+
+	filekind, _, err := prepareFileUpload(file, true, cfg)
+	if err != nil {
+		Logger(c).Warn("Imagen rechazada", "filename", file.Filename, "error", err)
+		return nil, err
+	}
+
+	fileContent, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer fileContent.Close()
+
+	data, err := io.ReadAll(fileContent)
+	if err != nil {
+		return nil, err
+	}
+
+	img, format, err := decodeImage(bytes.NewReader(data))
+	if err != nil {
+		Logger(c).Warn("No se pudo decodificar la imagen", "filename", file.Filename, "error", err)
+		return nil, fmt.Errorf("%s: %w", file.Filename, err)
+	}
+
+	// La conversión a RGBA se hace una vez y la comparten todas las variantes.
+	// Las variantes se codifican sin EXIF, así que la orientación se aplica a los píxeles
+	// y el perfil ICC se copia a cada variante JPEG.
+	var rgba image.Image = toRGBA(img)
+	img = nil
+	var icc [][]byte
+	if format == "jpeg" {
+		rgba = ApplyOrientation(rgba, JPEGOrientation(data))
+		icc = jpegICCSegments(data)
+	}
+
+	variants := cfg.imageVariants
+	if len(variants) == 0 {
+		variants = DefaultImageVariants
+	}
+
+	// Todas las variantes comparten el nombre base, también cuando se genera con WithGeneratedFilenames
+	baseName := cfg.uploadFilename(file.Filename)
+	results := make([]FileUploadResult, 0, len(variants))
+	for _, variant := range variants {
+		filename, contentType, data, err := encodeImageVariant(rgba, format, icc, baseName, variant, cfg.imageQuality)
+		result := FileUploadResult{Field: variant.Name, Filename: filename, Err: err}
+		if err == nil {
+			result.Path, result.Err = uploadBytes(urlsavefiles, filename, contentType, filekind, data, c)
+		}
+		results = append(results, result)
+		if result.Err != nil {
+			break
+		}
+	}
+
+	if uploadErr := joinUploadErrors(results); uploadErr != nil {
+		Logger(c).Error("No se pudieron guardar las variantes de la imagen", "filename", file.Filename, "error", uploadErr)
+		// Sin todas las variantes la imagen no sirve, así que las ya subidas siempre se eliminan
+		rollbackUploads(results, urlDeleteFile, cfg, c)
+		uploadErr = joinUploadErrors(results)
+		return nil, uploadErr
+	}
+
+	paths := &ImageVariantPaths{Variants: make(map[string]string, len(results))}
+	for _, result := range results {
+		paths.Variants[result.Field] = result.Path
+	}
+	paths.Thumbnail = paths.Variants[VariantThumbnail]
+	paths.Medium = paths.Variants[VariantMedium]
+	paths.Original = paths.Variants[VariantOriginal]
+	return paths, nil
+}
+
+// decodeImage decodifica JPEG, PNG o GIF después de verificar que el tamaño en píxeles sea aceptable.
+// Los otros formatos retornan un error que envuelve ErrUnsupportedFileType.
+func decodeImage(r io.ReadSeeker) (image.Image, string, error) {
+	config, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("formato de imagen no soportado para redimensionar: %w", ErrUnsupportedFileType)
+	}
+	if format != "jpeg" && format != "png" && format != "gif" {
+		return nil, "", fmt.Errorf("formato de imagen %s no soportado para redimensionar: %w", format, ErrUnsupportedFileType)
+	}
+	if int64(config.Width)*int64(config.Height) > MaxImagePixels {
+		return nil, "", fmt.Errorf("la imagen mide %dx%d píxeles y el máximo es %d: %w",
+			config.Width, config.Height, MaxImagePixels, ErrFileTooLarge)
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, "", err
+	}
+	img, format, err := image.Decode(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("imagen %s inválida: %v: %w", format, err, ErrUnsupportedFileType)
+	}
+	return img, format, nil
+}
+
+// encodeImageVariant redimensiona y codifica una variante, agregando el perfil ICC a los JPEG.
+// Retorna el nombre del archivo, su Content-Type y los bytes codificados.
+func encodeImageVariant(img image.Image, format string, icc [][]byte, originalName string, variant ImageVariant, quality int) (string, string, []byte, error) {
+	resized := ResizeToFit(img, variant.MaxDimension)
+	if variant.Quality > 0 {
+		quality = variant.Quality
+	}
+	if quality <= 0 {
+		quality = DefaultImageQuality
+	}
+
+	var buf bytes.Buffer
+	ext, contentType := ".png", "image/png"
+	if format == "jpeg" {
+		ext, contentType = ".jpg", "image/jpeg"
+		if err := jpeg.Encode(&buf, resized, &jpeg.Options{Quality: min(quality, 100)}); err != nil {
+			return "", "", nil, err
+		}
+	} else if err := png.Encode(&buf, resized); err != nil {
+		return "", "", nil, err
+	}
+
+	data := buf.Bytes()
+	if format == "jpeg" {
+		data = insertJPEGSegments(data, icc)
+	}
+
+	base := strings.TrimSuffix(filepath.Base(originalName), filepath.Ext(originalName))
+	return base + "_" + variant.Name + ext, contentType, data, nil
+}
+
+// uploadBytes sube al servicio de archivos un contenido generado en memoria
+func uploadBytes(urlsavefiles, filename, contentType, kindfile string, data []byte, c *gin.Context) (string, error) {
+	return executeFileUploadRequest(urlsavefiles, newBytesBody(filename, contentType, kindfile, data), c)
+}
@@ -0,0 +1,209 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/edwinrubio/DueligUtils/testhelpers/fakes"
+)
+
+// testImage crea una imagen con un degradado; con alpha el lado derecho queda transparente
+func testImage(width, height int, alpha bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			a := uint8(255)
+			if alpha && x >= width/2 {
+				a = 0
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: a})
+		}
+	}
+	return img
+}
+
+// encodeTestImage codifica la imagen en el formato indicado: "jpeg", "png" o "gif"
+func encodeTestImage(t *testing.T, img image.Image, format string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pngHeader arma un PNG que declara width x height en su IHDR, sin datos de imagen
+func pngHeader(width, height uint32) []byte {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], width)
+	binary.BigEndian.PutUint32(ihdr[4:], height)
+	ihdr[8], ihdr[9] = 8, 6 // 8 bits por canal, RGBA
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+	chunk := append([]byte("IHDR"), ihdr...)
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	return buf.Bytes()
+}
+
+func TestSaveImageVariants(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		data     func(t *testing.T) []byte
+		opts     []UploadOption
+		// wantSizes es el tamaño esperado de cada variante, por nombre
+		wantSizes       map[string]image.Point
+		wantContentType string
+		wantExt         string
+	}{
+		{
+			name:     "JPEG apaisado con las variantes por defecto",
+			filename: "cancha.jpg",
+			data:     func(t *testing.T) []byte { return encodeTestImage(t, testImage(3000, 1500, false), "jpeg") },
+			wantSizes: map[string]image.Point{
+				VariantThumbnail: {200, 100}, VariantMedium: {1024, 512}, VariantOriginal: {2560, 1280},
+			},
+			wantContentType: "image/jpeg", wantExt: ".jpg",
+		},
+		{
+			name:     "imagen pequeña no se agranda",
+			filename: "icono.png",
+			data:     func(t *testing.T) []byte { return encodeTestImage(t, testImage(150, 300, true), "png") },
+			wantSizes: map[string]image.Point{
+				VariantThumbnail: {100, 200}, VariantMedium: {150, 300}, VariantOriginal: {150, 300},
+			},
+			wantContentType: "image/png", wantExt: ".png",
+		},
+		{
+			name:            "GIF se codifica como PNG con variantes propias",
+			filename:        "animado.gif",
+			data:            func(t *testing.T) []byte { return encodeTestImage(t, testImage(400, 400, false), "gif") },
+			opts:            []UploadOption{WithImageVariants(ImageVariant{Name: "icon", MaxDimension: 64})},
+			wantSizes:       map[string]image.Point{"icon": {64, 64}},
+			wantContentType: "image/png", wantExt: ".png",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saveFiles := fakes.NewSaveFiles()
+			defer saveFiles.Close()
+
+			c := newFormContext(t, "foto", tt.filename, tt.data(t))
+			paths, err := SaveImageVariants(saveFiles.URL+"/SaveImages", saveFiles.URL+"/DeleteFile", c, "foto", tt.opts...)
+			if err != nil {
+				t.Fatalf("SaveImageVariants: %v", err)
+			}
+			if len(paths.Variants) != len(tt.wantSizes) {
+				t.Fatalf("se subieron %d variantes, se esperaban %d", len(paths.Variants), len(tt.wantSizes))
+			}
+
+			for name, want := range tt.wantSizes {
+				stored, exists := saveFiles.Files()[paths.Variants[name]]
+				if !exists {
+					t.Fatalf("la variante %s no está en el servicio", name)
+				}
+				config, _, err := image.DecodeConfig(bytes.NewReader(stored.Data))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := (image.Point{config.Width, config.Height}); got != want {
+					t.Errorf("%s mide %v, se esperaba %v", name, got, want)
+				}
+				if stored.Kindfile != KindImages || !strings.HasSuffix(stored.Filename, "_"+name+tt.wantExt) {
+					t.Errorf("%s se guardó como %s en %s", name, stored.Filename, stored.Kindfile)
+				}
+			}
+			for _, req := range saveFiles.RequestsTo("/SaveImages") {
+				if req.Files[0].ContentType != tt.wantContentType {
+					t.Errorf("la variante %s se envió como %s", req.Files[0].Filename, req.Files[0].ContentType)
+				}
+			}
+			if paths.Thumbnail != paths.Variants[VariantThumbnail] || paths.Original != paths.Variants[VariantOriginal] {
+				t.Errorf("las rutas por defecto no coinciden con Variants: %+v", paths)
+			}
+		})
+	}
+}
+
+// Si una variante falla, las ya subidas se eliminan con la URL indicada
+func TestSaveImageVariantsRollback(t *testing.T) {
+	saveFiles := fakes.NewSaveFiles()
+	defer saveFiles.Close()
+	uploaded := []string{"Images/1-cancha_thumbnail.jpg", "Images/2-cancha_medium.jpg"}
+	for _, path := range uploaded {
+		saveFiles.PutFile(path, []byte("variante"))
+		saveFiles.On(http.MethodPost, "/SaveImages", fakes.Response{Body: map[string]string{"file_path": path}})
+	}
+	saveFiles.On(http.MethodPost, "/SaveImages", fakes.Response{Status: http.StatusServiceUnavailable})
+
+	c := newFormContext(t, "foto", "cancha.jpg", encodeTestImage(t, testImage(1200, 800, false), "jpeg"))
+	paths, err := SaveImageVariants(saveFiles.URL+"/SaveImages", saveFiles.URL+"/DeleteFile", c, "foto")
+	if paths != nil || !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Fatalf("SaveImageVariants = %+v, %v; se esperaba ErrUpstreamUnavailable", paths, err)
+	}
+	if errors.Is(err, ErrRollbackFailed) {
+		t.Errorf("las variantes se debían eliminar: %v", err)
+	}
+	for _, path := range uploaded {
+		if saveFiles.HasFile(path) {
+			t.Errorf("la variante %s no se eliminó", path)
+		}
+	}
+	if got := len(saveFiles.RequestsTo("/DeleteFile")); got != len(uploaded) {
+		t.Errorf("se hicieron %d eliminaciones, se esperaban %d", got, len(uploaded))
+	}
+}
+
+func TestSaveImageVariantsRejects(t *testing.T) {
+	tests := []struct {
+		name          string
+		filename      string
+		data          []byte
+		urlDeleteFile string
+		wantErr       error
+	}{
+		{name: "sin URL de eliminación", filename: "a.png", data: encodeTestImage(t, testImage(10, 10, false), "png"), wantErr: errVariantsDeleteURLRequired},
+		{name: "demasiados píxeles", filename: "a.png", data: pngHeader(30000, 30000), urlDeleteFile: "/DeleteFile", wantErr: ErrFileTooLarge},
+		{name: "no es una imagen", filename: "a.pdf", data: []byte(testPDF), urlDeleteFile: "/DeleteFile", wantErr: ErrUnsupportedFileType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saveFiles := fakes.NewSaveFiles()
+			defer saveFiles.Close()
+
+			c := newFormContext(t, "foto", tt.filename, tt.data)
+			urlDeleteFile := tt.urlDeleteFile
+			if urlDeleteFile != "" {
+				urlDeleteFile = saveFiles.URL + urlDeleteFile
+			}
+			if _, err := SaveImageVariants(saveFiles.URL+"/SaveImages", urlDeleteFile, c, "foto"); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SaveImageVariants = %v, se esperaba %v", err, tt.wantErr)
+			}
+			if len(saveFiles.Requests()) != 0 {
+				t.Error("la imagen rechazada no debe llegar al servicio de archivos")
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+)
+
+// Marcadores JPEG que se tratan al limpiar los metadatos
+const (
+	jpegMarkerSOI   = 0xD8
+	jpegMarkerEOI   = 0xD9
+	jpegMarkerSOS   = 0xDA
+	jpegMarkerAPP0  = 0xE0
+	jpegMarkerAPP1  = 0xE1
+	jpegMarkerAPP2  = 0xE2
+	jpegMarkerAPP14 = 0xEE
+	jpegMarkerAPP15 = 0xEF
+	jpegMarkerCOM   = 0xFE
+)
+
+// Identificadores de los segmentos APPn
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	iccHeader  = []byte("ICC_PROFILE\x00")
+)
+
+// jpegSegment es un segmento de cabecera del JPEG, antes de los datos de la imagen
+type jpegSegment struct {
+	marker byte
+	// raw es el segmento completo: 0xFF, marcador, longitud y contenido
+	raw []byte
+}
+
+func (s jpegSegment) payload() []byte {
+	if len(s.raw) < 4 {
+		return nil
+	}
+	return s.raw[4:]
+}
+
+// parseJPEGSegments separa las cabeceras del JPEG y retorna los segmentos y el resto del archivo
+// desde el marcador SOS (datos de la imagen y marcadores siguientes).
+func parseJPEGSegments(data []byte) ([]jpegSegment, []byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != jpegMarkerSOI {
+		return nil, nil, fmt.Errorf("el archivo no es un JPEG: %w", ErrUnsupportedFileType)
+	}
+
+	var segments []jpegSegment
+	i := 2
+	for i < len(data) {
+		if data[i] != 0xFF {
+			return nil, nil, fmt.Errorf("JPEG inválido: se esperaba un marcador en el byte %d: %w", i, ErrUnsupportedFileType)
+		}
+		// Los bytes 0xFF repetidos son relleno antes del marcador
+		for i < len(data) && data[i] == 0xFF {
+			i++
+		}
+		if i >= len(data) {
+			break
+		}
+		marker := data[i]
+		i++
+
+		if marker == jpegMarkerSOS {
+			return segments, data[i-2:], nil
+		}
+		// Marcadores sin longitud (TEM y RSTn)
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			segments = append(segments, jpegSegment{marker: marker, raw: []byte{0xFF, marker}})
+			continue
+		}
+
+		if i+2 > len(data) {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[i : i+2]))
+		if length < 2 || i+length > len(data) {
+			return nil, nil, fmt.Errorf("JPEG inválido: segmento 0x%X truncado: %w", marker, ErrUnsupportedFileType)
+		}
+		segments = append(segments, jpegSegment{marker: marker, raw: append([]byte{0xFF, marker}, data[i:i+length]...)})
+		i += length
+	}
+	return nil, nil, fmt.Errorf("JPEG inválido: no contiene datos de imagen: %w", ErrUnsupportedFileType)
+}
+
+// keepJPEGSegment indica si el segmento se conserva al limpiar los metadatos.
+// Se conservan JFIF (APP0), el perfil ICC (APP2) y Adobe (APP14), que afectan cómo se ven los colores,
+// y las tablas necesarias para decodificar. Se eliminan EXIF y XMP (APP1, que incluyen el GPS y
+// el número de serie del dispositivo), IPTC (APP13), los demás APPn y los comentarios.
+func keepJPEGSegment(segment jpegSegment) bool {
+	switch {
+	case segment.marker == jpegMarkerAPP0, segment.marker == jpegMarkerAPP14:
+		return true
+	case segment.marker == jpegMarkerAPP2:
+		return bytes.HasPrefix(segment.payload(), iccHeader)
+	case segment.marker >= jpegMarkerAPP0 && segment.marker <= jpegMarkerAPP15, segment.marker == jpegMarkerCOM:
+		return false
+	}
+	return true
+}
+
+// StripJPEGMetadata elimina EXIF, XMP, IPTC y comentarios del JPEG sin volver a codificar la imagen.
+// El perfil ICC se conserva. Todo lo que sigue al EOI se descarta: ahí van las imágenes
+// secundarias de MPF y las miniaturas, que traen su propio EXIF con el GPS.
+func StripJPEGMetadata(data []byte) ([]byte, error) {
+	segments, scan, err := parseJPEGSegments(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, jpegMarkerSOI)
+	for _, segment := range segments {
+		if keepJPEGSegment(segment) {
+			out = append(out, segment.raw...)
+		}
+	}
+	return appendJPEGScans(out, scan), nil
+}
+
+// appendJPEGScans agrega los datos de la imagen desde el primer SOS hasta el EOI, inclusive.
+// Los JPEG progresivos tienen varios SOS con tablas entre ellos; los segmentos de metadatos
+// que aparezcan entre los scans se eliminan igual que en las cabeceras. Si el archivo está
+// truncado y no tiene EOI, se agrega lo que haya.
+func appendJPEGScans(out []byte, scan []byte) []byte {
+	i := 0
+	for i < len(scan) {
+		if scan[i] != 0xFF {
+			return append(out, scan[i:]...)
+		}
+		start := i
+		for i < len(scan) && scan[i] == 0xFF {
+			i++
+		}
+		if i >= len(scan) {
+			return out
+		}
+		marker := scan[i]
+		i++
+
+		switch {
+		case marker == jpegMarkerEOI:
+			return append(out, 0xFF, jpegMarkerEOI)
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			out = append(out, 0xFF, marker)
+			continue
+		}
+
+		if i+2 > len(scan) {
+			return append(out, scan[start:]...)
+		}
+		length := int(binary.BigEndian.Uint16(scan[i : i+2]))
+		if length < 2 || i+length > len(scan) {
+			return append(out, scan[start:]...)
+		}
+		segment := jpegSegment{marker: marker, raw: append([]byte{0xFF, marker}, scan[i:i+length]...)}
+		i += length
+		if marker != jpegMarkerSOS {
+			if keepJPEGSegment(segment) {
+				out = append(out, segment.raw...)
+			}
+			continue
+		}
+
+		// Después del SOS vienen los datos comprimidos, donde 0xFF solo aparece seguido de 0x00
+		// (byte escapado) o de un RSTn. Cualquier otro marcador termina el scan.
+		out = append(out, segment.raw...)
+		end := i
+		for end < len(scan) {
+			if scan[end] == 0xFF && end+1 < len(scan) {
+				next := scan[end+1]
+				if next != 0x00 && (next < 0xD0 || next > 0xD7) {
+					break
+				}
+				end += 2
+				continue
+			}
+			end++
+		}
+		out = append(out, scan[i:end]...)
+		i = end
+	}
+	return out
+}
+
+// JPEGOrientation retorna la orientación EXIF (1 a 8) del JPEG, o 1 si no la tiene
+func JPEGOrientation(data []byte) int {
+	segments, _, err := parseJPEGSegments(data)
+	if err != nil {
+		return 1
+	}
+	for _, segment := range segments {
+		if segment.marker != jpegMarkerAPP1 || !bytes.HasPrefix(segment.payload(), exifHeader) {
+			continue
+		}
+		if orientation := exifOrientation(segment.payload()[len(exifHeader):]); orientation != 0 {
+			return orientation
+		}
+	}
+	return 1
+}
+
+// exifOrientation lee la etiqueta Orientation (0x0112) del IFD0 del bloque TIFF, o retorna 0
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[0:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[ifd : ifd+2]))
+	for n := 0; n < entries; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:entry+2]) != 0x0112 {
+			continue
+		}
+		orientation := int(order.Uint16(tiff[entry+8 : entry+10]))
+		if orientation < 1 || orientation > 8 {
+			return 0
+		}
+		return orientation
+	}
+	return 0
+}
+
+// jpegICCSegments retorna los segmentos APP2 con el perfil ICC, para agregarlos al volver a codificar
+func jpegICCSegments(data []byte) [][]byte {
+	segments, _, err := parseJPEGSegments(data)
+	if err != nil {
+		return nil
+	}
+	var icc [][]byte
+	for _, segment := range segments {
+		if segment.marker == jpegMarkerAPP2 && bytes.HasPrefix(segment.payload(), iccHeader) {
+			icc = append(icc, segment.raw)
+		}
+	}
+	return icc
+}
+
+// insertJPEGSegments agrega los segmentos justo después del SOI de un JPEG codificado
+func insertJPEGSegments(encoded []byte, segments [][]byte) []byte {
+	if len(segments) == 0 || len(encoded) < 2 {
+		return encoded
+	}
+	size := len(encoded)
+	for _, segment := range segments {
+		size += len(segment)
+	}
+	out := make([]byte, 0, size)
+	out = append(out, encoded[:2]...)
+	for _, segment := range segments {
+		out = append(out, segment...)
+	}
+	return append(out, encoded[2:]...)
+}
+
+// NormalizeJPEG aplica la orientación EXIF a los píxeles y elimina los metadatos, conservando el perfil ICC.
+// Si la imagen ya está en orientación normal no se vuelve a codificar; si hay que rotarla se codifica
+// con la calidad indicada (DefaultImageQuality si es cero). Antes de decodificarla se verifica que no
+// supere MaxImagePixels; si lo supera retorna un error que envuelve ErrFileTooLarge.
+func NormalizeJPEG(data []byte, quality int) ([]byte, error) {
+	orientation := JPEGOrientation(data)
+	if orientation == 1 {
+		return StripJPEGMetadata(data)
+	}
+
+	img, format, err := decodeImage(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if format != "jpeg" {
+		return nil, fmt.Errorf("el archivo es %s y no JPEG: %w", format, ErrUnsupportedFileType)
+	}
+	if quality <= 0 {
+		quality = DefaultImageQuality
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, ApplyOrientation(img, orientation), &jpeg.Options{Quality: min(quality, 100)}); err != nil {
+		return nil, err
+	}
+	return insertJPEGSegments(buf.Bytes(), jpegICCSegments(data)), nil
+}
+
+// ApplyOrientation transforma los píxeles según la orientación EXIF (1 a 8),
+// de modo que la imagen se vea derecha sin depender de los metadatos
+func ApplyOrientation(src image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	rgba := toRGBA(src)
+	width, height := rgba.Bounds().Dx(), rgba.Bounds().Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // espejo horizontal
+				sx, sy = width-1-x, y
+			case 3: // rotación 180°
+				sx, sy = width-1-x, height-1-y
+			case 4: // espejo vertical
+				sx, sy = x, height-1-y
+			case 5: // transpuesta
+				sx, sy = y, x
+			case 6: // rotación 90° horaria
+				sx, sy = y, height-1-x
+			case 7: // transversa
+				sx, sy = width-1-y, height-1-x
+			case 8: // rotación 90° antihoraria
+				sx, sy = width-1-y, x
+			}
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], rgba.Pix[sy*rgba.Stride+sx*4:sy*rgba.Stride+sx*4+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,197 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/edwinrubio/DueligUtils/testhelpers/fakes"
+)
+
+// exifSegment arma un segmento APP1 con un IFD0 que solo tiene la orientación
+func exifSegment(order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 26)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], 0x0112) // Orientation
+	order.PutUint16(tiff[12:], 3)      // SHORT
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+	return jpegTestSegment(jpegMarkerAPP1, append(append([]byte(nil), exifHeader...), tiff...))
+}
+
+func jpegTestSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// testJPEG codifica una imagen de width x height con la mitad izquierda roja y la derecha azul,
+// con los segmentos indicados después del SOI
+func testJPEG(t *testing.T, width, height int, segments ...[]byte) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/2 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return insertJPEGSegments(buf.Bytes(), segments)
+}
+
+// withJPEGSize cambia el tamaño que declara el SOF0 sin cambiar los datos de la imagen
+func withJPEGSize(t *testing.T, data []byte, width, height uint16) []byte {
+	t.Helper()
+	out := append([]byte(nil), data...)
+	i := bytes.Index(out, []byte{0xFF, 0xC0})
+	if i < 0 {
+		t.Fatal("el JPEG no tiene SOF0")
+	}
+	binary.BigEndian.PutUint16(out[i+5:], height)
+	binary.BigEndian.PutUint16(out[i+7:], width)
+	return out
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	tests := []struct {
+		name string
+		data func(t *testing.T) []byte
+		want int
+	}{
+		{"sin EXIF", func(t *testing.T) []byte { return testJPEG(t, 8, 8) }, 1},
+		{"big endian", func(t *testing.T) []byte { return testJPEG(t, 8, 8, exifSegment(binary.BigEndian, 6)) }, 6},
+		{"little endian", func(t *testing.T) []byte { return testJPEG(t, 8, 8, exifSegment(binary.LittleEndian, 8)) }, 8},
+		{"valor fuera de rango", func(t *testing.T) []byte { return testJPEG(t, 8, 8, exifSegment(binary.BigEndian, 42)) }, 1},
+		{"no es JPEG", func(*testing.T) []byte { return []byte("hola") }, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := JPEGOrientation(tt.data(t)); got != tt.want {
+				t.Errorf("JPEGOrientation = %d, se esperaba %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeJPEG(t *testing.T) {
+	icc := jpegTestSegment(jpegMarkerAPP2, append(append([]byte(nil), iccHeader...), "\x01\x01perfil"...))
+	comment := jpegTestSegment(jpegMarkerCOM, []byte("GPS 4.7110,-74.0721"))
+
+	tests := []struct {
+		name        string
+		orientation uint16
+		wantSize    image.Point
+		// wantRed es un punto que debe quedar rojo después de aplicar la orientación
+		wantRed image.Point
+	}{
+		{name: "orientación normal", orientation: 1, wantSize: image.Pt(40, 20), wantRed: image.Pt(5, 10)},
+		{name: "rotación 90° horaria", orientation: 6, wantSize: image.Pt(20, 40), wantRed: image.Pt(10, 5)},
+		{name: "rotación 180°", orientation: 3, wantSize: image.Pt(40, 20), wantRed: image.Pt(35, 10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := testJPEG(t, 40, 20, exifSegment(binary.BigEndian, tt.orientation), icc, comment)
+
+			out, err := NormalizeJPEG(data, 0)
+			if err != nil {
+				t.Fatalf("NormalizeJPEG: %v", err)
+			}
+			if bytes.Contains(out, exifHeader) || bytes.Contains(out, []byte("GPS")) {
+				t.Error("quedaron metadatos en la imagen")
+			}
+			if !bytes.Contains(out, icc) {
+				t.Error("se perdió el perfil ICC")
+			}
+			if JPEGOrientation(out) != 1 {
+				t.Error("la imagen normalizada debe quedar con orientación normal")
+			}
+
+			img, err := jpeg.Decode(bytes.NewReader(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := img.Bounds().Size(); got != tt.wantSize {
+				t.Fatalf("la imagen mide %v, se esperaba %v", got, tt.wantSize)
+			}
+			if r, _, b, _ := img.At(tt.wantRed.X, tt.wantRed.Y).RGBA(); r < 0xC000 || b > 0x4000 {
+				t.Errorf("el punto %v no es rojo: la orientación no se aplicó a los píxeles", tt.wantRed)
+			}
+		})
+	}
+}
+
+func TestNormalizeJPEGRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    func(t *testing.T) []byte
+		wantErr error
+	}{
+		{
+			name: "tamaño declarado enorme con orientación",
+			data: func(t *testing.T) []byte {
+				return withJPEGSize(t, testJPEG(t, 16, 16, exifSegment(binary.BigEndian, 6)), 30000, 30000)
+			},
+			wantErr: ErrFileTooLarge,
+		},
+		{
+			name: "tamaño declarado enorme sin orientación",
+			data: func(t *testing.T) []byte {
+				return withJPEGSize(t, testJPEG(t, 16, 16), 30000, 30000)
+			},
+		},
+		{name: "no es JPEG", data: func(*testing.T) []byte { return []byte(testPDF) }, wantErr: ErrUnsupportedFileType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NormalizeJPEG(tt.data(t), 0)
+			if tt.wantErr == nil {
+				// Sin orientación solo se quitan segmentos, los píxeles no se decodifican
+				if err != nil {
+					t.Errorf("NormalizeJPEG = %v, se esperaba nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("NormalizeJPEG = %v, se esperaba %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSaveFilesStripsImageMetadata(t *testing.T) {
+	saveFiles := fakes.NewSaveFiles()
+	defer saveFiles.Close()
+
+	data := testJPEG(t, 40, 20, exifSegment(binary.BigEndian, 6))
+	c := newFormContext(t, "foto", "cancha.jpg", data)
+	path, err := SaveFiles(saveFiles.URL+"/SaveImages", c, "foto", WithStripImageMetadata())
+	if err != nil {
+		t.Fatalf("SaveFiles: %v", err)
+	}
+
+	stored := saveFiles.Files()[path].Data
+	if bytes.Contains(stored, exifHeader) {
+		t.Error("el JPEG se guardó con EXIF")
+	}
+	if config, err := jpeg.DecodeConfig(bytes.NewReader(stored)); err != nil || config.Width != 20 || config.Height != 40 {
+		t.Errorf("el JPEG guardado mide %dx%d, se esperaba 20x40 (%v)", config.Width, config.Height, err)
+	}
+}
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// userIDContextKey guarda en el contexto de Gin el ID de usuario ya extraído del token
+const userIDContextKey = "duelig.user_id"
+
+// Formatos de salida soportados por ConfigureLogging
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// LogConfig define el formato y el nivel de los logs del servicio
+type LogConfig struct {
+	// Format es "json" o "text". Por defecto "text".
+	Format string
+	// Level es el nivel mínimo que se escribe. Por defecto Info.
+	Level slog.Leveler
+	// Output es el destino de los logs. Por defecto os.Stderr.
+	Output io.Writer
+	// AddSource incluye el archivo y la línea que generó cada log
+	AddSource bool
+}
+
+var baseLogger atomic.Pointer[slog.Logger]
+
+func init() {
+	baseLogger.Store(newLogger(LogConfig{}))
+}
+
+// ConfigureLogging reemplaza el logger base del paquete. Debe llamarse al iniciar el servicio.
+func ConfigureLogging(cfg LogConfig) *slog.Logger {
+	logger := newLogger(cfg)
+	baseLogger.Store(logger)
+	return logger
+}
+
+// ParseLogLevel convierte un nivel en texto (debug, info, warn, error) a slog.Level.
+// Si el texto no es válido retorna Info.
+func ParseLogLevel(level string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func newLogger(cfg LogConfig) *slog.Logger {
+	output := cfg.Output
+	if output == nil {
+		output = os.Stderr
+	}
+
+	level := cfg.Level
+	if level == nil {
+		level = slog.LevelInfo
+	}
+
+	opts := &slog.HandlerOptions{Level: level, AddSource: cfg.AddSource}
+	if strings.EqualFold(cfg.Format, LogFormatJSON) {
+		return slog.New(slog.NewJSONHandler(output, opts))
+	}
+	return slog.New(slog.NewTextHandler(output, opts))
+}
+
+// BaseLogger retorna el logger del paquete sin datos de ninguna solicitud
+func BaseLogger() *slog.Logger {
+	return baseLogger.Load()
+}
+
+// Logger retorna un logger con los datos de la solicitud actual:
+// request ID, ID del usuario, ruta, tipo de cliente y, si existe, la traza.
+func Logger(c *gin.Context) *slog.Logger {
+	logger := BaseLogger()
+	if c == nil || c.Request == nil {
+		return logger
+	}
+
+	route := c.FullPath()
+	if route == "" {
+		route = c.Request.URL.Path
+	}
+
+	attrs := []any{
+		slog.String("request_id", c.GetHeader("X-Request-ID")),
+		slog.String("route", route),
+		slog.String("client_type", c.GetHeader("Client-Type")),
+	}
+	if userID := contextUserID(c); userID != "" {
+		attrs = append(attrs, slog.String("user_id", userID))
+	}
+	if spanContext := trace.SpanContextFromContext(c.Request.Context()); spanContext.IsValid() {
+		attrs = append(attrs, slog.String("trace_id", spanContext.TraceID().String()))
+	}
+
+	return logger.With(attrs...)
+}
+
+// contextUserID obtiene el ID del usuario del token una sola vez por solicitud
+func contextUserID(c *gin.Context) string {
+	if value, exists := c.Get(userIDContextKey); exists {
+		userID, _ := value.(string)
+		return userID
+	}
+
+	userID := ""
+	if c.GetHeader("Authorization") != "" {
+		if id, err := TokenCurrentUserID(c); err == nil {
+			userID = id
+		}
+	}
+	c.Set(userIDContextKey, userID)
+	return userID
+}
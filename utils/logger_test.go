@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/edwinrubio/DueligUtils/testhelpers/fakes"
+	"github.com/gin-gonic/gin"
+)
+
+// captureLogs reemplaza el logger base por uno JSON que escribe en el buffer retornado
+func captureLogs(t *testing.T, level slog.Level) *bytes.Buffer {
+	t.Helper()
+	previous := BaseLogger()
+	t.Cleanup(func() { baseLogger.Store(previous) })
+
+	var buf bytes.Buffer
+	ConfigureLogging(LogConfig{Format: LogFormatJSON, Level: level, Output: &buf})
+	return &buf
+}
+
+// logEntries decodifica los logs JSON escritos en buf
+func logEntries(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log que no es JSON: %q", line)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestLoggerRequestAttributes(t *testing.T) {
+	usuarios := fakes.NewUsuarios()
+	defer usuarios.Close()
+	userID := usuarios.UserID(fakes.SeedJugadorEmail)
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		wantUser string
+	}{
+		{"con token", map[string]string{"X-Request-ID": "req-1", "Client-Type": "web", "Authorization": usuarios.IssueToken(userID)}, userID.Hex()},
+		{"sin token", map[string]string{"X-Request-ID": "req-1", "Client-Type": "web"}, ""},
+		{"token inválido", map[string]string{"X-Request-ID": "req-1", "Client-Type": "web", "Authorization": "no-es-un-jwt"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureLogs(t, slog.LevelInfo)
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("/items/:id", func(c *gin.Context) {
+				Logger(c).Info("primero")
+				Logger(c).Info("segundo")
+			})
+			req := httptest.NewRequest(http.MethodGet, "/items/7", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			entries := logEntries(t, buf)
+			if len(entries) != 2 {
+				t.Fatalf("se esperaban dos logs, hay %d", len(entries))
+			}
+			for _, entry := range entries {
+				if entry["request_id"] != "req-1" || entry["route"] != "/items/:id" || entry["client_type"] != "web" {
+					t.Errorf("log sin los datos de la solicitud: %v", entry)
+				}
+				userIDValue, hasUser := entry["user_id"]
+				if tt.wantUser == "" && hasUser {
+					t.Errorf("no se esperaba user_id, se registró %v", userIDValue)
+				}
+				if tt.wantUser != "" && userIDValue != tt.wantUser {
+					t.Errorf("user_id = %v, se esperaba %s", userIDValue, tt.wantUser)
+				}
+			}
+		})
+	}
+}
+
+func TestLoggerWithoutRequest(t *testing.T) {
+	buf := captureLogs(t, slog.LevelWarn)
+
+	Logger(nil).Info("no se escribe")
+	Logger(nil).Warn("sin solicitud")
+
+	entries := logEntries(t, buf)
+	if len(entries) != 1 || entries[0]["msg"] != "sin solicitud" {
+		t.Fatalf("logs inesperados: %v", entries)
+	}
+	if _, exists := entries[0]["request_id"]; exists {
+		t.Error("sin solicitud no debe registrarse request_id")
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		in   string
+		want slog.Level
+	}{
+		{"debug", slog.LevelDebug},
+		{" DEBUG ", slog.LevelDebug},
+		{"info", slog.LevelInfo},
+		{"warn", slog.LevelWarn},
+		{"warning", slog.LevelWarn},
+		{"error", slog.LevelError},
+		{"", slog.LevelInfo},
+		{"verbose", slog.LevelInfo},
+	}
+	for _, tt := range tests {
+		if got := ParseLogLevel(tt.in); got != tt.want {
+			t.Errorf("ParseLogLevel(%q) = %v, se esperaba %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -2,14 +2,15 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha512"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strings"
 
@@ -20,6 +21,9 @@ import (
 
 // extractHeaders obtiene las cabeceras comunes de autenticación del contexto
 func ExtractHeaders(c *gin.Context) map[string]string {
+	if c == nil || c.Request == nil {
+		return map[string]string{}
+	}
 	return map[string]string{
 		"Authorization": c.GetHeader("Authorization"),
 		"X-CSRF-Token":  c.GetHeader("X-CSRF-Token"),
@@ -43,14 +47,14 @@ func ValidateSession(urlapiusuarios string) gin.HandlerFunc {
 		headers := ExtractHeaders(c)
 
 		if headers["Authorization"] == "" {
-			log.Println("Missing Authorization header")
+			Logger(c).Warn("Falta la cabecera Authorization")
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing Authorization header"})
 			c.Abort()
 			return
 		}
 
 		if headers["Client-Type"] == "" {
-			log.Println("Missing Client header")
+			Logger(c).Warn("Falta la cabecera Client-Type")
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing Client header"})
 			c.Abort()
 			return
@@ -59,7 +63,7 @@ func ValidateSession(urlapiusuarios string) gin.HandlerFunc {
 		// Crear la solicitud para validar el JWT
 		req, err := http.NewRequest("POST", urlapiusuarios+"/api/v1/ValidateJWT", nil)
 		if err != nil {
-			log.Println("Error creating ValidateJWT request:", err)
+			Logger(c).Error("Error al crear la solicitud a ValidateJWT", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create request"})
 			c.Abort()
 			return
@@ -68,17 +72,19 @@ func ValidateSession(urlapiusuarios string) gin.HandlerFunc {
 		// Aplicar cabeceras a la solicitud
 		ApplyHeaders(req, headers)
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
+		resp, err := doDownstream(requestContext(c), serviceUsuarios, "validate_session", req)
 		if err != nil {
+			Logger(c).Error("Error al validar la sesión", "error", err)
+			c.Error(err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate session"})
 			c.Abort()
 			return
 		}
-		// defer resp.Body.Close()
+		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
 			body, _ := io.ReadAll(resp.Body)
+			Logger(c).Warn("Sesión rechazada por el servicio de usuarios", "status", resp.StatusCode)
 			c.JSON(resp.StatusCode, gin.H{"error": string(body)})
 			c.Abort()
 			return
@@ -88,13 +94,22 @@ func ValidateSession(urlapiusuarios string) gin.HandlerFunc {
 	}
 }
 
-func makePostRequest(url string, reqBody []byte, kindBody string) (string, error) {
-	resp, err := http.Post(url, kindBody, bytes.NewBuffer(reqBody))
+func makePostRequest(url string, reqBody []byte, kindBody string, c *gin.Context) (string, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return "", err
+	}
+	ApplyHeaders(req, ExtractHeaders(c))
+	req.Header.Set("Content-Type", kindBody)
+
+	resp, err := doDownstream(requestContext(c), serviceSaveFiles, "images_from_url", req)
 	if err != nil {
 		return "", err
 	}
+	defer resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("received non-OK HTTP status: %s", resp.Status)
+		return "", newUpstreamError(serviceSaveFiles, req, resp)
 	}
 
 	var result struct {
@@ -112,7 +127,7 @@ func ExtractUserIDFromToken(tokenString string) (primitive.ObjectID, error) {
 	if strings.HasPrefix(strings.ToLower(strings.TrimSpace(tokenString)), "bearer") {
 		cleanToken, err := GetTokenFromBearerString(tokenString)
 		if err != nil {
-			return primitive.NilObjectID, fmt.Errorf("error extracting token from bearer string: %v", err)
+			return primitive.NilObjectID, fmt.Errorf("error extracting token from bearer string: %w", err)
 		}
 		tokenString = cleanToken
 	}
@@ -120,8 +135,8 @@ func ExtractUserIDFromToken(tokenString string) (primitive.ObjectID, error) {
 	// Parsear el token sin verificar la firma
 	token, _, err := new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{})
 	if err != nil {
-		log.Println("Error parsing token:", err)
-		return primitive.NilObjectID, fmt.Errorf("error parsing token: %v", err)
+		BaseLogger().Debug("Error al parsear el token", "error", err)
+		return primitive.NilObjectID, fmt.Errorf("error parsing token: %v: %w", err, ErrUnauthorized)
 	}
 
 	// Obtener los claims
@@ -131,27 +146,27 @@ func ExtractUserIDFromToken(tokenString string) (primitive.ObjectID, error) {
 			if oid, ok := userID.(string); ok {
 				objectID, err := primitive.ObjectIDFromHex(oid)
 				if err != nil {
-					return primitive.NilObjectID, fmt.Errorf("invalid ObjectID format: %v", err)
+					return primitive.NilObjectID, fmt.Errorf("invalid ObjectID format: %v: %w", err, ErrUnauthorized)
 				}
 				return objectID, nil
 			}
-			return primitive.NilObjectID, fmt.Errorf("userID is not a valid ObjectID")
+			return primitive.NilObjectID, fmt.Errorf("userID is not a valid ObjectID: %w", ErrUnauthorized)
 		}
-		return primitive.NilObjectID, fmt.Errorf("_id not found in token claims")
+		return primitive.NilObjectID, fmt.Errorf("_id not found in token claims: %w", ErrUnauthorized)
 	}
 
-	return primitive.NilObjectID, fmt.Errorf("invalid token claims")
+	return primitive.NilObjectID, fmt.Errorf("invalid token claims: %w", ErrUnauthorized)
 }
 
 func GetTokenFromBearerString(bearerToken string) (string, error) {
 	if bearerToken == "" {
-		return "", fmt.Errorf("no authorization header found")
+		return "", fmt.Errorf("no authorization header found: %w", ErrUnauthorized)
 	}
 
 	// Verificar y extraer el token
 	tokenParts := strings.Split(bearerToken, " ")
 	if len(tokenParts) != 2 {
-		return "", fmt.Errorf("invalid token format")
+		return "", fmt.Errorf("invalid token format: %w", ErrUnauthorized)
 	}
 
 	// Obtener el token
@@ -163,87 +178,156 @@ func GetTokenFromBearerString(bearerToken string) (string, error) {
 // Esta funcion es para guardar imagenes desde una URL de google o facebook
 // Se usa para guardar la imagen de perfil del usuario
 // Se espera que la URL sea una imagen valida y que el email sea el del usuario
-func SaveImageFromUrl(url string, acl string, urlsavefiles string) (string, error) {
-	reqBody, _ := json.Marshal(map[string]string{
+// Con WithLocalFetch la imagen se descarga en este servicio con un SafeFetcher y se sube
+// como cualquier otra imagen; sin opciones se le envía la URL al servicio de archivos.
+// Las solicitudes no llevan el contexto ni las cabeceras de ninguna solicitud; dentro de un
+// handler se usa SaveImageFromUrlWithContext.
+func SaveImageFromUrl(url string, acl string, urlsavefiles string, opts ...UploadOption) (string, error) {
+	return SaveImageFromUrlWithContext(url, acl, urlsavefiles, nil, opts...)
+}
+
+// SaveImageFromUrlWithContext funciona igual que SaveImageFromUrl en nombre de la solicitud de c:
+// la descarga y la subida usan su contexto, el servicio de archivos recibe sus cabeceras
+// (Authorization, Cookie, X-Request-ID...) y los logs llevan su request_id.
+func SaveImageFromUrlWithContext(url string, acl string, urlsavefiles string, c *gin.Context, opts ...UploadOption) (string, error) {
+	cfg := newUploadConfig(c, opts)
+	if cfg.fetcher != nil {
+		return saveFetchedImage(url, cfg)
+	}
+
+	reqBody, err := json.Marshal(map[string]string{
 		"Url":      url,
 		"Kindfile": "images",
 		"Acl":      acl,
 	})
+	if err != nil {
+		return "", err
+	}
 
-	path, err := makePostRequest(urlsavefiles+"ImagesFromUrl", reqBody, "application/json")
-	return path, err
+	return makePostRequest(urlsavefiles+"ImagesFromUrl", reqBody, "application/json", c)
 }
 
 // getContentTypeFromExtension detecta el Content-Type correcto basándose en la extensión del archivo
 func getContentTypeFromExtension(filename string) string {
-	ext := strings.ToLower(filepath.Ext(filename))
-
-	contentTypes := map[string]string{
-		".jpg":  "image/jpeg",
-		".jpeg": "image/jpeg",
-		".png":  "image/png",
-		".gif":  "image/gif",
-		".webp": "image/webp",
-		".svg":  "image/svg+xml",
-		".bmp":  "image/bmp",
-		".ico":  "image/x-icon",
-		".tiff": "image/tiff",
-		".tif":  "image/tiff",
-		".pdf":  "application/pdf",
-		".heic": "image/heic",
-	}
-
-	if contentType, exists := contentTypes[ext]; exists {
+	if contentType := DefaultFileKinds.ContentTypeForExtension(filename); contentType != "" {
 		return contentType
 	}
-
 	return "application/octet-stream"
 }
 
-// createMultipartFormData crea el formulario multipart común para ambos tipos de archivo
-func createMultipartFormData(file *multipart.FileHeader, kindfile string) (*bytes.Buffer, *multipart.Writer, error) {
+// createMultipartFormData crea el formulario multipart común para ambos tipos de archivo.
+// El archivo no se carga en memoria: se lee del FileHeader a medida que se envía la solicitud.
+// filename es el nombre con el que se envía, ya limpio. Si knownSHA256 está vacío, el hash
+// se calcula mientras se envía.
+func createMultipartFormData(file *multipart.FileHeader, filename string, kindfile string, knownSHA256 string) (*multipartBody, error) {
 	fileContent, err := file.Open()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	defer fileContent.Close()
-
-	var reqBody bytes.Buffer
-	writer := multipart.NewWriter(&reqBody)
 
 	// Detectar el Content-Type correcto basado en la extensión del archivo
 	contentType := getContentTypeFromExtension(file.Filename)
 
-	// Crear el campo 'file' con el Content-Type explícito
-	h := make(map[string][]string)
-	h["Content-Disposition"] = []string{`form-data; name="file"; filename="` + file.Filename + `"`}
-	h["Content-Type"] = []string{contentType}
+	// El campo Kindfile va después del archivo, como lo espera el servicio de archivos
+	fields := []formField{{name: "Kindfile", value: kindfile}}
+
+	return newMultipartBody(filename, contentType, file.Size, fileContent, fields, knownSHA256), nil
+}
+
+// createUploadBody crea el formulario del archivo según las opciones de la subida.
+// detected es el Content-Type que prepareFileUpload detectó en el contenido.
+// El nombre se limpia con SanitizeFilename, o se reemplaza con WithGeneratedFilenames.
+// Los SVG siempre se limpian con SanitizeSVG; se reconocen por el contenido y no por la extensión,
+// así un SVG con nombre .txt o .html también se limpia. Con WithStripImageMetadata los JPEG se leen
+// completos para aplicar la orientación y eliminar los metadatos antes de enviarlos.
+// Los demás archivos se envían sin cambios.
+func createUploadBody(file *multipart.FileHeader, kindfile string, detected string, cfg *uploadConfig) (*multipartBody, error) {
+	contentType := getContentTypeFromExtension(file.Filename)
+	filename := cfg.uploadFilename(file.Filename)
+
+	var process func([]byte) ([]byte, error)
+	switch {
+	case normalizeContentType(detected) == "image/svg+xml":
+		contentType = "image/svg+xml"
+		process = SanitizeSVG
+	case cfg.stripMetadata && kindfile == KindImages && contentType == "image/jpeg":
+		process = func(data []byte) ([]byte, error) { return NormalizeJPEG(data, cfg.imageQuality) }
+	case cfg.dedupe != nil:
+		// Para buscar el contenido antes de enviarlo, el hash se calcula en una pasada previa
+		sum, err := hashFileHeader(file)
+		if err != nil {
+			return nil, err
+		}
+		return createMultipartFormData(file, filename, kindfile, sum)
+	default:
+		return createMultipartFormData(file, filename, kindfile, "")
+	}
+
+	fileContent, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer fileContent.Close()
 
-	part, err := writer.CreatePart(h)
+	data, err := io.ReadAll(fileContent)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	cleaned, err := process(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file.Filename, err)
+	}
+	return newBytesBody(filename, contentType, kindfile, cleaned), nil
+}
 
-	_, err = io.Copy(part, fileContent)
+// uploadFile envía un archivo ya validado al servicio de archivos y retorna su ruta y su SHA-256.
+// kindfile y contentType son los que retornó prepareFileUpload.
+// Con WithDedupe, si el mismo contenido ya se guardó se retorna esa ruta sin enviar los bytes.
+func uploadFile(urlsavefiles string, file *multipart.FileHeader, kindfile string, contentType string, cfg *uploadConfig, c *gin.Context) (*UploadResult, error) {
+	// Sin scope, la ruta de un usuario se reutilizaría para otro y eliminarla al actualizar
+	// dejaría al otro registro sin archivo
+	if cfg.dedupe != nil && cfg.dedupeScope == "" {
+		return nil, errDedupeScopeRequired
+	}
+
+	reqBody, err := createUploadBody(file, kindfile, contentType, cfg)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+
+	var key string
+	if cfg.dedupe != nil {
+		key = dedupeKey(cfg.dedupeScope, urlsavefiles, kindfile, reqBody.sha256())
+		path, found, err := cfg.dedupe.Lookup(requestContext(c), key)
+		switch {
+		case err != nil:
+			Logger(c).Warn("No se pudo consultar el almacén de deduplicación", "error", err)
+		case found:
+			reqBody.reader.Close()
+			Logger(c).Info("Archivo ya guardado, se reutiliza la ruta", "filename", file.Filename, "file_path", path)
+			return &UploadResult{Path: path, SHA256: reqBody.sha256(), Deduplicated: true}, nil
+		}
 	}
 
-	// Agregar el campo Kindfile
-	err = writer.WriteField("Kindfile", kindfile)
+	path, err := executeFileUploadRequest(urlsavefiles, reqBody, c)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	writer.Close()
-	return &reqBody, writer, nil
+	if cfg.dedupe != nil {
+		if err := cfg.dedupe.Remember(requestContext(c), key, path); err != nil {
+			Logger(c).Warn("No se pudo registrar el archivo para deduplicación", "file_path", path, "error", err)
+		}
+	}
+	return &UploadResult{Path: path, SHA256: reqBody.sha256()}, nil
 }
 
 // executeFileUploadRequest realiza la petición HTTP común para subir archivos
-func executeFileUploadRequest(url string, body *bytes.Buffer, writer *multipart.Writer, c *gin.Context) (string, error) {
+func executeFileUploadRequest(url string, body *multipartBody, c *gin.Context) (string, error) {
 	// Preparar la solicitud al servicio de archivos
-	req, err := http.NewRequest("POST", url, nil)
+	req, err := http.NewRequest("POST", url, body.reader)
 	if err != nil {
+		body.reader.Close()
 		return "", err
 	}
 
@@ -251,14 +335,12 @@ func executeFileUploadRequest(url string, body *bytes.Buffer, writer *multipart.
 	headers := ExtractHeaders(c)
 	ApplyHeaders(req, headers)
 
-	// Establecer el tipo de contenido
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Body = io.NopCloser(body)
-	req.ContentLength = int64(body.Len())
+	// Establecer el tipo de contenido; con ContentLength -1 el cuerpo se envía chunked
+	req.Header.Set("Content-Type", body.contentType)
+	req.ContentLength = body.contentLength
 
 	// Hacer la solicitud HTTP
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := doDownstream(requestContext(c), serviceSaveFiles, "upload", req)
 	if err != nil {
 		return "", err
 	}
@@ -266,8 +348,7 @@ func executeFileUploadRequest(url string, body *bytes.Buffer, writer *multipart.
 
 	// Verificar la respuesta
 	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("received non-OK HTTP status: %s, response: %s", resp.Status, string(bodyBytes))
+		return "", newUpstreamError(serviceSaveFiles, req, resp)
 	}
 
 	var result struct {
@@ -280,182 +361,172 @@ func executeFileUploadRequest(url string, body *bytes.Buffer, writer *multipart.
 	return result.Result, nil
 }
 
-// detectFileKind detecta el tipo de archivo basándose en contenido y extensión
-func detectFileKind(file *multipart.FileHeader) (string, error) {
-	fileContent, err := file.Open()
+// detectFileKind detecta el tipo de archivo por sus bytes mágicos y lo compara con la extensión.
+// Retorna el Kindfile y el Content-Type detectado, o un *ContentMismatchError si no coinciden.
+func detectFileKind(file *multipart.FileHeader) (string, string, error) {
+	result, err := SniffFile(file)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
-	defer fileContent.Close()
 
-	// Detectar el tipo de archivo
-	buffer := make([]byte, 512)
-	_, err = fileContent.Read(buffer)
-	if err != nil {
-		return "", err
+	if err := result.Verify(file.Filename); err != nil {
+		return "", result.Detected, err
 	}
 
-	contentType := http.DetectContentType(buffer)
-	return GetFileKind(contentType, file.Filename), nil
+	return GetFileKind(result.Detected, file.Filename), result.Detected, nil
 }
 
 ///////////////////////////////////////////////////////////////
 //				Seccion de manejo de archivos
 ///////////////////////////////////////////////////////////////
 
-func SaveFiles(urlsavefiles string, c *gin.Context, Filename string) (string, error) {
+func SaveFiles(urlsavefiles string, c *gin.Context, Filename string, opts ...UploadOption) (string, error) {
+	result, err := SaveFilesWithResult(urlsavefiles, c, Filename, opts...)
+	if err != nil {
+		return "", err
+	}
+	return result.Path, nil
+}
 
+// SaveFilesWithResult funciona igual que SaveFiles y además retorna el SHA-256 de los bytes guardados
+// y si la ruta se reutilizó por deduplicación (WithDedupe)
+func SaveFilesWithResult(urlsavefiles string, c *gin.Context, Filename string, opts ...UploadOption) (*UploadResult, error) {
 	file, err := c.FormFile(Filename)
 	if err != nil {
-		log.Println("Error al obtener el archivo del formulario:", err)
-		return "", err
+		Logger(c).Error("Error al obtener el archivo del formulario", "field", Filename, "error", err)
+		return nil, err
 	}
 
-	// Si la URL contiene "Images" o "SavePrivateImages", forzar el tipo como imagen
-	if strings.Contains(urlsavefiles, "Images") || strings.Contains(urlsavefiles, "SavePrivateImages") {
-		return SaveFilesAsImage(file, urlsavefiles, c)
+	// Si la URL contiene "Images" o "SavePrivateImages", forzar el tipo como imagen.
+	// Si no, detectar el tipo de archivo automáticamente. En ambos casos se aplica la política de subida.
+	cfg := newUploadConfig(c, opts)
+	filekind, contentType, err := prepareFileUpload(file, isImageEndpoint(urlsavefiles), cfg)
+	if err != nil {
+		Logger(c).Warn("Archivo rechazado", "filename", file.Filename, "error", err)
+		return nil, err
 	}
 
-	// Detectar el tipo de archivo automáticamente
-	filekind, err := detectFileKind(file)
+	// Ejecutar la petición
+	result, err := uploadFile(urlsavefiles, file, filekind, contentType, cfg, c)
 	if err != nil {
-		log.Println("Error al detectar el tipo de archivo:", err)
-		return "", err
+		Logger(c).Error("Error al guardar el archivo", "url", urlsavefiles, "error", err)
+		return nil, err
 	}
 
-	// Crear el formulario multipart
-	reqBody, writer, err := createMultipartFormData(file, filekind)
+	return result, nil
+}
+
+func SaveFilesAsImage(file *multipart.FileHeader, urlsavefiles string, c *gin.Context, opts ...UploadOption) (string, error) {
+	// Validar que es una imagen y que cumple la política de subida antes de enviar
+	cfg := newUploadConfig(c, opts)
+	filekind, contentType, err := prepareFileUpload(file, true, cfg)
 	if err != nil {
-		log.Println("Error al crear el formulario multipart:", err)
 		return "", err
 	}
 
-	// Construir la URL completa con el endpoint específico
-	fullURL := urlsavefiles
-
-	// Ejecutar la petición
-	path, err := executeFileUploadRequest(fullURL, reqBody, writer, c)
+	// Ejecutar la petición usando la función auxiliar
+	result, err := uploadFile(urlsavefiles, file, filekind, contentType, cfg, c)
 	if err != nil {
-		log.Println("Error al guardar el archivo:", err)
-		log.Println("URL utilizada:", fullURL)
 		return "", err
 	}
+	return result.Path, nil
+}
+
+// validateImageExtension verifica que la extensión del archivo sea de una imagen soportada
+func validateImageExtension(filename string) error {
+	if DefaultFileKinds.KindForExtension(filename) != KindImages {
+		ext := strings.ToLower(filepath.Ext(filename))
+		return fmt.Errorf("el archivo debe ser una imagen válida, extensión recibida: %s: %w", ext, ErrUnsupportedFileType)
+	}
+	return nil
+}
 
-	return path, nil
+// isImageEndpoint indica si la URL de guardado es un endpoint de imágenes ("Images" o "SavePrivateImages")
+func isImageEndpoint(urlsavefiles string) bool {
+	return strings.Contains(urlsavefiles, "Images") || strings.Contains(urlsavefiles, "SavePrivateImages")
 }
 
-func SaveFilesAsImage(file *multipart.FileHeader, urlsavefiles string, c *gin.Context) (string, error) {
-	// Validar que es una imagen por extensión antes de enviar
-	ext := strings.ToLower(filepath.Ext(file.Filename))
-	imageExtensions := map[string]bool{
-		".jpg":  true,
-		".jpeg": true,
-		".png":  true,
-		".gif":  true,
-		".webp": true,
-		".svg":  true,
-		".tiff": true,
-		".tif":  true,
-		".bmp":  true,
-		".ico":  true,
-		".heic": true,
-	}
-
-	if !imageExtensions[ext] {
-		return "", fmt.Errorf("el archivo debe ser una imagen válida, extensión recibida: %s", ext)
-	}
-
-	// Crear el formulario multipart usando la función auxiliar
-	reqBody, writer, err := createMultipartFormData(file, "Images")
+// prepareFileUpload valida el archivo y retorna el Kindfile con el que se envía y el Content-Type
+// detectado en el contenido, que uploadFile usa para decidir si el archivo se limpia.
+// Con forceImage el archivo debe tener extensión de imagen y se envía como "Images".
+// Si la configuración tiene una UploadPolicy, el archivo también debe cumplirla.
+// Con WithScanner, además, se analiza en busca de malware.
+func prepareFileUpload(file *multipart.FileHeader, forceImage bool, cfg *uploadConfig) (string, string, error) {
+	if forceImage {
+		if err := validateImageExtension(file.Filename); err != nil {
+			return "", "", err
+		}
+	}
+
+	filekind, contentType, err := detectFileKind(file)
 	if err != nil {
-		return "", err
+		return "", "", err
+	}
+	if forceImage {
+		filekind = KindImages
 	}
 
-	// Ejecutar la petición usando la función auxiliar
-	return executeFileUploadRequest(urlsavefiles, reqBody, writer, c)
+	// Los SVG que no se pueden limpiar se rechazan antes de subir cualquier archivo
+	if normalizeContentType(contentType) == "image/svg+xml" {
+		if err := checkSVGFile(file); err != nil {
+			return "", "", err
+		}
+	}
+
+	if cfg.policy != nil {
+		if err := cfg.policy.Check(file, filekind, contentType); err != nil {
+			return "", "", err
+		}
+	}
+
+	// El análisis de malware va al final porque es la validación más costosa
+	if err := scanUpload(file, cfg); err != nil {
+		return "", "", err
+	}
+	return filekind, contentType, nil
 }
 
 func DeleteFile(filePath string, domain_server string, c *gin.Context) error {
+	// Obtener las cabeceras comunes desde el contexto de Gin
+	return deleteFileWithHeaders(requestContext(c), filePath, domain_server, ExtractHeaders(c))
+}
+
+// deleteFileWithHeaders elimina el archivo con las cabeceras indicadas. Lo usan DeleteFile y los
+// reintentos de DeletionQueue, que no tienen el contexto de Gin de la solicitud original.
+func deleteFileWithHeaders(ctx context.Context, filePath string, domain_server string, headers map[string]string) error {
 	// Preparar la solicitud al servicio de archivos
-	req, err := http.NewRequest("DELETE", domain_server+"?file_path="+filePath, nil)
+	req, err := http.NewRequest("DELETE", domain_server+"?file_path="+url.QueryEscape(filePath), nil)
 	if err != nil {
-		log.Println("Error al crear la solicitud:", err)
-		return fmt.Errorf("error al crear la solicitud: %v", err)
+		return fmt.Errorf("error al crear la solicitud: %w", err)
 	}
-
-	// Obtener y aplicar cabeceras comunes desde el contexto de Gin
-	headers := ExtractHeaders(c)
 	ApplyHeaders(req, headers)
 
 	// Hacer la solicitud HTTP
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := doDownstream(ctx, serviceSaveFiles, "delete_file", req)
 	if err != nil {
-		return fmt.Errorf("error al realizar la petición: %v", err)
+		return fmt.Errorf("error al realizar la petición: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Verificar la respuesta
 	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("error del servidor al eliminar el archivo: %s - %s", resp.Status, string(bodyBytes))
+		return fmt.Errorf("error del servidor al eliminar el archivo: %w", newUpstreamError(serviceSaveFiles, req, resp))
 	}
 
 	return nil
 }
 
-// GetFileKindImproved mejora la detección de tipos de archivo combinando MIME type y extensión
+// GetFileKindImproved mejora la detección de tipos de archivo combinando MIME type y extensión.
+// El tipo detectado por contenido manda; la extensión solo se usa cuando contentType está vacío.
 func GetFileKind(contentType string, filename string) string {
-	// Primero verificar por extensión de archivo
-	ext := strings.ToLower(filepath.Ext(filename))
-
-	// Extensiones de imagen comunes
-	imageExtensions := map[string]bool{
-		".jpg":  true,
-		".jpeg": true,
-		".png":  true,
-		".gif":  true,
-		".webp": true,
-		".svg":  true,
-		".tiff": true,
-		".tif":  true,
-		".bmp":  true,
-		".ico":  true,
-		".heic": true,
-	}
-
-	// Si la extensión indica que es una imagen, retornar "Images"
-	if imageExtensions[ext] {
-		return "Images"
-	}
-
-	// Verificar por tipo MIME
-	imageTypes := []string{
-		"image/jpeg",
-		"image/png",
-		"image/gif",
-		"image/webp",
-		"image/svg+xml",
-		"image/tiff",
-		"image/jpg",
-		"image/bmp",
-		"image/x-icon",
-		"image/heic",
-	}
-
-	for _, imgType := range imageTypes {
-		if contentType == imgType {
-			return "Images"
-		}
-	}
-
-	// Verificar si es un PDF
-	if contentType == "application/pdf" || ext == ".pdf" {
-		return "Documents"
+	// Primero verificar por tipo MIME en el registro de tipos
+	if mediaType := normalizeContentType(contentType); mediaType != "" {
+		// Si se conoce el contenido, la extensión no cambia la decisión
+		return DefaultFileKinds.KindForContentType(mediaType)
 	}
 
-	// Si no se puede determinar, verificar si la URL sugiere que es para imágenes
-	return ""
+	// Sin contenido detectado, verificar por extensión de archivo
+	return DefaultFileKinds.KindForExtension(filename)
 }
 
 // UpdateFile actualiza un archivo siguiendo el orden: 1. Guardar nuevo archivo, 2. Eliminar archivo viejo
@@ -464,32 +535,23 @@ func GetFileKind(contentType string, filename string) string {
 // - oldFilePath: La ruta del archivo viejo que se va a eliminar
 // - url: URL del servicio donde guardar el nuevo archivo
 // - g: Contexto de Gin
-// Retorna la ruta del nuevo archivo guardado
-func UpdateFile(FileNameHeader string, oldFilePath string, urlSaveFile string, urlDeleteFile string, g *gin.Context) (string, error) {
+// Retorna la ruta del nuevo archivo guardado. Si el archivo viejo no se puede eliminar queda en la
+// cola de reintentos (WithDeletionQueue). Cuando después de guardar hay otra operación que puede
+// fallar, conviene usar BeginFileUpdate para poder revertir.
+func UpdateFile(FileNameHeader string, oldFilePath string, urlSaveFile string, urlDeleteFile string, g *gin.Context, opts ...UploadOption) (string, error) {
 	// Paso 1: Guardar el nuevo archivo
-	log.Printf("Guardando nuevo archivo: %s", FileNameHeader)
-	newFilePath, err := SaveFiles(urlSaveFile, g, FileNameHeader)
+	update, err := BeginFileUpdate(FileNameHeader, oldFilePath, urlSaveFile, urlDeleteFile, g, opts...)
 	if err != nil {
-		log.Printf("Error al guardar el nuevo archivo: %v", err)
-		return "", fmt.Errorf("error al guardar el nuevo archivo: %v", err)
+		return "", err
 	}
 
-	log.Printf("Nuevo archivo guardado exitosamente en: %s", newFilePath)
-
 	// Paso 2: Eliminar el archivo viejo (solo si se guardó exitosamente el nuevo)
-	if oldFilePath != "" {
-		log.Printf("Eliminando archivo viejo: %s", oldFilePath)
-		err = DeleteFile(oldFilePath, urlDeleteFile, g)
-		if err != nil {
-			log.Printf("Advertencia: No se pudo eliminar el archivo viejo '%s': %v", oldFilePath, err)
-			// No retornamos error aquí porque el nuevo archivo ya se guardó exitosamente
-			// Solo logueamos la advertencia
-		} else {
-			log.Printf("Archivo viejo eliminado exitosamente: %s", oldFilePath)
-		}
+	if err := update.Commit(); err != nil {
+		// No retornamos error aquí porque el nuevo archivo ya se guardó exitosamente
+		Logger(g).Warn("No se pudo eliminar el archivo viejo", "file_path", oldFilePath, "error", err)
 	}
 
-	return newFilePath, nil
+	return update.NewPath, nil
 }
 
 ///////////////////////////////////////////////////////////////
@@ -511,8 +573,10 @@ func CORSMiddleware(cors_urls string) gin.HandlerFunc {
 			}
 		}
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Accept, Origin, Cache-Control, X-Requested-With, client-type")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Accept, Origin, Cache-Control, X-Requested-With, client-type, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata, X-HTTP-Method-Override")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH, HEAD")
+		// Los clientes tus del navegador necesitan leer estas cabeceras de las respuestas
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, X-File-Path, X-File-Sha256")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -526,7 +590,7 @@ func CORSMiddleware(cors_urls string) gin.HandlerFunc {
 func TokenCurrentUserID(c *gin.Context) (string, error) {
 	tokenString := c.GetHeader("Authorization")
 	if tokenString == "" {
-		return "", fmt.Errorf("no token provided")
+		return "", fmt.Errorf("no token provided: %w", ErrUnauthorized)
 	}
 
 	token, err := ExtractUserIDFromToken(tokenString)
@@ -544,7 +608,9 @@ func Sha512Encrypt(password string) string {
 	return hex.EncodeToString(hashBytes)
 }
 
-// VerifyCDOwnership verifica si el usuario es propietario del centro deportivo
+// VerifyCDOwnership verifica si el usuario es propietario del centro deportivo.
+// Retorna false sin error cuando el servicio responde que no lo es; si el servicio falla o responde
+// otro status retorna un *UpstreamError, así una caída no se confunde con un usuario sin permisos.
 func VerifyCDOwnership(urlapicd string, idCD string, idPropietario string, c *gin.Context) (bool, error) {
 	headers := ExtractHeaders(c)
 
@@ -554,23 +620,26 @@ func VerifyCDOwnership(urlapicd string, idCD string, idPropietario string, c *gi
 	// Crear solicitud GET
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return false, fmt.Errorf("failed to create request: %v", err)
+		return false, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	ApplyHeaders(req, headers)
 
 	// Enviar solicitud
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := doDownstream(requestContext(c), serviceCD, "verify_ownership", req)
 	if err != nil {
-		return false, fmt.Errorf("failed to make request: %v", err)
+		return false, fmt.Errorf("failed to make request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	// Si el status es 200, el usuario es propietario
-	if resp.StatusCode == http.StatusOK {
+	switch resp.StatusCode {
+	case http.StatusOK:
 		return true, nil
+	case http.StatusForbidden, http.StatusNotFound:
+		// 403 si no es propietario y 404 si el centro deportivo no existe
+		return false, nil
 	}
 
-	return false, nil
+	// Cualquier otro status es una falla del servicio, no una respuesta sobre la propiedad
+	return false, newUpstreamError(serviceCD, req, resp)
 }
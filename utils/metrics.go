@@ -0,0 +1,402 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Buckets por defecto para latencias en segundos y tamaños en bytes
+var (
+	DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	DefaultSizeBuckets    = []float64{256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304, 16777216, 67108864}
+)
+
+// collector es cualquier métrica que sabe escribirse en formato de texto de Prometheus
+type collector interface {
+	metricName() string
+	writeTo(w *bufio.Writer)
+}
+
+// MetricsRegistry agrupa las métricas del servicio y las expone en formato de texto de Prometheus
+type MetricsRegistry struct {
+	mu         sync.Mutex
+	collectors []collector
+	names      map[string]bool
+}
+
+// NewMetricsRegistry crea un registro de métricas vacío
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{names: make(map[string]bool)}
+}
+
+// DefaultMetrics es el registro que usan los middlewares y los helpers del paquete
+var DefaultMetrics = NewMetricsRegistry()
+
+func (r *MetricsRegistry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[c.metricName()] {
+		panic(fmt.Sprintf("metric %s already registered", c.metricName()))
+	}
+	r.names[c.metricName()] = true
+	r.collectors = append(r.collectors, c)
+}
+
+// WritePrometheus escribe todas las métricas registradas en formato de texto 0.0.4 de Prometheus
+func (r *MetricsRegistry) WritePrometheus(w io.Writer) error {
+	r.mu.Lock()
+	collectors := make([]collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	r.mu.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].metricName() < collectors[j].metricName()
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.writeTo(bw)
+	}
+	return bw.Flush()
+}
+
+// metricVec contiene lo común a contadores e histogramas: nombre, ayuda y etiquetas
+type metricVec struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+}
+
+func (v *metricVec) metricName() string {
+	return v.name
+}
+
+func (v *metricVec) seriesKey(labelValues []string) string {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func (v *metricVec) writeHeader(w *bufio.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, kind)
+}
+
+// CounterVec es un contador monotónico con etiquetas
+type CounterVec struct {
+	metricVec
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labelValues []string
+	value       float64
+}
+
+// NewCounter registra un contador con las etiquetas indicadas
+func (r *MetricsRegistry) NewCounter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		metricVec: metricVec{name: name, help: help, labels: labels},
+		series:    make(map[string]*counterSeries),
+	}
+	r.register(c)
+	return c
+}
+
+// Inc suma uno al contador de las etiquetas indicadas
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add suma value al contador de las etiquetas indicadas. Los valores negativos se ignoran.
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		return
+	}
+	key := c.seriesKey(labelValues)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, exists := c.series[key]
+	if !exists {
+		s = &counterSeries{labelValues: append([]string(nil), labelValues...)}
+		c.series[key] = s
+	}
+	s.value += value
+}
+
+func (c *CounterVec) writeTo(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writeHeader(w, "counter")
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, s.labelValues, "", ""), formatValue(s.value))
+	}
+}
+
+// HistogramVec es un histograma con buckets acumulados y etiquetas
+type HistogramVec struct {
+	metricVec
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+// NewHistogram registra un histograma con los buckets y etiquetas indicados
+func (r *MetricsRegistry) NewHistogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	h := &HistogramVec{
+		metricVec: metricVec{name: name, help: help, labels: labels},
+		buckets:   sorted,
+		series:    make(map[string]*histogramSeries),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe registra una observación en el histograma de las etiquetas indicadas
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := h.seriesKey(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, exists := h.series[key]
+	if !exists {
+		s = &histogramSeries{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+
+	for i, upperBound := range h.buckets {
+		if value <= upperBound {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+func (h *HistogramVec) writeTo(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w, "histogram")
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		for i, upperBound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, s.labelValues, "le", formatValue(upperBound)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, s.labelValues, "", ""), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, s.labelValues, "", ""), s.count)
+	}
+}
+
+// GaugeVec es un valor que sube y baja, con etiquetas
+type GaugeVec struct {
+	metricVec
+	series map[string]*counterSeries
+}
+
+// NewGauge registra un gauge con las etiquetas indicadas
+func (r *MetricsRegistry) NewGauge(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{
+		metricVec: metricVec{name: name, help: help, labels: labels},
+		series:    make(map[string]*counterSeries),
+	}
+	r.register(g)
+	return g
+}
+
+// Set fija el valor del gauge de las etiquetas indicadas
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	key := g.seriesKey(labelValues)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s, exists := g.series[key]
+	if !exists {
+		s = &counterSeries{labelValues: append([]string(nil), labelValues...)}
+		g.series[key] = s
+	}
+	s.value = value
+}
+
+func (g *GaugeVec) writeTo(w *bufio.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.writeHeader(w, "gauge")
+	for _, key := range sortedKeys(g.series) {
+		s := g.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labels, s.labelValues, "", ""), formatValue(s.value))
+	}
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatLabels arma el bloque {a="x",b="y"}; extraName/extraValue agregan una etiqueta adicional como le
+func formatLabels(names []string, values []string, extraName string, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(values[i]))
+		b.WriteByte('"')
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extraName)
+		b.WriteString(`="`)
+		b.WriteString(extraValue)
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+///////////////////////////////////////////////////////////////
+//				Métricas HTTP y de servicios
+///////////////////////////////////////////////////////////////
+
+var (
+	httpRequestsTotal = DefaultMetrics.NewCounter(
+		"duelig_http_requests_total",
+		"Total de solicitudes HTTP atendidas.",
+		"method", "route", "status")
+	httpRequestDuration = DefaultMetrics.NewHistogram(
+		"duelig_http_request_duration_seconds",
+		"Latencia de las solicitudes HTTP atendidas.",
+		DefaultLatencyBuckets, "method", "route", "status")
+	httpRequestSize = DefaultMetrics.NewHistogram(
+		"duelig_http_request_size_bytes",
+		"Tamaño del cuerpo de las solicitudes HTTP recibidas.",
+		DefaultSizeBuckets, "method", "route")
+	httpResponseSize = DefaultMetrics.NewHistogram(
+		"duelig_http_response_size_bytes",
+		"Tamaño del cuerpo de las respuestas HTTP enviadas.",
+		DefaultSizeBuckets, "method", "route")
+
+	downstreamRequestsTotal = DefaultMetrics.NewCounter(
+		"duelig_downstream_requests_total",
+		"Total de llamadas a otros servicios de Duelig por operación y resultado.",
+		"service", "operation", "status")
+	downstreamRequestDuration = DefaultMetrics.NewHistogram(
+		"duelig_downstream_request_duration_seconds",
+		"Latencia de las llamadas a otros servicios de Duelig.",
+		DefaultLatencyBuckets, "service", "operation")
+)
+
+// MetricsMiddleware registra cantidad, latencia y tamaños de cada solicitud
+// usando la plantilla de la ruta (por ejemplo /api/v1/cd/:id) para no disparar la cardinalidad.
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		status := strconv.Itoa(c.Writer.Status())
+
+		httpRequestsTotal.Inc(method, route, status)
+		httpRequestDuration.Observe(time.Since(start).Seconds(), method, route, status)
+		if c.Request.ContentLength >= 0 {
+			httpRequestSize.Observe(float64(c.Request.ContentLength), method, route)
+		}
+		if size := c.Writer.Size(); size >= 0 {
+			httpResponseSize.Observe(float64(size), method, route)
+		}
+	}
+}
+
+// MetricsHandler expone DefaultMetrics en formato de texto de Prometheus, normalmente en /metrics
+func MetricsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.Status(http.StatusOK)
+		if err := DefaultMetrics.WritePrometheus(c.Writer); err != nil {
+			Logger(c).Error("Error al escribir las métricas", "error", err)
+		}
+	}
+}
+
+// recordDownstream registra el resultado de una llamada a otro servicio.
+// Las fallas de red se registran con status "error".
+func recordDownstream(service string, operation string, start time.Time, resp *http.Response, err error) {
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	downstreamRequestsTotal.Inc(service, operation, status)
+	downstreamRequestDuration.Observe(time.Since(start).Seconds(), service, operation)
+}
@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMetricsRegistryWritePrometheus(t *testing.T) {
+	tests := []struct {
+		name   string
+		record func(r *MetricsRegistry)
+		want   []string
+	}{
+		{
+			name: "contador",
+			record: func(r *MetricsRegistry) {
+				counter := r.NewCounter("jobs_total", "Trabajos procesados.", "queue", "result")
+				counter.Inc("files", "ok")
+				counter.Add(2, "files", "ok")
+				counter.Add(-5, "files", "ok")
+				counter.Inc("files", "error")
+			},
+			want: []string{
+				"# HELP jobs_total Trabajos procesados.",
+				"# TYPE jobs_total counter",
+				`jobs_total{queue="files",result="error"} 1`,
+				`jobs_total{queue="files",result="ok"} 3`,
+			},
+		},
+		{
+			name: "histograma con buckets acumulados",
+			record: func(r *MetricsRegistry) {
+				histogram := r.NewHistogram("latency_seconds", "Latencia.", []float64{1, 0.1}, "op")
+				histogram.Observe(0.05, "get")
+				histogram.Observe(0.5, "get")
+				histogram.Observe(3, "get")
+			},
+			want: []string{
+				"# TYPE latency_seconds histogram",
+				`latency_seconds_bucket{op="get",le="0.1"} 1`,
+				`latency_seconds_bucket{op="get",le="1"} 2`,
+				`latency_seconds_bucket{op="get",le="+Inf"} 3`,
+				`latency_seconds_sum{op="get"} 3.55`,
+				`latency_seconds_count{op="get"} 3`,
+			},
+		},
+		{
+			name: "gauge sin etiquetas",
+			record: func(r *MetricsRegistry) {
+				gauge := r.NewGauge("queue_depth", "Profundidad.")
+				gauge.Set(4)
+				gauge.Set(math.Inf(1))
+			},
+			want: []string{"# TYPE queue_depth gauge", "queue_depth +Inf"},
+		},
+		{
+			name: "escapes de ayuda y etiquetas",
+			record: func(r *MetricsRegistry) {
+				r.NewCounter("escaped_total", "Línea 1\nlínea 2 \\ fin", "value").Inc("a\"b\\c\nd")
+			},
+			want: []string{
+				`# HELP escaped_total Línea 1\nlínea 2 \\ fin`,
+				`escaped_total{value="a\"b\\c\nd"} 1`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewMetricsRegistry()
+			tt.record(registry)
+
+			var buf bytes.Buffer
+			if err := registry.WritePrometheus(&buf); err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			for _, want := range tt.want {
+				if !containsLine(lines, want) {
+					t.Errorf("falta la línea %q en:\n%s", want, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func containsLine(lines []string, want string) bool {
+	for _, line := range lines {
+		if line == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMetricsRegistryPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(r *MetricsRegistry)
+	}{
+		{"nombre repetido", func(r *MetricsRegistry) {
+			r.NewCounter("dup_total", "a")
+			r.NewGauge("dup_total", "b")
+		}},
+		{"cantidad de etiquetas incorrecta", func(r *MetricsRegistry) {
+			r.NewCounter("labels_total", "a", "x", "y").Inc("solo-una")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("se esperaba un panic")
+				}
+			}()
+			tt.run(NewMetricsRegistry())
+		})
+	}
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(MetricsMiddleware())
+	router.GET("/metrics-test/:id", func(c *gin.Context) { c.String(http.StatusTeapot, "hola") })
+	router.GET("/metrics", MetricsHandler())
+
+	for _, path := range []string{"/metrics-test/1", "/metrics-test/2", "/metrics-test-sin-ruta"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", rec.Header().Get("Content-Type"))
+	}
+
+	lines := strings.Split(rec.Body.String(), "\n")
+	for _, want := range []string{
+		// Las rutas se registran con la plantilla de Gin, no con el path
+		`duelig_http_requests_total{method="GET",route="/metrics-test/:id",status="418"} 2`,
+		`duelig_http_response_size_bytes_sum{method="GET",route="/metrics-test/:id"} 8`,
+	} {
+		if !containsLine(lines, want) {
+			t.Errorf("falta la línea %q", want)
+		}
+	}
+	if !strings.Contains(rec.Body.String(), `duelig_http_requests_total{method="GET",route="unmatched",status="404"}`) {
+		t.Error("las rutas que no existen deben registrarse como unmatched")
+	}
+	if strings.Contains(rec.Body.String(), "/metrics-test/1") {
+		t.Error("el path concreto no debe aparecer en las etiquetas")
+	}
+}
@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// formField es un campo de texto del formulario multipart que se envía después del archivo
+type formField struct {
+	name  string
+	value string
+}
+
+// sha256FieldName es el campo del formulario con el SHA-256 del archivo, en hexadecimal
+const sha256FieldName = "Sha256"
+
+// multipartBody es un formulario multipart que se genera a medida que la solicitud lo consume
+type multipartBody struct {
+	reader        io.ReadCloser
+	contentType   string
+	contentLength int64
+
+	mu  sync.Mutex
+	sum string
+}
+
+// sha256 retorna el SHA-256 del archivo en hexadecimal. Si no se conocía de antemano, está disponible
+// cuando el archivo terminó de enviarse; antes retorna "".
+func (b *multipartBody) sha256() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sum
+}
+
+func (b *multipartBody) setSHA256(sum string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sum = sum
+}
+
+// newMultipartBody arma el formulario con el archivo en el campo 'file' seguido de los campos de texto
+// y del campo Sha256. El contenido pasa por un io.Pipe mientras se envía, así que la memoria usada
+// no depende del tamaño del archivo, y el SHA-256 se calcula en la misma pasada salvo que knownSHA256
+// ya lo traiga. Si size es conocido (>= 0) se calcula el Content-Length exacto; si no, la solicitud
+// se envía chunked. content se cierra cuando termina la escritura o cuando se cierra el lector del formulario.
+func newMultipartBody(filename string, contentType string, size int64, content io.ReadCloser, fields []formField, knownSHA256 string) *multipartBody {
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	body := &multipartBody{
+		contentType:   "multipart/form-data; boundary=" + boundary,
+		contentLength: -1,
+		sum:           knownSHA256,
+	}
+
+	if size >= 0 {
+		counter := &countingWriter{}
+		// El formulario sin el contenido del archivo mide lo mismo que el real menos size;
+		// el SHA-256 en hexadecimal siempre mide 64 caracteres
+		if _, err := writeMultipartForm(counter, boundary, filename, contentType, strings.NewReader(""), fields, knownSHA256); err == nil {
+			body.contentLength = counter.n + size
+		}
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer content.Close()
+		sum, err := writeMultipartForm(pw, boundary, filename, contentType, content, fields, knownSHA256)
+		if err == nil {
+			body.setSHA256(sum)
+		}
+		pw.CloseWithError(err)
+	}()
+
+	body.reader = pr
+	return body
+}
+
+// writeMultipartForm escribe el formulario completo con el boundary indicado y retorna el SHA-256
+// del archivo, calculado mientras se copia si knownSHA256 está vacío.
+// Los nombres de campo y de archivo se escapan según RFC 7578, así que un nombre con comillas
+// o saltos de línea no puede cerrar la cabecera ni agregar partes al formulario.
+func writeMultipartForm(w io.Writer, boundary string, filename string, contentType string, content io.Reader, fields []formField, knownSHA256 string) (string, error) {
+	writer := multipart.NewWriter(w)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return "", err
+	}
+
+	// Crear el campo 'file' con el Content-Type explícito
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", `form-data; name="file"; filename="`+escapeFormDataParam(filename)+`"`)
+	h.Set("Content-Type", contentType)
+
+	part, err := writer.CreatePart(h)
+	if err != nil {
+		return "", err
+	}
+
+	sum := knownSHA256
+	if sum == "" {
+		hasher := sha256.New()
+		if _, err := io.Copy(part, io.TeeReader(content, hasher)); err != nil {
+			return "", err
+		}
+		sum = hex.EncodeToString(hasher.Sum(nil))
+	} else if _, err := io.Copy(part, content); err != nil {
+		return "", err
+	}
+
+	for _, field := range append(fields, formField{name: sha256FieldName, value: sum}) {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", `form-data; name="`+escapeFormDataParam(field.name)+`"`)
+		part, err := writer.CreatePart(h)
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.WriteString(part, field.value); err != nil {
+			return "", err
+		}
+	}
+
+	return sum, writer.Close()
+}
+
+// countingWriter cuenta los bytes escritos sin guardarlos
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// newBytesBody crea el formulario de subida para un contenido que ya está en memoria.
+// Como los bytes se conocen, el SHA-256 se calcula antes de enviar.
+func newBytesBody(filename, contentType, kindfile string, data []byte) *multipartBody {
+	fields := []formField{{name: "Kindfile", value: kindfile}}
+	sum := sha256.Sum256(data)
+	return newMultipartBody(filename, contentType, int64(len(data)), io.NopCloser(bytes.NewReader(data)), fields, hex.EncodeToString(sum[:]))
+}
+
+// fileHeaderFromBytes arma un multipart.FileHeader en memoria con el contenido, para que los bytes
+// descargados pasen por las mismas validaciones y la misma subida que un archivo del formulario
+func fileHeaderFromBytes(filename string, data []byte) (*multipart.FileHeader, error) {
+	// Con maxMemory mayor que el archivo, ReadForm lo deja en memoria y no crea archivos temporales
+	file, _, err := fileHeaderFromReader(filename, bytes.NewReader(data), int64(len(data))+1<<20)
+	return file, err
+}
+
+// fileHeaderFromReader arma un multipart.FileHeader con el contenido de r. Si el contenido supera
+// maxMemory, ReadForm lo guarda en un archivo temporal que se elimina con la función retornada.
+func fileHeaderFromReader(filename string, r io.Reader, maxMemory int64) (*multipart.FileHeader, func(), error) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		part, err := writer.CreateFormFile("file", filename)
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	form, err := multipart.NewReader(pr, writer.Boundary()).ReadForm(maxMemory)
+	// Si ReadForm falla, cerrar el lector libera la goroutine que escribe
+	pr.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	// Sin nombre, ReadForm trata la parte como un campo de texto y no como un archivo
+	if len(form.File["file"]) == 0 {
+		form.RemoveAll()
+		return nil, nil, fmt.Errorf("el archivo no tiene nombre: %w", ErrUnsupportedFileType)
+	}
+	return form.File["file"][0], func() { form.RemoveAll() }, nil
+}
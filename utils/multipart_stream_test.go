@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// readMultipartBody lee el formulario completo y retorna los bytes enviados, el archivo y los campos
+func readMultipartBody(t *testing.T, body *multipartBody) ([]byte, []byte, map[string]string) {
+	t.Helper()
+	raw, err := io.ReadAll(body.reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, err := mime.ParseMediaType(body.contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var file []byte
+	fields := make(map[string]string)
+	reader := multipart.NewReader(bytes.NewReader(raw), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(part)
+		if part.FormName() == "file" {
+			file = data
+			continue
+		}
+		fields[part.FormName()] = string(data)
+	}
+	return raw, file, fields
+}
+
+func TestNewMultipartBody(t *testing.T) {
+	content := strings.Repeat("contenido del archivo ", 5000)
+	sum := sha256.Sum256([]byte(content))
+	wantSHA256 := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name        string
+		size        int64
+		knownSHA256 string
+	}{
+		{name: "tamaño conocido", size: int64(len(content))},
+		{name: "tamaño desconocido, chunked", size: -1},
+		{name: "SHA-256 conocido", size: int64(len(content)), knownSHA256: wantSHA256},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := newMultipartBody("reporte.pdf", "application/pdf", tt.size, io.NopCloser(strings.NewReader(content)),
+				[]formField{{name: "Kindfile", value: KindDocuments}}, tt.knownSHA256)
+
+			if tt.size < 0 && body.contentLength != -1 {
+				t.Errorf("contentLength = %d, se esperaba -1 con tamaño desconocido", body.contentLength)
+			}
+			raw, file, fields := readMultipartBody(t, body)
+			if tt.size >= 0 && body.contentLength != int64(len(raw)) {
+				t.Errorf("contentLength = %d, el formulario mide %d", body.contentLength, len(raw))
+			}
+			if string(file) != content {
+				t.Error("el archivo del formulario no coincide con el contenido")
+			}
+			if fields["Kindfile"] != KindDocuments || fields[sha256FieldName] != wantSHA256 {
+				t.Errorf("campos inesperados: %v", fields)
+			}
+			if body.sha256() != wantSHA256 {
+				t.Errorf("sha256() = %q, se esperaba %q", body.sha256(), wantSHA256)
+			}
+		})
+	}
+}
+
+// countingReader cuenta los bytes leídos y si se cerró
+type countingReader struct {
+	io.Reader
+	read   atomic.Int64
+	closed atomic.Bool
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.read.Add(int64(n))
+	return n, err
+}
+
+func (r *countingReader) Close() error {
+	r.closed.Store(true)
+	return nil
+}
+
+// El contenido se lee a medida que se consume el formulario, no antes
+func TestMultipartBodyStreams(t *testing.T) {
+	const size = 32 << 20
+	content := &countingReader{Reader: io.LimitReader(zeroReader{}, size)}
+	body := newMultipartBody("datos.bin", "application/octet-stream", size, content, nil, "")
+
+	time.Sleep(50 * time.Millisecond)
+	if read := content.read.Load(); read > 1<<20 {
+		t.Errorf("se leyeron %d bytes antes de consumir el formulario", read)
+	}
+
+	// Cerrar el formulario sin consumirlo libera el contenido
+	body.reader.Close()
+	deadline := time.Now().Add(time.Second)
+	for !content.closed.Load() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !content.closed.Load() {
+		t.Error("el contenido no se cerró al cerrar el formulario")
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestExecuteFileUploadRequestContentLength(t *testing.T) {
+	tests := []struct {
+		name string
+		size int64
+		// wantChunked indica que la solicitud se envía sin Content-Length
+		wantChunked bool
+	}{
+		{name: "tamaño conocido", size: 11},
+		{name: "tamaño desconocido", size: -1, wantChunked: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotLength int64
+			var gotEncoding []string
+			var gotBody int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotLength, gotEncoding = r.ContentLength, r.TransferEncoding
+				data, _ := io.ReadAll(r.Body)
+				gotBody = len(data)
+				json.NewEncoder(w).Encode(map[string]string{"file_path": "Documents/1-notas.txt"})
+			}))
+			defer server.Close()
+
+			body := newMultipartBody("notas.txt", "text/plain", tt.size, io.NopCloser(strings.NewReader("hola mundo\n")),
+				[]formField{{name: "Kindfile", value: KindDocuments}}, "")
+			path, err := executeFileUploadRequest(server.URL, body, newRequestContext(nil))
+			if err != nil || path != "Documents/1-notas.txt" {
+				t.Fatalf("executeFileUploadRequest = %q, %v", path, err)
+			}
+
+			if tt.wantChunked {
+				if gotLength != -1 || len(gotEncoding) == 0 || gotEncoding[0] != "chunked" {
+					t.Errorf("Content-Length %d y Transfer-Encoding %v, se esperaba chunked", gotLength, gotEncoding)
+				}
+				return
+			}
+			if gotLength != body.contentLength || int64(gotBody) != gotLength {
+				t.Errorf("Content-Length = %d y cuerpo de %d bytes, se esperaba %d", gotLength, gotBody, body.contentLength)
+			}
+		})
+	}
+}
+
+func TestFileHeaderFromBytes(t *testing.T) {
+	file, err := fileHeaderFromBytes("foto.png", []byte("contenido"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Filename != "foto.png" || file.Size != int64(len("contenido")) {
+		t.Errorf("FileHeader inesperado: %s de %d bytes", file.Filename, file.Size)
+	}
+
+	if _, err := fileHeaderFromBytes("", []byte("contenido")); !errors.Is(err, ErrUnsupportedFileType) {
+		t.Errorf("sin nombre = %v, se esperaba ErrUnsupportedFileType", err)
+	}
+}
@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PanicEvent describe un panic recuperado durante una solicitud
+type PanicEvent struct {
+	Value     any
+	Stack     []byte
+	RequestID string
+	UserID    string
+	Method    string
+	Route     string
+	Path      string
+	Time      time.Time
+}
+
+// PanicReporter envía los panics recuperados a un sistema de seguimiento de errores
+type PanicReporter interface {
+	ReportPanic(ctx context.Context, event PanicEvent)
+}
+
+// MemoryPanicReporter guarda los panics en memoria. Pensado para las pruebas.
+type MemoryPanicReporter struct {
+	mu     sync.Mutex
+	events []PanicEvent
+}
+
+// NewMemoryPanicReporter crea un reporter en memoria vacío
+func NewMemoryPanicReporter() *MemoryPanicReporter {
+	return &MemoryPanicReporter{}
+}
+
+// ReportPanic guarda el evento
+func (r *MemoryPanicReporter) ReportPanic(ctx context.Context, event PanicEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+// Events retorna una copia de los eventos recibidos
+func (r *MemoryPanicReporter) Events() []PanicEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := make([]PanicEvent, len(r.events))
+	copy(events, r.events)
+	return events
+}
+
+// Reset borra los eventos recibidos
+func (r *MemoryPanicReporter) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = nil
+}
+
+// RecoveryMiddleware recupera los panics de los handlers, registra el stack trace con el
+// X-Request-ID y el usuario, y responde el error JSON estándar incluyendo el request ID.
+// Cada reporter recibe el panic para enviarlo a un sistema de seguimiento de errores.
+func RecoveryMiddleware(reporters ...PanicReporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// net/http usa http.ErrAbortHandler para cortar la respuesta a propósito y lo maneja sin
+			// registrarlo; se relanza para no convertirlo en un 500
+			if err, ok := recovered.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(recovered)
+			}
+
+			event := PanicEvent{
+				Value:     recovered,
+				Stack:     debug.Stack(),
+				RequestID: c.GetHeader("X-Request-ID"),
+				UserID:    contextUserID(c),
+				Method:    c.Request.Method,
+				Route:     c.FullPath(),
+				Path:      c.Request.URL.Path,
+				Time:      time.Now().UTC(),
+			}
+
+			span := trace.SpanFromContext(c.Request.Context())
+			span.RecordError(fmt.Errorf("panic: %v", recovered), trace.WithStackTrace(false))
+			span.SetStatus(codes.Error, "panic")
+
+			if isBrokenPipe(recovered) {
+				// El cliente cerró la conexión: no hay a quién responder
+				Logger(c).Warn("Conexión cerrada por el cliente", "panic", fmt.Sprint(recovered))
+				c.Error(fmt.Errorf("%v", recovered))
+				c.Abort()
+				return
+			}
+
+			Logger(c).Error("Panic recuperado", "panic", fmt.Sprint(recovered), "stack", string(event.Stack))
+			for _, reporter := range reporters {
+				reportPanicSafely(c, reporter, event)
+			}
+
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":      "Internal server error",
+				"request_id": event.RequestID,
+			})
+		}()
+
+		c.Next()
+	}
+}
+
+// reportPanicSafely evita que una falla del reporter tumbe el proceso
+func reportPanicSafely(c *gin.Context, reporter PanicReporter, event PanicEvent) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			Logger(c).Error("Error al reportar el panic", "panic", fmt.Sprint(recovered))
+		}
+	}()
+	reporter.ReportPanic(c.Request.Context(), event)
+}
+
+// isBrokenPipe detecta los panics causados por escribir en una conexión que el cliente cerró
+func isBrokenPipe(recovered any) bool {
+	err, ok := recovered.(error)
+	if !ok {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		var syscallErr *os.SyscallError
+		if errors.As(opErr, &syscallErr) {
+			msg := strings.ToLower(syscallErr.Error())
+			return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// panickingReporter falla al reportar, como un cliente de Sentry mal configurado
+type panickingReporter struct{}
+
+func (panickingReporter) ReportPanic(context.Context, PanicEvent) { panic("reporter roto") }
+
+func TestRecoveryMiddleware(t *testing.T) {
+	brokenPipe := &net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)}
+
+	tests := []struct {
+		name       string
+		value      any
+		wantStatus int
+		// wantReported indica que el panic llega a los reporters y se responde el error estándar
+		wantReported bool
+	}{
+		{"string", "nil map", http.StatusInternalServerError, true},
+		{"error", errors.New("índice fuera de rango"), http.StatusInternalServerError, true},
+		{"error envuelto", fmt.Errorf("handler: %w", errors.New("x")), http.StatusInternalServerError, true},
+		{"conexión cerrada por el cliente", brokenPipe, http.StatusOK, false},
+		{"conexión reiniciada", &net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.ECONNRESET)}, http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reporter := NewMemoryPanicReporter()
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(RequestIDMiddleware(), RecoveryMiddleware(panickingReporter{}, reporter))
+			router.GET("/items/:id", func(c *gin.Context) { panic(tt.value) })
+
+			req := httptest.NewRequest(http.MethodGet, "/items/7", nil)
+			req.Header.Set("X-Request-ID", "req-1")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, se esperaba %d", rec.Code, tt.wantStatus)
+			}
+			events := reporter.Events()
+			if !tt.wantReported {
+				if len(events) != 0 || rec.Body.Len() != 0 {
+					t.Errorf("una conexión cerrada no se reporta ni se responde: %d eventos, cuerpo %q", len(events), rec.Body)
+				}
+				return
+			}
+
+			var body map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body["error"] != "Internal server error" || body["request_id"] != "req-1" {
+				t.Errorf("respuesta inesperada: %v", body)
+			}
+			if len(events) != 1 {
+				t.Fatalf("se esperaba un evento, hay %d", len(events))
+			}
+			event := events[0]
+			if event.Value != tt.value || event.RequestID != "req-1" || event.Route != "/items/:id" || event.Path != "/items/7" || len(event.Stack) == 0 {
+				t.Errorf("evento inesperado: %+v", event)
+			}
+		})
+	}
+}
+
+// http.ErrAbortHandler se relanza para que net/http corte la respuesta sin registrar el panic
+func TestRecoveryMiddlewareRepanicsErrAbortHandler(t *testing.T) {
+	tests := []struct {
+		name  string
+		value error
+	}{
+		{"directo", http.ErrAbortHandler},
+		{"envuelto", fmt.Errorf("proxy: %w", http.ErrAbortHandler)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reporter := NewMemoryPanicReporter()
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(RecoveryMiddleware(reporter))
+			router.GET("/", func(c *gin.Context) { panic(tt.value) })
+
+			rec := httptest.NewRecorder()
+			func() {
+				defer func() {
+					if recovered := recover(); recovered != tt.value {
+						t.Errorf("se relanzó %v, se esperaba %v", recovered, tt.value)
+					}
+				}()
+				router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			}()
+
+			if len(reporter.Events()) != 0 || rec.Body.Len() != 0 {
+				t.Errorf("ErrAbortHandler no se reporta ni se responde: cuerpo %q", rec.Body)
+			}
+		})
+	}
+}
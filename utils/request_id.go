@@ -1,8 +1,6 @@
 package utils
 
 import (
-	"log"
-
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -10,7 +8,8 @@ import (
 // RequestIDMiddleware es un middleware de Gin que asegura que cada solicitud tenga un X-Request-ID único.
 // Si la solicitud entrante ya contiene el header X-Request-ID, se preserva.
 // Si no, se genera un nuevo UUID y se asigna.
-// El ID de correlación se propaga en el header de respuesta y se incluye en los logs.
+// El ID de correlación se propaga en el header de respuesta y se incluye en los logs de Logger(c).
+// La solicitud en sí la registra AccessLogMiddleware.
 func RequestIDMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		requestID := c.Request.Header.Get("X-Request-ID")
@@ -24,8 +23,6 @@ func RequestIDMiddleware() gin.HandlerFunc {
 		// Establecer en el header de la respuesta para que el caller pueda correlacionar
 		c.Writer.Header().Set("X-Request-ID", requestID)
 
-		log.Printf("[%s] %s %s", requestID, c.Request.Method, c.Request.URL.Path)
-
 		c.Next()
 	}
 }
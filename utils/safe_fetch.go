@@ -0,0 +1,325 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Valores por defecto de SafeFetcher
+const (
+	DefaultFetchMaxBytes     = 5 << 20
+	DefaultFetchMaxRedirects = 3
+	DefaultFetchTimeout      = 10 * time.Second
+)
+
+// DefaultAvatarHosts son los hosts de donde Google y Facebook sirven las fotos de perfil.
+// "*.dominio" acepta cualquier subdominio, pero no el dominio mismo.
+var DefaultAvatarHosts = []string{
+	"*.googleusercontent.com",
+	"graph.facebook.com",
+	"platform-lookaside.fbsbx.com",
+	"*.fbcdn.net",
+}
+
+// DefaultAvatarContentTypes son los formatos de imagen que se aceptan al descargar fotos de perfil
+var DefaultAvatarContentTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// blockedPrefixes son los rangos que no son alcanzables desde internet o que apuntan a la red interna,
+// además de los que ya descarta netip.Addr.IsGlobalUnicast
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/23"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+}
+
+// isPublicAddr indica si la dirección es pública. Las IPv4 escritas como IPv6 (::ffff:10.0.0.1)
+// se revisan como IPv4, y NAT64, 6to4 y Teredo se bloquean porque pueden apuntar a una IPv4 interna.
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// FetchedImage es una imagen descargada por SafeFetcher
+type FetchedImage struct {
+	// Filename es "avatar" con la extensión del formato detectado
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// SafeFetcher descarga imágenes de URLs enviadas por clientes sin exponer la red interna (SSRF):
+//   - Solo https, al puerto 443, sin usuario ni contraseña en la URL, y solo a AllowedHosts.
+//   - Cada conexión se revisa después de resolver el DNS: si la IP es privada, loopback,
+//     link-local (169.254.169.254 incluida) o de otro rango reservado, se rechaza.
+//     Así un host permitido que resuelve a una IP interna tampoco pasa.
+//   - Cada redirección se revisa igual, hasta MaxRedirects.
+//   - No usa el proxy del entorno, que haría la conexión por fuera de estas revisiones.
+//   - La respuesta debe ser 200, de un Content-Type de ContentTypes, el contenido debe coincidir
+//     con ese Content-Type y no puede superar MaxBytes.
+//
+// Los campos en cero usan los valores por defecto (DefaultFetch* y DefaultAvatarContentTypes).
+// AllowedHosts no tiene valor por defecto: vacío no permite ningún host.
+type SafeFetcher struct {
+	AllowedHosts []string
+	ContentTypes []string
+	MaxBytes     int64
+	// MaxRedirects es cuántas redirecciones se siguen; negativo no sigue ninguna
+	MaxRedirects int
+	// Timeout limita la conexión, el TLS, la espera de las cabeceras y la descarga completa
+	Timeout time.Duration
+
+	once   sync.Once
+	client *http.Client
+}
+
+// NewAvatarFetcher crea un SafeFetcher para las fotos de perfil de Google y Facebook
+func NewAvatarFetcher() *SafeFetcher {
+	return &SafeFetcher{
+		AllowedHosts: DefaultAvatarHosts,
+		ContentTypes: DefaultAvatarContentTypes,
+		MaxBytes:     DefaultFetchMaxBytes,
+		MaxRedirects: DefaultFetchMaxRedirects,
+		Timeout:      DefaultFetchTimeout,
+	}
+}
+
+func (f *SafeFetcher) contentTypes() []string {
+	if len(f.ContentTypes) == 0 {
+		return DefaultAvatarContentTypes
+	}
+	return f.ContentTypes
+}
+
+func (f *SafeFetcher) maxBytes() int64 {
+	if f.MaxBytes <= 0 {
+		return DefaultFetchMaxBytes
+	}
+	return f.MaxBytes
+}
+
+func (f *SafeFetcher) maxRedirects() int {
+	switch {
+	case f.MaxRedirects < 0:
+		return 0
+	case f.MaxRedirects == 0:
+		return DefaultFetchMaxRedirects
+	}
+	return f.MaxRedirects
+}
+
+func (f *SafeFetcher) timeout() time.Duration {
+	if f.Timeout <= 0 {
+		return DefaultFetchTimeout
+	}
+	return f.Timeout
+}
+
+// httpClient arma el cliente la primera vez que se usa, con la revisión de IP en el dialer
+func (f *SafeFetcher) httpClient() *http.Client {
+	f.once.Do(func() {
+		timeout, maxRedirects := f.timeout(), f.maxRedirects()
+		dialer := &net.Dialer{
+			Timeout: timeout,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				addr, err := netip.ParseAddr(host)
+				if err != nil || !isPublicAddr(addr) {
+					return fmt.Errorf("la dirección %s no es pública: %w", host, ErrUnsafeURL)
+				}
+				return nil
+			},
+		}
+		transport := &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+		}
+		f.client = &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > maxRedirects {
+					return fmt.Errorf("demasiadas redirecciones (máximo %d): %w", maxRedirects, ErrUnsafeURL)
+				}
+				return f.checkURL(req.URL)
+			},
+		}
+	})
+	return f.client
+}
+
+// checkURL revisa el esquema, el puerto, las credenciales y el host de la URL
+func (f *SafeFetcher) checkURL(u *url.URL) error {
+	if u.Scheme != "https" {
+		return fmt.Errorf("solo se aceptan URLs https: %w", ErrUnsafeURL)
+	}
+	if u.User != nil {
+		return fmt.Errorf("la URL no puede incluir credenciales: %w", ErrUnsafeURL)
+	}
+	if port := u.Port(); port != "" && port != "443" {
+		return fmt.Errorf("puerto %s no permitido: %w", port, ErrUnsafeURL)
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if !f.hostAllowed(host) {
+		return fmt.Errorf("host %q no permitido: %w", host, ErrUnsafeURL)
+	}
+	return nil
+}
+
+func (f *SafeFetcher) hostAllowed(host string) bool {
+	if host == "" {
+		return false
+	}
+	for _, allowed := range f.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Fetch descarga la imagen de rawURL con todas las revisiones de SafeFetcher
+func (f *SafeFetcher) Fetch(ctx context.Context, rawURL string) (*FetchedImage, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("URL inválida: %w", ErrUnsafeURL)
+	}
+	if err := f.checkURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("URL inválida: %w", ErrUnsafeURL)
+	}
+	contentTypes, maxBytes := f.contentTypes(), f.maxBytes()
+	req.Header.Set("Accept", strings.Join(contentTypes, ", "))
+
+	resp, err := f.httpClient().Do(req)
+	if err != nil {
+		if errors.Is(err, ErrUnsafeURL) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error al descargar la imagen de %s: %w: %w", u.Host, ErrUpstreamUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// Un 401 o 403 del host remoto no es un problema de sesión del cliente de este servicio
+		sentinel := ErrUpstreamUnavailable
+		if resp.StatusCode == http.StatusNotFound {
+			sentinel = ErrNotFound
+		}
+		return nil, fmt.Errorf("la descarga de la imagen de %s retornó %d: %w", u.Host, resp.StatusCode, sentinel)
+	}
+
+	contentType := normalizeContentType(resp.Header.Get("Content-Type"))
+	if !slices.Contains(contentTypes, contentType) {
+		return nil, fmt.Errorf("tipo de contenido %q no permitido: %w", contentType, ErrUnsupportedFileType)
+	}
+	if resp.ContentLength > maxBytes {
+		return nil, fmt.Errorf("la imagen mide %d bytes y el máximo es %d: %w", resp.ContentLength, maxBytes, ErrFileTooLarge)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("error al leer la imagen de %s: %w: %w", u.Host, ErrUpstreamUnavailable, err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("la imagen supera el máximo de %d bytes: %w", maxBytes, ErrFileTooLarge)
+	}
+
+	if detected := detectContentType(data[:min(len(data), sniffLen)]); detected != contentType {
+		return nil, fmt.Errorf("el contenido es %s pero la respuesta declara %s: %w", detected, contentType, ErrUnsupportedFileType)
+	}
+
+	return &FetchedImage{
+		Filename:    "avatar" + avatarExtensions[contentType],
+		ContentType: contentType,
+		Data:        data,
+	}, nil
+}
+
+// avatarExtensions es la extensión con la que se nombra cada formato descargado
+var avatarExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// saveFetchedImage descarga la imagen con el SafeFetcher de WithLocalFetch y la sube como
+// cualquier imagen del formulario: validación de contenido, política, análisis y deduplicación
+func saveFetchedImage(rawURL string, cfg *uploadConfig) (string, error) {
+	fetched, err := cfg.fetcher.Fetch(requestContext(cfg.c), rawURL)
+	if err != nil {
+		Logger(cfg.c).Warn("No se pudo descargar la imagen", "error", err)
+		return "", err
+	}
+
+	file, err := fileHeaderFromBytes(fetched.Filename, fetched.Data)
+	if err != nil {
+		return "", err
+	}
+
+	filekind, contentType, err := prepareFileUpload(file, true, cfg)
+	if err != nil {
+		Logger(cfg.c).Warn("Imagen descargada rechazada", "error", err)
+		return "", err
+	}
+
+	result, err := uploadFile(cfg.fetchUploadURL, file, filekind, contentType, cfg, cfg.c)
+	if err != nil {
+		return "", err
+	}
+	return result.Path, nil
+}
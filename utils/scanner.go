@@ -0,0 +1,243 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"strings"
+	"time"
+)
+
+// ScanResult es el resultado del análisis de un archivo
+type ScanResult struct {
+	Clean bool
+	// Signature es el nombre de la amenaza detectada cuando Clean es false
+	Signature string
+}
+
+// Scanner analiza el contenido de un archivo antes de enviarlo al servicio de archivos.
+// Retorna error solo cuando no se pudo analizar; un archivo infectado se reporta en ScanResult.
+type Scanner interface {
+	Scan(ctx context.Context, filename string, r io.Reader) (ScanResult, error)
+}
+
+// ScanFailurePolicy define qué hacer con el archivo cuando el Scanner falla o no responde
+type ScanFailurePolicy int
+
+const (
+	// ScanFailClosed rechaza el archivo con ErrScanUnavailable
+	ScanFailClosed ScanFailurePolicy = iota
+	// ScanFailOpen deja pasar el archivo y registra la falla en el log
+	ScanFailOpen
+)
+
+// InfectedFileError describe un archivo rechazado por el Scanner. Se clasifica como ErrInfected.
+type InfectedFileError struct {
+	Filename  string
+	Signature string
+}
+
+func (e *InfectedFileError) Error() string {
+	return fmt.Sprintf("%s: se detectó %s", e.Filename, e.Signature)
+}
+
+func (e *InfectedFileError) Unwrap() error {
+	return ErrInfected
+}
+
+var uploadScansTotal = DefaultMetrics.NewCounter(
+	"duelig_upload_scans_total",
+	"Total de archivos analizados antes de subirlos, por resultado.",
+	"result")
+
+// scanUpload analiza el archivo con el Scanner de la configuración, si hay uno
+func scanUpload(file *multipart.FileHeader, cfg *uploadConfig) error {
+	if cfg.scanner == nil {
+		return nil
+	}
+
+	fileContent, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer fileContent.Close()
+
+	result, err := cfg.scanner.Scan(requestContext(cfg.c), file.Filename, fileContent)
+	switch {
+	case err != nil && cfg.scanFailure == ScanFailOpen:
+		uploadScansTotal.Inc("error")
+		Logger(cfg.c).Warn("No se pudo analizar el archivo, se acepta sin análisis", "filename", file.Filename, "error", err)
+		return nil
+	case err != nil:
+		uploadScansTotal.Inc("error")
+		Logger(cfg.c).Error("No se pudo analizar el archivo", "filename", file.Filename, "error", err)
+		return fmt.Errorf("%s: %w: %w", file.Filename, ErrScanUnavailable, err)
+	case !result.Clean:
+		uploadScansTotal.Inc("infected")
+		Logger(cfg.c).Warn("Archivo infectado rechazado", "filename", file.Filename, "signature", result.Signature)
+		return &InfectedFileError{Filename: file.Filename, Signature: result.Signature}
+	}
+	uploadScansTotal.Inc("clean")
+	return nil
+}
+
+///////////////////////////////////////////////////////////////
+//				Cliente de ClamAV (clamd)
+///////////////////////////////////////////////////////////////
+
+// Valores por defecto del cliente de clamd
+const (
+	DefaultClamdTimeout   = 30 * time.Second
+	DefaultClamdChunkSize = 64 * 1024
+)
+
+// ClamdScanner analiza archivos con el comando INSTREAM de clamd
+type ClamdScanner struct {
+	// Network es "tcp" o "unix"
+	Network string
+	// Address es host:puerto o la ruta del socket
+	Address string
+	// Timeout limita la conexión y el análisis completo de un archivo
+	Timeout time.Duration
+	// ChunkSize es el tamaño de cada bloque enviado; no debe superar StreamMaxLength de clamd
+	ChunkSize int
+}
+
+// NewClamdScanner crea un cliente de clamd por TCP, por ejemplo NewClamdScanner("clamav:3310")
+func NewClamdScanner(address string) *ClamdScanner {
+	return &ClamdScanner{
+		Network:   "tcp",
+		Address:   address,
+		Timeout:   DefaultClamdTimeout,
+		ChunkSize: DefaultClamdChunkSize,
+	}
+}
+
+// Scan envía el contenido a clamd con INSTREAM y lee el veredicto
+func (s *ClamdScanner) Scan(ctx context.Context, filename string, r io.Reader) (ScanResult, error) {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return ScanResult{}, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return ScanResult{}, fmt.Errorf("clamd: error al enviar INSTREAM: %w", err)
+	}
+
+	chunkSize := s.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultClamdChunkSize
+	}
+	chunk := make([]byte, 4+chunkSize)
+	for {
+		n, readErr := io.ReadFull(r, chunk[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(chunk[:4], uint32(n))
+			if _, err := conn.Write(chunk[:4+n]); err != nil {
+				// clamd cierra la conexión al superar StreamMaxLength; la respuesta explica el motivo
+				return s.readResult(conn, fmt.Errorf("clamd: error al enviar el archivo: %w", err))
+			}
+		}
+		if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+			break
+		}
+		if readErr != nil {
+			return ScanResult{}, fmt.Errorf("clamd: error al leer %s: %w", filename, readErr)
+		}
+	}
+
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return s.readResult(conn, fmt.Errorf("clamd: error al terminar el envío: %w", err))
+	}
+	return s.readResult(conn, nil)
+}
+
+// Ping verifica que clamd responda, para usarlo en los health checks
+func (s *ClamdScanner) Ping(ctx context.Context) error {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("zPING\x00")); err != nil {
+		return fmt.Errorf("clamd: error al enviar PING: %w", err)
+	}
+	reply, err := readClamdReply(conn)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("clamd: respuesta inesperada a PING: %q", reply)
+	}
+	return nil
+}
+
+// dial abre la conexión con el timeout del cliente y del contexto
+func (s *ClamdScanner) dial(ctx context.Context) (net.Conn, error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultClamdTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	network := s.Network
+	if network == "" {
+		network = "tcp"
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, s.Address)
+	if err != nil {
+		return nil, fmt.Errorf("clamd: error al conectar con %s: %w", s.Address, err)
+	}
+	// La fecha límite es la menor entre el timeout del cliente y la del contexto de la solicitud
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// readResult interpreta la respuesta de INSTREAM. sendErr es el error de escritura, si lo hubo,
+// y se retorna cuando clamd no alcanzó a responder.
+func (s *ClamdScanner) readResult(conn net.Conn, sendErr error) (ScanResult, error) {
+	reply, err := readClamdReply(conn)
+	if err != nil {
+		if sendErr != nil {
+			return ScanResult{}, sendErr
+		}
+		return ScanResult{}, err
+	}
+
+	// Respuestas: "stream: OK", "stream: <firma> FOUND" o "<mensaje> ERROR"
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return ScanResult{Clean: true}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return ScanResult{Clean: false, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	}
+	return ScanResult{}, fmt.Errorf("clamd: %s", reply)
+}
+
+// readClamdReply lee una respuesta terminada en NUL (comandos con prefijo z)
+func readClamdReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(io.LimitReader(conn, 4096)).ReadBytes(0)
+	if err != nil && (!errors.Is(err, io.EOF) || len(reply) == 0) {
+		return "", fmt.Errorf("clamd: error al leer la respuesta: %w", err)
+	}
+	reply = bytes.TrimRight(reply, "\x00")
+	if len(reply) == 0 {
+		return "", fmt.Errorf("clamd: respuesta vacía: %w", io.ErrUnexpectedEOF)
+	}
+	return strings.TrimSpace(string(reply)), nil
+}
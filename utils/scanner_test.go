@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/edwinrubio/DueligUtils/testhelpers/fakes"
+)
+
+// clamdReplying levanta un servidor TCP que lee el comando, y el archivo si es INSTREAM, y responde
+// reply tal cual. Retorna su dirección.
+func clamdReplying(t *testing.T, reply string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			reader := bufio.NewReader(conn)
+			if command, _ := reader.ReadString(0); command == "zINSTREAM\x00" {
+				var size [4]byte
+				for {
+					if _, err := io.ReadFull(reader, size[:]); err != nil || binary.BigEndian.Uint32(size[:]) == 0 {
+						break
+					}
+					io.CopyN(io.Discard, reader, int64(binary.BigEndian.Uint32(size[:])))
+				}
+			}
+			conn.Write([]byte(reply))
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestClamdScannerScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		// setup configura el fake y retorna la dirección a la que se conecta el scanner
+		setup         func(t *testing.T, clamd *fakes.Clamd) string
+		wantClean     bool
+		wantSignature string
+		wantErr       string
+	}{
+		{name: "archivo limpio", content: strings.Repeat("contenido ", 100), wantClean: true},
+		{name: "EICAR", content: "inicio " + fakes.EICAR + " fin", wantSignature: "Eicar-Test-Signature"},
+		{
+			name: "firma registrada", content: "MZ cargamento malicioso",
+			setup: func(t *testing.T, clamd *fakes.Clamd) string {
+				clamd.AddSignature("Win.Trojan.Test", []byte("cargamento"))
+				return clamd.Addr()
+			},
+			wantSignature: "Win.Trojan.Test",
+		},
+		{
+			name: "supera StreamMaxLength", content: strings.Repeat("x", 1000),
+			setup: func(t *testing.T, clamd *fakes.Clamd) string {
+				clamd.SetStreamMaxLength(100)
+				return clamd.Addr()
+			},
+			wantErr: "size limit exceeded",
+		},
+		{
+			name: "respuesta malformada", content: "hola",
+			setup:   func(t *testing.T, _ *fakes.Clamd) string { return clamdReplying(t, "stream: ???\x00") },
+			wantErr: "clamd: ???",
+		},
+		{
+			name: "respuesta vacía", content: "hola",
+			setup:   func(t *testing.T, _ *fakes.Clamd) string { return clamdReplying(t, "\x00") },
+			wantErr: "respuesta vacía",
+		},
+		{
+			name: "conexión cerrada sin responder", content: "hola",
+			setup: func(t *testing.T, clamd *fakes.Clamd) string {
+				clamd.DropNext(1)
+				return clamd.Addr()
+			},
+			wantErr: "clamd:",
+		},
+		{
+			name: "timeout", content: "hola",
+			setup: func(t *testing.T, clamd *fakes.Clamd) string {
+				clamd.SetDelay(500 * time.Millisecond)
+				return clamd.Addr()
+			},
+			wantErr: "timeout",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clamd := fakes.NewClamd()
+			defer clamd.Close()
+			addr := clamd.Addr()
+			if tt.setup != nil {
+				addr = tt.setup(t, clamd)
+			}
+
+			scanner := NewClamdScanner(addr)
+			scanner.Timeout = 100 * time.Millisecond
+			// Bloques pequeños para que el contenido viaje en varios fragmentos de INSTREAM
+			scanner.ChunkSize = 64
+			result, err := scanner.Scan(context.Background(), "archivo.bin", strings.NewReader(tt.content))
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Scan = %+v, %v; se esperaba un error con %q", result, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+			if result.Clean != tt.wantClean || result.Signature != tt.wantSignature {
+				t.Errorf("Scan = %+v, se esperaba Clean %v y firma %q", result, tt.wantClean, tt.wantSignature)
+			}
+			if scanned := clamd.Scanned(); len(scanned) != 1 || string(scanned[0]) != tt.content {
+				t.Error("clamd no recibió el contenido completo")
+			}
+		})
+	}
+}
+
+func TestClamdScannerPing(t *testing.T) {
+	clamd := fakes.NewClamd()
+	defer clamd.Close()
+	scanner := NewClamdScanner(clamd.Addr())
+
+	if err := scanner.Ping(context.Background()); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+	clamd.DropNext(1)
+	if err := scanner.Ping(context.Background()); err == nil {
+		t.Error("Ping debe fallar si clamd no responde")
+	}
+	if err := NewClamdScanner(clamdReplying(t, "PING\x00")).Ping(context.Background()); err == nil {
+		t.Error("Ping debe fallar con una respuesta distinta de PONG")
+	}
+}
+
+func TestSaveFilesWithScanner(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		policy  ScanFailurePolicy
+		// slow hace que clamd tarde más que el timeout del scanner
+		slow       bool
+		wantErr    error
+		wantStatus int
+	}{
+		{name: "limpio", content: testText, policy: ScanFailClosed},
+		{name: "infectado", content: fakes.EICAR, policy: ScanFailOpen, wantErr: ErrInfected, wantStatus: http.StatusUnprocessableEntity},
+		{name: "clamd no responde, fail-open", content: testText, policy: ScanFailOpen, slow: true},
+		{name: "clamd no responde, fail-closed", content: testText, policy: ScanFailClosed, slow: true, wantErr: ErrScanUnavailable, wantStatus: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saveFiles := fakes.NewSaveFiles()
+			defer saveFiles.Close()
+			clamd := fakes.NewClamd()
+			defer clamd.Close()
+			if tt.slow {
+				clamd.SetDelay(500 * time.Millisecond)
+			}
+			scanner := NewClamdScanner(clamd.Addr())
+			scanner.Timeout = 100 * time.Millisecond
+
+			c := newFormContext(t, "file", "datos.txt", []byte(tt.content))
+			path, err := SaveFiles(saveFiles.URL+"/SaveFiles", c, "file", WithScanner(scanner, tt.policy))
+
+			if tt.wantErr == nil {
+				if err != nil || !saveFiles.HasFile(path) {
+					t.Fatalf("SaveFiles = %q, %v; se esperaba guardar el archivo", path, err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) || HTTPStatusFromError(err) != tt.wantStatus {
+				t.Fatalf("SaveFiles = %v (%d), se esperaba %v (%d)", err, HTTPStatusFromError(err), tt.wantErr, tt.wantStatus)
+			}
+			var infected *InfectedFileError
+			if errors.Is(tt.wantErr, ErrInfected) && (!errors.As(err, &infected) || infected.Signature != "Eicar-Test-Signature") {
+				t.Errorf("se esperaba un *InfectedFileError con la firma de EICAR: %v", err)
+			}
+			if len(saveFiles.Requests()) != 0 {
+				t.Error("el archivo rechazado no debe llegar al servicio de archivos")
+			}
+		})
+	}
+}
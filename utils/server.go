@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/edwinrubio/DueligUtils/health"
+	"github.com/gin-gonic/gin"
+)
+
+// Valores por defecto de ServerConfig
+const (
+	DefaultServerAddr      = ":8080"
+	DefaultReadTimeout     = 30 * time.Second
+	DefaultWriteTimeout    = 60 * time.Second
+	DefaultIdleTimeout     = 120 * time.Second
+	DefaultShutdownTimeout = 20 * time.Second
+)
+
+// ServerConfig define el servidor HTTP estándar de los servicios de Duelig
+type ServerConfig struct {
+	// Addr es la dirección donde escucha el servidor. Por defecto ":8080".
+	Addr string
+	// Mode es el modo de Gin (debug, release, test). Si está vacío no se modifica.
+	Mode string
+	// CORSOrigins son los orígenes permitidos separados por coma, como en CORSMiddleware
+	CORSOrigins string
+	// Health es el registro de chequeos de dependencias. Si es nil se crea uno vacío.
+	Health *health.Registry
+	// EnableTracing agrega TracingMiddleware a la cadena. Requiere haber llamado a InitTracing.
+	EnableTracing bool
+	// EnableMetrics agrega MetricsMiddleware y expone /metrics
+	EnableMetrics bool
+	// AccessLog configura el log de acceso. Si es nil se usa la configuración por defecto,
+	// que solo registra el 1% de los chequeos de salud exitosos.
+	AccessLog *AccessLogConfig
+	// PanicReporters reciben los panics recuperados por RecoveryMiddleware
+	PanicReporters []PanicReporter
+	// Middleware se agrega al final de la cadena estándar, antes de los handlers del servicio
+	Middleware []gin.HandlerFunc
+
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+}
+
+// Server es un *gin.Engine con la cadena de middlewares estándar y apagado ordenado
+type Server struct {
+	*gin.Engine
+	Health *health.Registry
+
+	httpServer      *http.Server
+	shutdownTimeout time.Duration
+
+	mu    sync.Mutex
+	hooks []func(context.Context) error
+}
+
+// NewServer construye el engine con la cadena estándar en este orden:
+// RequestID, Tracing, AccessLog, Metrics, Recovery, CORS y los middlewares adicionales.
+// También monta /health, /health/live, /health/ready y, si se habilitan, /metrics.
+func NewServer(cfg ServerConfig) *Server {
+	if cfg.Mode != "" {
+		gin.SetMode(cfg.Mode)
+	}
+	if cfg.Addr == "" {
+		cfg.Addr = DefaultServerAddr
+	}
+	if cfg.Health == nil {
+		cfg.Health = health.New(health.Options{})
+	}
+	if cfg.AccessLog == nil {
+		cfg.AccessLog = &AccessLogConfig{
+			SampleRates: map[string]float64{
+				"/health":       0.01,
+				"/health/live":  0.01,
+				"/health/ready": 0.01,
+			},
+		}
+	}
+
+	engine := gin.New()
+	engine.Use(RequestIDMiddleware())
+	if cfg.EnableTracing {
+		engine.Use(TracingMiddleware())
+	}
+	engine.Use(AccessLogMiddleware(*cfg.AccessLog))
+	if cfg.EnableMetrics {
+		engine.Use(MetricsMiddleware())
+	}
+	engine.Use(RecoveryMiddleware(cfg.PanicReporters...))
+	engine.Use(CORSMiddleware(cfg.CORSOrigins))
+	engine.Use(cfg.Middleware...)
+
+	cfg.Health.RegisterRoutes(engine)
+	if cfg.EnableMetrics {
+		engine.GET("/metrics", MetricsHandler())
+	}
+
+	return &Server{
+		Engine: engine,
+		Health: cfg.Health,
+		httpServer: &http.Server{
+			Addr:         cfg.Addr,
+			Handler:      engine,
+			ReadTimeout:  durationOrDefault(cfg.ReadTimeout, DefaultReadTimeout),
+			WriteTimeout: durationOrDefault(cfg.WriteTimeout, DefaultWriteTimeout),
+			IdleTimeout:  durationOrDefault(cfg.IdleTimeout, DefaultIdleTimeout),
+		},
+		shutdownTimeout: durationOrDefault(cfg.ShutdownTimeout, DefaultShutdownTimeout),
+	}
+}
+
+func durationOrDefault(value time.Duration, fallback time.Duration) time.Duration {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// OnShutdown registra una función de limpieza, por ejemplo la desconexión de Mongo.
+// Se ejecutan en orden inverso al registro, después de drenar las solicitudes en curso.
+func (s *Server) OnShutdown(hook func(context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, hook)
+}
+
+// Run inicia el servidor y bloquea hasta recibir SIGINT o SIGTERM; luego apaga de forma ordenada
+func (s *Server) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return s.RunContext(ctx)
+}
+
+// RunContext inicia el servidor y bloquea hasta que el contexto se cancele; luego apaga de forma ordenada.
+// Si el servidor no puede escuchar, por ejemplo porque el puerto está ocupado, igual ejecuta las
+// funciones de limpieza y retorna el error.
+func (s *Server) RunContext(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	go func() {
+		BaseLogger().Info("Servidor escuchando", "addr", s.httpServer.Addr)
+		if err := s.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+		close(errCh)
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			// El servidor no llegó a escuchar, pero las conexiones a Mongo o el tracer ya están abiertos
+			BaseLogger().Error("Error al iniciar el servidor HTTP", "addr", s.httpServer.Addr, "error", err)
+			hooksCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+			defer cancel()
+			return errors.Join(append([]error{err}, s.runShutdownHooks(hooksCtx)...)...)
+		}
+	case <-ctx.Done():
+		BaseLogger().Info("Señal de apagado recibida, drenando solicitudes")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	return s.Shutdown(shutdownCtx)
+}
+
+// Shutdown deja de aceptar conexiones, espera las solicitudes en curso y ejecuta las funciones de limpieza
+func (s *Server) Shutdown(ctx context.Context) error {
+	var errs []error
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		BaseLogger().Error("Error al apagar el servidor HTTP", "error", err)
+		errs = append(errs, err)
+	}
+
+	errs = append(errs, s.runShutdownHooks(ctx)...)
+
+	BaseLogger().Info("Servidor apagado")
+	return errors.Join(errs...)
+}
+
+// runShutdownHooks ejecuta las funciones de limpieza en orden inverso y retorna sus errores
+func (s *Server) runShutdownHooks(ctx context.Context) []error {
+	s.mu.Lock()
+	hooks := make([]func(context.Context) error, len(s.hooks))
+	copy(hooks, s.hooks)
+	s.mu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i](ctx); err != nil {
+			BaseLogger().Error("Error en una función de limpieza", "error", err)
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
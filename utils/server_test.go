@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestServerRunContextRunsShutdownHooks(t *testing.T) {
+	hookErr := errors.New("no se pudo desconectar mongo")
+
+	tests := []struct {
+		name string
+		// occupied hace que el puerto ya esté en uso y ListenAndServe falle
+		occupied bool
+		wantErr  []error
+	}{
+		{name: "apagado por contexto", wantErr: []error{hookErr}},
+		{name: "puerto ocupado", occupied: true, wantErr: []error{hookErr}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := "127.0.0.1:0"
+			if tt.occupied {
+				listener, err := net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer listener.Close()
+				addr = listener.Addr().String()
+			}
+
+			server := NewServer(ServerConfig{Addr: addr, Mode: gin.TestMode, ShutdownTimeout: time.Second})
+			var order []string
+			server.OnShutdown(func(context.Context) error {
+				order = append(order, "mongo")
+				return hookErr
+			})
+			server.OnShutdown(func(context.Context) error {
+				order = append(order, "tracer")
+				return nil
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			err := server.RunContext(ctx)
+
+			for _, want := range tt.wantErr {
+				if !errors.Is(err, want) {
+					t.Errorf("RunContext = %v, se esperaba que incluyera %v", err, want)
+				}
+			}
+			var opErr *net.OpError
+			if tt.occupied != errors.As(err, &opErr) {
+				t.Errorf("RunContext = %v; el error de escucha debe retornarse solo si el puerto está ocupado", err)
+			}
+			if !slices.Equal(order, []string{"tracer", "mongo"}) {
+				t.Errorf("funciones de limpieza ejecutadas: %v, se esperaba el orden inverso al registro", order)
+			}
+		})
+	}
+}
+
+func TestNewServerMiddlewareChain(t *testing.T) {
+	server := NewServer(ServerConfig{Mode: gin.TestMode, EnableMetrics: true, AccessLog: &AccessLogConfig{Output: io.Discard}})
+	server.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/health", http.StatusOK},
+		{"/health/live", http.StatusOK},
+		{"/health/ready", http.StatusOK},
+		{"/metrics", http.StatusOK},
+		{"/panic", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("%s = %d, se esperaba %d", tt.path, rec.Code, tt.wantStatus)
+			}
+			if rec.Header().Get("X-Request-ID") == "" {
+				t.Error("la respuesta no tiene X-Request-ID")
+			}
+		})
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+	}{
+		{"se conserva el recibido", "req-cliente"},
+		{"se genera si falta", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureLogs(t, slog.LevelDebug)
+
+			var seen string
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(RequestIDMiddleware())
+			router.GET("/", func(c *gin.Context) { seen = c.GetHeader("X-Request-ID") })
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set("X-Request-ID", tt.incoming)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			returned := rec.Header().Get("X-Request-ID")
+			if returned != seen {
+				t.Errorf("la respuesta tiene %q y el handler vio %q", returned, seen)
+			}
+			if tt.incoming != "" && returned != tt.incoming {
+				t.Errorf("X-Request-ID = %q, se esperaba %q", returned, tt.incoming)
+			}
+			if _, err := uuid.Parse(returned); tt.incoming == "" && err != nil {
+				t.Errorf("el ID generado %q no es un UUID", returned)
+			}
+			// La solicitud la registra AccessLogMiddleware; el middleware no escribe logs propios
+			if buf.Len() != 0 {
+				t.Errorf("RequestIDMiddleware escribió logs: %s", buf.String())
+			}
+		})
+	}
+}
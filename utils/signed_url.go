@@ -0,0 +1,255 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Parámetros del query string de las URLs firmadas. "signature" ya se redacta en los logs de acceso.
+const (
+	signedURLExpiresParam   = "expires"
+	signedURLKeyIDParam     = "kid"
+	signedURLSignatureParam = "signature"
+	// signedURLClaimPrefix antecede a cada claim en el query string: c_user=123
+	signedURLClaimPrefix = "c_"
+)
+
+// MinSigningKeyBytes es el largo mínimo de cada secreto de firma
+const MinSigningKeyBytes = 32
+
+// signedFileContextKey es la clave donde SignedURLMiddleware deja los claims verificados
+const signedFileContextKey = "duelig_signed_file"
+
+// Errores de las URLs firmadas
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpiredURL       = errors.New("signed url expired")
+)
+
+var errNoSigningKeys = errors.New("no hay claves de firma configuradas, se configuran con SetSigningKeys")
+
+// SignedFileClaims son los datos de una URL firmada que ya se verificó
+type SignedFileClaims struct {
+	Path    string
+	Expires time.Time
+	KeyID   string
+	// Claims son los datos que se firmaron junto con la ruta, por ejemplo el usuario o el CDO
+	Claims map[string]string
+}
+
+// SigningKeys son las claves HMAC de las URLs firmadas, identificadas por un ID que viaja en la URL.
+// Se firma con la clave actual y se verifica con cualquiera de las claves. Para rotar:
+//  1. Agregar la clave nueva sin cambiar la actual, en todas las réplicas.
+//  2. Cambiar la actual a la nueva.
+//  3. Cuando vencieron las URLs firmadas con la anterior, quitarla.
+type SigningKeys struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewSigningKeys crea el conjunto de claves. current debe estar en keys y cada secreto debe tener
+// al menos MinSigningKeyBytes bytes.
+func NewSigningKeys(current string, keys map[string][]byte) (*SigningKeys, error) {
+	if _, exists := keys[current]; !exists {
+		return nil, fmt.Errorf("la clave actual %q no está entre las claves de firma", current)
+	}
+
+	copied := make(map[string][]byte, len(keys))
+	for id, secret := range keys {
+		if id == "" {
+			return nil, errors.New("las claves de firma necesitan un ID")
+		}
+		if len(secret) < MinSigningKeyBytes {
+			return nil, fmt.Errorf("la clave de firma %q tiene %d bytes y el mínimo es %d", id, len(secret), MinSigningKeyBytes)
+		}
+		copied[id] = append([]byte(nil), secret...)
+	}
+	return &SigningKeys{current: current, keys: copied}, nil
+}
+
+// defaultSigningKeys son las claves que usan SignFileURL, VerifyFileURL y SignedURLMiddleware
+var defaultSigningKeys atomic.Pointer[SigningKeys]
+
+// SetSigningKeys configura las claves por defecto. Se puede llamar de nuevo para rotarlas.
+func SetSigningKeys(keys *SigningKeys) {
+	defaultSigningKeys.Store(keys)
+}
+
+// SignFileURL firma la ruta de un archivo con las claves por defecto. Ver SigningKeys.Sign.
+func SignFileURL(path string, ttl time.Duration, claims map[string]string) (string, error) {
+	keys := defaultSigningKeys.Load()
+	if keys == nil {
+		return "", errNoSigningKeys
+	}
+	return keys.Sign(path, ttl, claims)
+}
+
+// VerifyFileURL verifica una URL firmada con las claves por defecto. Ver SigningKeys.Verify.
+func VerifyFileURL(signedURL string) (*SignedFileClaims, error) {
+	keys := defaultSigningKeys.Load()
+	if keys == nil {
+		return nil, errNoSigningKeys
+	}
+	return keys.Verify(signedURL)
+}
+
+// Sign retorna la ruta del archivo con el vencimiento, los claims y la firma en el query string:
+//
+//	Documents/12-acta.pdf?c_user=64f1...&expires=1735689600&kid=2024-06&signature=...
+//
+// La ruta es la del servicio de archivos; la aplicación la agrega a la URL de su ruta de descarga.
+func (k *SigningKeys) Sign(path string, ttl time.Duration, claims map[string]string) (string, error) {
+	if ttl <= 0 {
+		return "", fmt.Errorf("el tiempo de vida de la URL debe ser positivo, se recibió %s", ttl)
+	}
+	path = strings.TrimPrefix(path, "/")
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+
+	query := url.Values{}
+	for name, value := range claims {
+		query.Set(signedURLClaimPrefix+name, value)
+	}
+	query.Set(signedURLExpiresParam, expires)
+	query.Set(signedURLKeyIDParam, k.current)
+	query.Set(signedURLSignatureParam, k.signature(k.current, path, expires, claims))
+
+	return escapeFilePath(path) + "?" + query.Encode(), nil
+}
+
+// Verify revisa la firma y el vencimiento de una URL generada con Sign, con o sin host.
+// La ruta firmada es el path completo de la URL sin la "/" inicial; si la ruta de descarga
+// tiene un prefijo (/files/...), se usa VerifyRequest con la ruta del archivo.
+func (k *SigningKeys) Verify(signedURL string) (*SignedFileClaims, error) {
+	u, err := url.Parse(signedURL)
+	if err != nil {
+		return nil, fmt.Errorf("URL firmada inválida: %w", ErrInvalidSignature)
+	}
+	return k.VerifyRequest(strings.TrimPrefix(u.Path, "/"), u.Query())
+}
+
+// VerifyRequest revisa la firma y el vencimiento de la ruta de un archivo con los parámetros recibidos.
+// Los parámetros que no empiezan con c_ ni son de la firma se ignoran y no llegan a los claims.
+func (k *SigningKeys) VerifyRequest(path string, query url.Values) (*SignedFileClaims, error) {
+	path = strings.TrimPrefix(path, "/")
+	keyID := query.Get(signedURLKeyIDParam)
+	expires := query.Get(signedURLExpiresParam)
+	signature := query.Get(signedURLSignatureParam)
+
+	if _, exists := k.keys[keyID]; !exists || signature == "" {
+		return nil, ErrInvalidSignature
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	claims := make(map[string]string)
+	for name, values := range query {
+		if claim, ok := strings.CutPrefix(name, signedURLClaimPrefix); ok {
+			if len(values) != 1 {
+				return nil, ErrInvalidSignature
+			}
+			claims[claim] = values[0]
+		}
+	}
+
+	expected := k.signature(keyID, path, expires, claims)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return nil, ErrInvalidSignature
+	}
+	// El vencimiento se revisa después de la firma para no dar información sobre URLs adulteradas
+	if time.Now().Unix() > expiresAt {
+		return nil, ErrExpiredURL
+	}
+
+	return &SignedFileClaims{
+		Path:    path,
+		Expires: time.Unix(expiresAt, 0),
+		KeyID:   keyID,
+		Claims:  claims,
+	}, nil
+}
+
+// signature calcula el HMAC-SHA256 de la ruta, el vencimiento, el ID de la clave y los claims
+// ordenados, en base64 para URLs. Cada parte va escapada y separada por saltos de línea, así
+// ningún valor puede hacerse pasar por otro.
+func (k *SigningKeys) signature(keyID, path, expires string, claims map[string]string) string {
+	names := make([]string, 0, len(claims))
+	for name := range claims {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("v1\n")
+	b.WriteString(url.QueryEscape(keyID) + "\n")
+	b.WriteString(url.QueryEscape(path) + "\n")
+	b.WriteString(expires)
+	for _, name := range names {
+		b.WriteString("\n" + url.QueryEscape(name) + "=" + url.QueryEscape(claims[name]))
+	}
+
+	mac := hmac.New(sha256.New, k.keys[keyID])
+	mac.Write([]byte(b.String()))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// escapeFilePath escapa cada segmento de la ruta sin escapar los "/"
+func escapeFilePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// SignedURLMiddleware verifica la firma y el vencimiento de las rutas de descarga con las claves
+// por defecto. pathParam es el parámetro comodín de la ruta con la ruta del archivo, por ejemplo
+// "path" en router.GET("/files/*path", ...). Responde 403 si la firma no es válida o venció.
+// Los claims verificados quedan disponibles con SignedFileFromContext.
+func SignedURLMiddleware(pathParam string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys := defaultSigningKeys.Load()
+		if keys == nil {
+			Logger(c).Error("URL firmada sin claves configuradas", "error", errNoSigningKeys)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Signed URLs are not configured"})
+			return
+		}
+
+		claims, err := keys.VerifyRequest(c.Param(pathParam), c.Request.URL.Query())
+		if err != nil {
+			Logger(c).Warn("URL firmada rechazada", "error", err)
+			message := "Invalid signature"
+			if errors.Is(err, ErrExpiredURL) {
+				message = "Signed URL expired"
+			}
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": message})
+			return
+		}
+
+		c.Set(signedFileContextKey, claims)
+		c.Next()
+	}
+}
+
+// SignedFileFromContext obtiene los claims que dejó SignedURLMiddleware
+func SignedFileFromContext(c *gin.Context) (*SignedFileClaims, bool) {
+	value, exists := c.Get(signedFileContextKey)
+	if !exists {
+		return nil, false
+	}
+	claims, ok := value.(*SignedFileClaims)
+	return claims, ok
+}
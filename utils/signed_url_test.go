@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSigningKeys(t *testing.T, current string, ids ...string) *SigningKeys {
+	t.Helper()
+	keys := make(map[string][]byte, len(ids))
+	for _, id := range ids {
+		keys[id] = bytes.Repeat([]byte(id[:1]), MinSigningKeyBytes)
+	}
+	signingKeys, err := NewSigningKeys(current, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingKeys
+}
+
+// withQuery aplica change al query string de una URL firmada
+func withQuery(t *testing.T, signedURL string, change func(url.Values)) string {
+	t.Helper()
+	u, err := url.Parse(signedURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	change(query)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// flipFirst cambia el primer carácter de la firma por otro válido en base64
+func flipFirst(signature string) string {
+	if signature[0] == 'A' {
+		return "B" + signature[1:]
+	}
+	return "A" + signature[1:]
+}
+
+func TestSigningKeysVerify(t *testing.T) {
+	keys := testSigningKeys(t, "a", "a")
+	signed, err := keys.Sign("/Documents/12 acta.pdf", time.Hour, map[string]string{"user": "64f1", "cdo": "9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		url     string
+		wantErr error
+	}{
+		{"válida", signed, nil},
+		{"con host y barra inicial", "https://files.example.com/" + signed, nil},
+		{"otra ruta", strings.Replace(signed, "acta", "actb", 1), ErrInvalidSignature},
+		{"claim cambiado", withQuery(t, signed, func(q url.Values) { q.Set("c_user", "64f2") }), ErrInvalidSignature},
+		{"claim agregado", withQuery(t, signed, func(q url.Values) { q.Set("c_admin", "1") }), ErrInvalidSignature},
+		{"claim quitado", withQuery(t, signed, func(q url.Values) { q.Del("c_cdo") }), ErrInvalidSignature},
+		{"claim repetido", withQuery(t, signed, func(q url.Values) { q.Add("c_user", "64f2") }), ErrInvalidSignature},
+		{"vencimiento extendido", withQuery(t, signed, func(q url.Values) {
+			q.Set("expires", strconv.FormatInt(time.Now().Add(24*time.Hour).Unix(), 10))
+		}), ErrInvalidSignature},
+		{"vencimiento no numérico", withQuery(t, signed, func(q url.Values) { q.Set("expires", "mañana") }), ErrInvalidSignature},
+		{"firma alterada", withQuery(t, signed, func(q url.Values) { q.Set("signature", flipFirst(q.Get("signature"))) }), ErrInvalidSignature},
+		{"sin firma", withQuery(t, signed, func(q url.Values) { q.Del("signature") }), ErrInvalidSignature},
+		{"clave desconocida", withQuery(t, signed, func(q url.Values) { q.Set("kid", "z") }), ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := keys.Verify(tt.url)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Verify = %v, se esperaba %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if claims.Path != "Documents/12 acta.pdf" || claims.KeyID != "a" || claims.Claims["user"] != "64f1" || claims.Claims["cdo"] != "9" {
+				t.Errorf("claims inesperados: %+v", claims)
+			}
+		})
+	}
+}
+
+func TestSigningKeysVerifyExpired(t *testing.T) {
+	keys := testSigningKeys(t, "a", "a")
+	expires := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("kid", "a")
+	query.Set("signature", keys.signature("a", "Documents/acta.pdf", expires, nil))
+
+	if _, err := keys.VerifyRequest("/Documents/acta.pdf", query); !errors.Is(err, ErrExpiredURL) {
+		t.Fatalf("VerifyRequest = %v, se esperaba ErrExpiredURL", err)
+	}
+
+	// Una URL vencida y además adulterada se informa como firma inválida
+	query.Set("expires", strconv.FormatInt(time.Now().Add(-2*time.Minute).Unix(), 10))
+	if _, err := keys.VerifyRequest("/Documents/acta.pdf", query); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("VerifyRequest = %v, se esperaba ErrInvalidSignature", err)
+	}
+
+	if _, err := keys.Sign("Documents/acta.pdf", 0, nil); err == nil {
+		t.Error("Sign debe rechazar un tiempo de vida que no es positivo")
+	}
+}
+
+func TestSigningKeysRotation(t *testing.T) {
+	old := testSigningKeys(t, "old", "old")
+	signedOld, err := old.Sign("Documents/acta.pdf", time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Paso 1: se agrega la clave nueva sin cambiar la actual
+	added := testSigningKeys(t, "old", "old", "new")
+	// Paso 2: la actual pasa a ser la nueva
+	rotated := testSigningKeys(t, "new", "old", "new")
+	signedNew, err := rotated.Sign("Documents/acta.pdf", time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Paso 3: se quita la anterior
+	removed := testSigningKeys(t, "new", "new")
+
+	tests := []struct {
+		name    string
+		keys    *SigningKeys
+		url     string
+		wantKID string
+	}{
+		{"anterior con la nueva agregada", added, signedOld, "old"},
+		{"anterior después de cambiar la actual", rotated, signedOld, "old"},
+		{"nueva después de cambiar la actual", rotated, signedNew, "new"},
+		{"nueva en una réplica con la nueva agregada", added, signedNew, "new"},
+		{"anterior después de quitarla", removed, signedOld, ""},
+		{"nueva en una réplica sin la nueva", old, signedNew, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tt.keys.Verify(tt.url)
+			if tt.wantKID == "" {
+				if !errors.Is(err, ErrInvalidSignature) {
+					t.Fatalf("Verify = %v, se esperaba ErrInvalidSignature", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if claims.KeyID != tt.wantKID {
+				t.Errorf("KeyID = %q, se esperaba %q", claims.KeyID, tt.wantKID)
+			}
+		})
+	}
+
+	// Con otro secreto bajo el mismo ID la firma no coincide
+	other, err := NewSigningKeys("old", map[string][]byte{"old": bytes.Repeat([]byte("x"), MinSigningKeyBytes)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Verify(signedOld); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify con otro secreto = %v, se esperaba ErrInvalidSignature", err)
+	}
+}
+
+func TestNewSigningKeys(t *testing.T) {
+	secret := bytes.Repeat([]byte("s"), MinSigningKeyBytes)
+	tests := []struct {
+		name    string
+		current string
+		keys    map[string][]byte
+		wantErr bool
+	}{
+		{"válidas", "a", map[string][]byte{"a": secret, "b": secret}, false},
+		{"actual ausente", "c", map[string][]byte{"a": secret}, true},
+		{"ID vacío", "a", map[string][]byte{"a": secret, "": secret}, true},
+		{"secreto corto", "a", map[string][]byte{"a": secret[:MinSigningKeyBytes-1]}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSigningKeys(tt.current, tt.keys)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("NewSigningKeys = %v, se esperaba error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// sniffLen es cuántos bytes del inicio del archivo se leen para detectar su tipo
+const sniffLen = 4096
+
+// ErrContentMismatch indica que el contenido del archivo no corresponde a su extensión
+var ErrContentMismatch = errors.New("file content does not match its extension")
+
+// SniffResult compara el tipo detectado por contenido con el declarado por la extensión
+type SniffResult struct {
+	// Detected es el Content-Type según los bytes mágicos del archivo
+	Detected string
+	// Declared es el Content-Type que corresponde a la extensión del nombre
+	Declared string
+	// Match es false cuando la extensión es de un tipo verificable y el contenido no corresponde
+	Match bool
+}
+
+// ContentMismatchError describe un archivo cuyo contenido no corresponde a su extensión.
+// Se clasifica con errors.Is como ErrContentMismatch y ErrUnsupportedFileType.
+type ContentMismatchError struct {
+	Filename string
+	Detected string
+	Declared string
+}
+
+func (e *ContentMismatchError) Error() string {
+	detected := e.Detected
+	if detected == "" {
+		detected = "desconocido"
+	}
+	return fmt.Sprintf("%s: el contenido es %s pero la extensión indica %s", e.Filename, detected, e.Declared)
+}
+
+func (e *ContentMismatchError) Unwrap() []error {
+	return []error{ErrContentMismatch, ErrUnsupportedFileType}
+}
+
+// isoBrand reconoce las cajas ftyp de los formatos ISO BMFF (HEIC, MP4, MOV, M4A)
+// por su major brand o sus brands compatibles
+func isoBrand(brands ...string) func([]byte) bool {
+	return func(header []byte) bool {
+		if len(header) < 12 || string(header[4:8]) != "ftyp" {
+			return false
+		}
+		boxSize := int(header[0])<<24 | int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		if boxSize < 16 || boxSize > len(header) {
+			boxSize = min(len(header), 64)
+		}
+
+		candidates := []string{string(header[8:12])}
+		for i := 16; i+4 <= boxSize; i += 4 {
+			candidates = append(candidates, string(header[i:i+4]))
+		}
+		for _, candidate := range candidates {
+			for _, brand := range brands {
+				if candidate == brand {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// isSVG detecta documentos SVG: texto XML cuyo elemento raíz es svg. Antes de la raíz solo se aceptan
+// espacios, la declaración XML, instrucciones de procesamiento, comentarios y el DOCTYPE; un HTML u otro
+// XML que contenga un <svg más adelante no es un SVG.
+func isSVG(header []byte) bool {
+	text := bytes.TrimPrefix(header, []byte("\xEF\xBB\xBF"))
+	for {
+		text = bytes.TrimLeft(text, " \t\r\n")
+		var end int
+		switch {
+		case bytes.HasPrefix(text, []byte("<?")):
+			end = indexAfter(text, 2, "?>")
+		case bytes.HasPrefix(text, []byte("<!--")):
+			end = indexAfter(text, 4, "-->")
+		case len(text) >= 9 && bytes.EqualFold(text[:9], []byte("<!DOCTYPE")):
+			end = doctypeEnd(text)
+		default:
+			return isSVGRoot(text)
+		}
+		// Una declaración que no cierra dentro del encabezado no deja ver la raíz
+		if end < 0 {
+			return false
+		}
+		text = text[end:]
+	}
+}
+
+// indexAfter retorna la posición siguiente al primer terminator desde from, o -1 si no está
+func indexAfter(text []byte, from int, terminator string) int {
+	i := bytes.Index(text[from:], []byte(terminator))
+	if i < 0 {
+		return -1
+	}
+	return from + i + len(terminator)
+}
+
+// doctypeEnd retorna la posición siguiente al '>' que cierra el DOCTYPE, saltando el subconjunto
+// interno entre corchetes y los valores entre comillas, o -1 si no cierra
+func doctypeEnd(text []byte) int {
+	var quote byte
+	depth := 0
+	for i := 2; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == '>' && depth <= 0:
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// isSVGRoot indica si text empieza con la etiqueta de apertura de un elemento svg, con o sin prefijo
+// de namespace (<svg o <svg:svg)
+func isSVGRoot(text []byte) bool {
+	if len(text) == 0 || text[0] != '<' {
+		return false
+	}
+	end := bytes.IndexAny(text, " \t\r\n/>")
+	if end < 0 {
+		return false
+	}
+	name := text[1:end]
+	if i := bytes.LastIndexByte(name, ':'); i >= 0 {
+		name = name[i+1:]
+	}
+	return bytes.EqualFold(name, []byte("svg"))
+}
+
+// detectContentType retorna el tipo reconocido por las firmas de DefaultFileKinds,
+// o el de http.DetectContentType para los formatos sin firma registrada
+func detectContentType(header []byte) string {
+	if detected := DefaultFileKinds.Detect(header); detected != "" {
+		return detected
+	}
+	if len(header) == 0 {
+		return ""
+	}
+	return http.DetectContentType(header)
+}
+
+// SniffBytes compara el contenido con la extensión de filename.
+// Solo se marca como no coincidente cuando la extensión es de un formato con firma registrada.
+func SniffBytes(header []byte, filename string) SniffResult {
+	if len(header) > sniffLen {
+		header = header[:sniffLen]
+	}
+
+	declared := getContentTypeFromExtension(filename)
+	if DefaultFileKinds.CanVerify(declared) {
+		if DefaultFileKinds.Verify(header, declared) {
+			return SniffResult{Detected: declared, Declared: declared, Match: true}
+		}
+		return SniffResult{Detected: detectContentType(header), Declared: declared, Match: false}
+	}
+
+	detected := detectContentType(header)
+	// Los formatos de texto sin firma (CSV, TXT) se reconocen por la extensión si el contenido es texto
+	if strings.HasPrefix(declared, "text/") && normalizeContentType(detected) == "text/plain" {
+		detected = declared
+	}
+	return SniffResult{Detected: detected, Declared: declared, Match: true}
+}
+
+// SniffReader lee el inicio de r y lo compara con la extensión de filename.
+// Funciona con archivos más cortos que la ventana de detección, incluso vacíos.
+func SniffReader(r io.Reader, filename string) (SniffResult, error) {
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, header)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return SniffResult{}, err
+	}
+	return SniffBytes(header[:n], filename), nil
+}
+
+// SniffFile detecta el tipo real de un archivo del formulario y lo compara con su extensión
+func SniffFile(file *multipart.FileHeader) (SniffResult, error) {
+	fileContent, err := file.Open()
+	if err != nil {
+		return SniffResult{}, err
+	}
+	defer fileContent.Close()
+
+	return SniffReader(fileContent, file.Filename)
+}
+
+// Verify retorna un *ContentMismatchError si el contenido no corresponde a la extensión
+func (r SniffResult) Verify(filename string) error {
+	if r.Match {
+		return nil
+	}
+	return &ContentMismatchError{Filename: filename, Detected: r.Detected, Declared: r.Declared}
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSniffBytes(t *testing.T) {
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg"/>`
+
+	tests := []struct {
+		name         string
+		header       string
+		filename     string
+		wantDetected string
+		wantMatch    bool
+	}{
+		{"jpeg", "\xFF\xD8\xFF\xE0\x00\x10JFIF", "foto.jpg", "image/jpeg", true},
+		{"png", "\x89PNG\r\n\x1A\n\x00\x00", "foto.PNG", "image/png", true},
+		{"pdf", "%PDF-1.7\n", "acta.pdf", "application/pdf", true},
+		{"svg", svg, "logo.svg", "image/svg+xml", true},
+		{"svg con BOM y espacios", "\xEF\xBB\xBF\n  " + svg, "logo.svg", "image/svg+xml", true},
+		{"html con extensión de imagen", "<html><script>alert(1)</script>", "foto.jpg", "text/html; charset=utf-8", false},
+		{"pdf con extensión de imagen", "%PDF-1.7\n", "foto.png", "application/pdf", false},
+		{"svg con extensión png", svg, "foto.png", "image/svg+xml", false},
+		// Sin firma en la extensión el contenido decide el tipo, así un SVG con nombre .txt sigue siendo SVG
+		{"svg con extensión txt", svg, "notas.txt", "image/svg+xml", true},
+		{"texto plano", "hola,mundo\n", "notas.txt", "text/plain", true},
+		{"vacío", "", "notas.txt", "", true},
+		{"vacío con extensión verificable", "", "foto.jpg", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := SniffBytes([]byte(tt.header), tt.filename)
+			if result.Detected != tt.wantDetected || result.Match != tt.wantMatch {
+				t.Fatalf("SniffBytes = %+v, se esperaba Detected %q y Match %v", result, tt.wantDetected, tt.wantMatch)
+			}
+
+			err := result.Verify(tt.filename)
+			if tt.wantMatch != (err == nil) {
+				t.Fatalf("Verify = %v, se esperaba error: %v", err, !tt.wantMatch)
+			}
+			if err != nil && (!errors.Is(err, ErrContentMismatch) || !errors.Is(err, ErrUnsupportedFileType)) {
+				t.Errorf("el error %v debe envolver ErrContentMismatch y ErrUnsupportedFileType", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"regexp"
+	"strings"
+)
+
+// ErrUnsafeSVG indica que el SVG no se pudo limpiar y se rechaza.
+// Los errores que lo envuelven también se clasifican como ErrUnsupportedFileType.
+var ErrUnsafeSVG = errors.New("unsafe svg")
+
+// Espacios de nombres que se aceptan en las declaraciones xmlns
+const (
+	svgNamespace   = "http://www.w3.org/2000/svg"
+	xlinkNamespace = "http://www.w3.org/1999/xlink"
+)
+
+// svgAllowedElements son los elementos que se conservan. Los demás se eliminan con todo su contenido,
+// en particular script, foreignObject, iframe, a y los de animación (set y animate pueden cambiar un href).
+var svgAllowedElements = toSet(
+	"svg", "g", "defs", "symbol", "use", "title", "desc", "style",
+	"path", "rect", "circle", "ellipse", "line", "polyline", "polygon",
+	"text", "tspan", "textPath", "image",
+	"linearGradient", "radialGradient", "stop", "pattern", "clipPath", "mask", "marker",
+	"filter", "feBlend", "feColorMatrix", "feComponentTransfer", "feComposite", "feDisplacementMap",
+	"feDropShadow", "feFlood", "feFuncA", "feFuncB", "feFuncG", "feFuncR", "feGaussianBlur",
+	"feMerge", "feMergeNode", "feMorphology", "feOffset", "feTurbulence",
+)
+
+// svgAllowedAttributes son los atributos sin prefijo que se conservan
+var svgAllowedAttributes = toSet(
+	"id", "class", "style", "transform", "version", "viewBox", "preserveAspectRatio", "href", "lang",
+	"x", "y", "x1", "y1", "x2", "y2", "cx", "cy", "r", "rx", "ry", "fx", "fy", "width", "height", "d", "points",
+	"fill", "fill-opacity", "fill-rule", "stroke", "stroke-width", "stroke-linecap", "stroke-linejoin",
+	"stroke-miterlimit", "stroke-dasharray", "stroke-dashoffset", "stroke-opacity", "opacity",
+	"color", "display", "visibility", "overflow", "vector-effect", "paint-order", "shape-rendering",
+	"offset", "stop-color", "stop-opacity", "gradientUnits", "gradientTransform", "spreadMethod",
+	"patternUnits", "patternContentUnits", "patternTransform",
+	"clip-path", "clip-rule", "clipPathUnits", "mask", "maskUnits", "maskContentUnits",
+	"marker-start", "marker-mid", "marker-end", "markerWidth", "markerHeight", "markerUnits", "refX", "refY", "orient",
+	"font-family", "font-size", "font-weight", "font-style", "text-anchor", "dominant-baseline",
+	"alignment-baseline", "letter-spacing", "word-spacing", "text-decoration",
+	"dx", "dy", "rotate", "textLength", "lengthAdjust", "startOffset",
+	"filter", "filterUnits", "primitiveUnits", "color-interpolation-filters", "in", "in2", "result",
+	"stdDeviation", "mode", "operator", "k1", "k2", "k3", "k4", "values", "type", "flood-color", "flood-opacity",
+	"baseFrequency", "numOctaves", "seed", "stitchTiles", "scale", "xChannelSelector", "yChannelSelector", "radius",
+	"tableValues", "slope", "intercept", "amplitude", "exponent",
+)
+
+// svgSafeDataURL son las imágenes embebidas que se permiten en href
+var svgSafeDataURL = regexp.MustCompile(`^data:image/(png|jpeg|gif|webp);base64,[a-z0-9+/=\s]*$`)
+
+// cssURL encuentra las referencias url(...) dentro de estilos y atributos de presentación
+var cssURL = regexp.MustCompile(`url\(\s*['"]?\s*([^'")\s]*)`)
+
+// Escapes de la salida: el texto conserva los saltos de línea y los atributos escapan las comillas
+var (
+	svgTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	svgAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "\n", "&#xA;", "\r", "&#xD;", "\t", "&#x9;")
+)
+
+func toSet(values ...string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+// SanitizeSVG limpia un SVG con una lista de elementos y atributos permitidos.
+// Elimina script, los atributos on*, las URLs javascript: y los href que no apuntan al mismo documento.
+// Rechaza con ErrUnsafeSVG los archivos que no son XML válido, que declaran DOCTYPE o entidades,
+// o cuya raíz no es <svg>.
+func SanitizeSVG(data []byte) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = true
+
+	var out bytes.Buffer
+	var stack []string
+	skipDepth := 0
+	rootSeen := false
+	// style junta el texto del <style> abierto: un comentario o un CDATA pueden partir una regla
+	// en varios tokens, así que el CSS se revisa completo al cerrar el elemento
+	var style *strings.Builder
+
+	for {
+		token, err := decoder.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, unsafeSVGError("XML inválido: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := qualifiedName(t.Name)
+			if len(stack) == 0 {
+				if rootSeen {
+					return nil, unsafeSVGError("el documento tiene más de un elemento raíz")
+				}
+				if t.Name.Space != "" || t.Name.Local != "svg" {
+					return nil, unsafeSVGError("la raíz del documento debe ser <svg>, se encontró <%s>", name)
+				}
+				rootSeen = true
+			}
+			stack = append(stack, name)
+
+			if skipDepth > 0 || t.Name.Space != "" || !svgAllowedElements[t.Name.Local] {
+				skipDepth++
+				continue
+			}
+			writeSVGStart(&out, t)
+			if t.Name.Local == "style" {
+				style = &strings.Builder{}
+			}
+
+		case xml.EndElement:
+			name := qualifiedName(t.Name)
+			if len(stack) == 0 || stack[len(stack)-1] != name {
+				return nil, unsafeSVGError("cierre inesperado </%s>", name)
+			}
+			stack = stack[:len(stack)-1]
+
+			if skipDepth > 0 {
+				skipDepth--
+				continue
+			}
+			if name == "style" && style != nil {
+				css := style.String()
+				style = nil
+				if !safeCSS(css) {
+					return nil, unsafeSVGError("el elemento <style> contiene referencias externas o código")
+				}
+				svgTextEscaper.WriteString(&out, css)
+			}
+			out.WriteString("</" + name + ">")
+
+		case xml.CharData:
+			if skipDepth > 0 || len(stack) == 0 {
+				continue
+			}
+			if stack[len(stack)-1] == "style" && style != nil {
+				style.Write(t)
+				continue
+			}
+			svgTextEscaper.WriteString(&out, string(t))
+
+		case xml.Directive:
+			// <!DOCTYPE> y <!ENTITY> permiten XXE y expansión de entidades
+			return nil, unsafeSVGError("no se permiten declaraciones DOCTYPE ni ENTITY")
+
+		case xml.ProcInst:
+			if t.Target == "xml" && out.Len() == 0 {
+				out.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+			}
+
+		case xml.Comment:
+			// Los comentarios se eliminan
+		}
+	}
+
+	if !rootSeen || len(stack) != 0 {
+		return nil, unsafeSVGError("el documento no contiene un elemento <svg> completo")
+	}
+	return out.Bytes(), nil
+}
+
+// checkSVGFile verifica que el SVG del formulario se pueda limpiar
+func checkSVGFile(file *multipart.FileHeader) error {
+	fileContent, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer fileContent.Close()
+
+	data, err := io.ReadAll(fileContent)
+	if err != nil {
+		return err
+	}
+	if _, err := SanitizeSVG(data); err != nil {
+		return fmt.Errorf("%s: %w", file.Filename, err)
+	}
+	return nil
+}
+
+// unsafeSVGError construye el error de rechazo, clasificado como ErrUnsafeSVG y ErrUnsupportedFileType
+func unsafeSVGError(format string, args ...any) error {
+	return fmt.Errorf("%w: %s: %w", ErrUnsafeSVG, fmt.Sprintf(format, args...), ErrUnsupportedFileType)
+}
+
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// writeSVGStart escribe la etiqueta de apertura solo con los atributos seguros
+func writeSVGStart(out *bytes.Buffer, element xml.StartElement) {
+	out.WriteString("<" + element.Name.Local)
+	for _, attr := range element.Attr {
+		if !safeSVGAttribute(attr) {
+			continue
+		}
+		out.WriteString(" " + qualifiedName(attr.Name) + "=\"")
+		svgAttrEscaper.WriteString(out, attr.Value)
+		out.WriteString("\"")
+	}
+	out.WriteString(">")
+}
+
+// safeSVGAttribute decide si el atributo se conserva
+func safeSVGAttribute(attr xml.Attr) bool {
+	value := attr.Value
+	switch {
+	case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+		return value == svgNamespace
+	case attr.Name.Space == "xmlns":
+		return attr.Name.Local == "xlink" && value == xlinkNamespace
+	case attr.Name.Space == "xml":
+		return attr.Name.Local == "space" || attr.Name.Local == "lang"
+	case attr.Name.Space == "xlink" && attr.Name.Local == "href", attr.Name.Space == "" && attr.Name.Local == "href":
+		return safeSVGReference(value)
+	case attr.Name.Space != "", !svgAllowedAttributes[attr.Name.Local]:
+		// Incluye los manejadores de eventos on* y los atributos de editores como inkscape:
+		return false
+	case attr.Name.Local == "style":
+		return safeCSS(value)
+	}
+	return !containsScriptURL(value) && safeCSS(value)
+}
+
+// safeSVGReference acepta referencias al mismo documento (#id) e imágenes embebidas en data:
+func safeSVGReference(value string) bool {
+	normalized := normalizeURLValue(value)
+	return strings.HasPrefix(normalized, "#") || svgSafeDataURL.MatchString(normalized)
+}
+
+// safeCSS rechaza estilos con código o con url(...) que no apunte al mismo documento
+func safeCSS(css string) bool {
+	normalized := normalizeURLValue(css)
+	for _, forbidden := range []string{"javascript:", "vbscript:", "expression(", "@import", "behavior:", "-moz-binding"} {
+		if strings.Contains(normalized, forbidden) {
+			return false
+		}
+	}
+	for _, match := range cssURL.FindAllStringSubmatch(strings.ToLower(css), -1) {
+		if !strings.HasPrefix(match[1], "#") {
+			return false
+		}
+	}
+	return true
+}
+
+func containsScriptURL(value string) bool {
+	normalized := normalizeURLValue(value)
+	return strings.Contains(normalized, "javascript:") || strings.Contains(normalized, "vbscript:")
+}
+
+// normalizeURLValue quita espacios y caracteres de control y pasa a minúsculas, porque los navegadores
+// los ignoran en el esquema ("java\tscript:")
+func normalizeURLValue(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7F {
+			return -1
+		}
+		return r
+	}, strings.ToLower(value))
+}
@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/edwinrubio/DueligUtils/testhelpers/fakes"
+	"github.com/gin-gonic/gin"
+)
+
+func TestSanitizeSVG(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		// keep debe quedar en la salida y drop no
+		keep []string
+		drop []string
+	}{
+		{
+			name: "script",
+			in:   `<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script><rect width="10"/></svg>`,
+			keep: []string{`<rect width="10">`},
+			drop: []string{"script", "alert"},
+		},
+		{
+			name: "manejadores de eventos",
+			in:   `<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"><rect onclick="alert(2)" ONMOUSEOVER="alert(3)" fill="red"/></svg>`,
+			keep: []string{`fill="red"`},
+			drop: []string{"onload", "onclick", "ONMOUSEOVER", "alert"},
+		},
+		{
+			name: "href javascript",
+			in:   `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"><use href="javascript:alert(1)"/><use xlink:href="JaVa&#x09;ScRiPt:alert(2)"/><use href="#icon"/></svg>`,
+			keep: []string{`href="#icon"`},
+			drop: []string{"javascript", "ScRiPt", "alert"},
+		},
+		{
+			name: "href externo",
+			in:   `<svg xmlns="http://www.w3.org/2000/svg"><image href="https://evil.example/x.png"/><image href="data:image/png;base64,iVBORw0KGgo="/></svg>`,
+			keep: []string{`href="data:image/png;base64,iVBORw0KGgo="`},
+			drop: []string{"evil.example"},
+		},
+		{
+			name: "data URL que no es imagen",
+			in:   `<svg xmlns="http://www.w3.org/2000/svg"><image href="data:text/html;base64,PHNjcmlwdD4="/></svg>`,
+			drop: []string{"data:text/html"},
+		},
+		{
+			name: "enlaces y foreignObject",
+			in:   `<svg xmlns="http://www.w3.org/2000/svg"><a href="javascript:alert(1)"><text>x</text></a><foreignObject><iframe src="https://evil.example"/></foreignObject></svg>`,
+			drop: []string{"<a", "foreignObject", "iframe", "evil.example"},
+		},
+		{
+			name: "animación que cambia un href",
+			in:   `<svg xmlns="http://www.w3.org/2000/svg"><set attributeName="href" to="javascript:alert(1)"/><animate attributeName="href" values="javascript:alert(2)"/></svg>`,
+			drop: []string{"set", "animate", "javascript"},
+		},
+		{
+			name: "estilos con javascript o url externa",
+			in:   `<svg xmlns="http://www.w3.org/2000/svg"><rect style="fill:url(https://evil.example/x)"/><rect fill="javascript:alert(1)"/><rect fill="url(#grad)"/></svg>`,
+			keep: []string{`fill="url(#grad)"`},
+			drop: []string{"evil.example", "javascript"},
+		},
+		{
+			name: "style seguro con comentario y CDATA",
+			in:   `<svg xmlns="http://www.w3.org/2000/svg"><style>rect{fill:red}<!-- x --><![CDATA[circle{fill:url(#g)}]]></style></svg>`,
+			keep: []string{`<style>rect{fill:red}circle{fill:url(#g)}</style>`},
+			drop: []string{"<!--", "CDATA"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := SanitizeSVG([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("SanitizeSVG: %v", err)
+			}
+			for _, want := range tt.keep {
+				if !strings.Contains(string(out), want) {
+					t.Errorf("la salida no contiene %q:\n%s", want, out)
+				}
+			}
+			for _, unwanted := range tt.drop {
+				if strings.Contains(string(out), unwanted) {
+					t.Errorf("la salida todavía contiene %q:\n%s", unwanted, out)
+				}
+			}
+		})
+	}
+}
+
+func TestSanitizeSVGRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"DOCTYPE con entidades", `<?xml version="1.0"?><!DOCTYPE svg [<!ENTITY xxe SYSTEM "file:///etc/passwd">]><svg xmlns="http://www.w3.org/2000/svg">&xxe;</svg>`},
+		{"raíz que no es svg", `<html><svg xmlns="http://www.w3.org/2000/svg"/></html>`},
+		{"XML inválido", `<svg xmlns="http://www.w3.org/2000/svg"><rect></svg>`},
+		{"sin cerrar", `<svg xmlns="http://www.w3.org/2000/svg">`},
+		{"dos raíces", `<svg xmlns="http://www.w3.org/2000/svg"/><svg xmlns="http://www.w3.org/2000/svg"/>`},
+		{"style con url externa", `<svg xmlns="http://www.w3.org/2000/svg"><style>rect { fill: url(https://evil.example/x) }</style></svg>`},
+		{"style con @import", `<svg xmlns="http://www.w3.org/2000/svg"><style>@import "https://evil.example/x.css";</style></svg>`},
+		{"@import partido por un comentario", `<svg xmlns="http://www.w3.org/2000/svg"><style>@imp<!-- x -->ort "https://evil.example/x.css";</style></svg>`},
+		{"url partida por un CDATA", `<svg xmlns="http://www.w3.org/2000/svg"><style>rect{fill:u<![CDATA[rl(https://evil.example/x)]]>}</style></svg>`},
+		{"url partida por un elemento descartado", `<svg xmlns="http://www.w3.org/2000/svg"><style>rect{fill:u<script/>rl(https://evil.example/x)}</style></svg>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := SanitizeSVG([]byte(tt.in))
+			if !errors.Is(err, ErrUnsafeSVG) || !errors.Is(err, ErrUnsupportedFileType) {
+				t.Fatalf("SanitizeSVG = %v, se esperaba ErrUnsafeSVG y ErrUnsupportedFileType", err)
+			}
+		})
+	}
+}
+
+// newFormContext crea un contexto de gin con un formulario multipart que contiene el archivo en field
+func newFormContext(t *testing.T, field string, filename string, data []byte) *gin.Context {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/upload", &body)
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	return c
+}
+
+// Los SVG se reconocen por el contenido: con otra extensión también se limpian antes de subirlos
+func TestSaveFilesSanitizesSniffedSVG(t *testing.T) {
+	const evil = `<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"><script>alert(2)</script><circle r="5"/></svg>`
+
+	for _, filename := range []string{"logo.svg", "notas.txt", "evil.html", "sin-extension"} {
+		t.Run(filename, func(t *testing.T) {
+			saveFiles := fakes.NewSaveFiles()
+			defer saveFiles.Close()
+
+			c := newFormContext(t, "file", filename, []byte(evil))
+			path, err := SaveFiles(saveFiles.URL+"/SaveFiles", c, "file")
+			if err != nil {
+				t.Fatalf("SaveFiles: %v", err)
+			}
+
+			stored := saveFiles.Files()[path]
+			if strings.Contains(string(stored.Data), "alert") || strings.Contains(string(stored.Data), "onload") {
+				t.Fatalf("el SVG se guardó sin limpiar:\n%s", stored.Data)
+			}
+			if !strings.Contains(string(stored.Data), `<circle r="5">`) {
+				t.Errorf("la limpieza eliminó contenido seguro:\n%s", stored.Data)
+			}
+			files := saveFiles.RequestsTo("/SaveFiles")[0].Files
+			if len(files) != 1 || files[0].ContentType != "image/svg+xml" {
+				t.Errorf("se esperaba una parte image/svg+xml, se recibió %+v", files)
+			}
+		})
+	}
+}
+
+func TestSaveFilesRejectsUnsafeSniffedSVG(t *testing.T) {
+	saveFiles := fakes.NewSaveFiles()
+	defer saveFiles.Close()
+
+	c := newFormContext(t, "file", "notas.txt", []byte(`<!DOCTYPE svg [<!ENTITY x "y">]><svg xmlns="http://www.w3.org/2000/svg">&x;</svg>`))
+	if _, err := SaveFiles(saveFiles.URL+"/SaveFiles", c, "file"); !errors.Is(err, ErrUnsafeSVG) {
+		t.Fatalf("SaveFiles = %v, se esperaba ErrUnsafeSVG", err)
+	}
+	if len(saveFiles.Requests()) != 0 {
+		t.Error("el archivo rechazado no debe llegar al servicio de archivos")
+	}
+}
@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/edwinrubio/DueligUtils/utils"
+
+// requestIDAttribute es el atributo con el que se registra el X-Request-ID en cada span
+const requestIDAttribute = attribute.Key("duelig.request_id")
+
+// tracePropagator lee y escribe las cabeceras W3C traceparent y tracestate.
+// Se usa siempre, aunque no se haya llamado a InitTracing, para no cortar la traza entre servicios.
+var tracePropagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+// TracingConfig define cómo se generan y exportan los spans del servicio
+type TracingConfig struct {
+	// ServiceName identifica al servicio en los spans (usuarios, cd, savefiles, reservas...)
+	ServiceName string
+	// Exporter recibe los spans terminados. Si es nil los spans se generan pero no se exportan.
+	Exporter sdktrace.SpanExporter
+	// Sampler decide qué trazas se registran. Por defecto respeta la decisión del padre y muestrea todo.
+	Sampler sdktrace.Sampler
+	// Synchronous exporta cada span al terminar en lugar de hacerlo por lotes.
+	// Útil junto con el exportador en memoria en las pruebas.
+	Synchronous bool
+}
+
+// InitTracing configura el TracerProvider global con el exportador indicado.
+// Retorna una función que vacía y cierra el proveedor; debe llamarse al apagar el servicio.
+func InitTracing(cfg TracingConfig) (func(context.Context) error, error) {
+	if cfg.ServiceName == "" {
+		return nil, fmt.Errorf("service name is required to init tracing")
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("error creating tracing resource: %v", err)
+	}
+
+	sampler := cfg.Sampler
+	if sampler == nil {
+		sampler = sdktrace.ParentBased(sdktrace.AlwaysSample())
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+	}
+	if cfg.Exporter != nil {
+		if cfg.Synchronous {
+			opts = append(opts, sdktrace.WithSyncer(cfg.Exporter))
+		} else {
+			opts = append(opts, sdktrace.WithBatcher(cfg.Exporter))
+		}
+	}
+
+	provider := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(tracePropagator)
+
+	return provider.Shutdown, nil
+}
+
+// NewInMemoryExporter crea un exportador que guarda los spans en memoria.
+// Pensado para las pruebas: se pasa en TracingConfig.Exporter y luego se consultan con GetSpans().
+func NewInMemoryExporter() *tracetest.InMemoryExporter {
+	return tracetest.NewInMemoryExporter()
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// TracingMiddleware crea un span de servidor por cada solicitud de Gin.
+// Continúa la traza recibida en traceparent/tracestate y la devuelve en la respuesta.
+func TracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := tracePropagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+
+		ctx, span := tracer().Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(c.Request.URL.Path),
+				semconv.ClientAddress(c.ClientIP()),
+				semconv.UserAgentOriginal(c.Request.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		if requestID := c.GetHeader("X-Request-ID"); requestID != "" {
+			span.SetAttributes(requestIDAttribute.String(requestID))
+		}
+		if clientType := c.GetHeader("Client-Type"); clientType != "" {
+			span.SetAttributes(attribute.String("duelig.client_type", clientType))
+		}
+
+		c.Request = c.Request.WithContext(ctx)
+		tracePropagator.Inject(ctx, propagation.HeaderCarrier(c.Writer.Header()))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		if len(c.Errors) > 0 {
+			span.RecordError(c.Errors.Last())
+		}
+	}
+}
+
+// startClientSpan inicia un span de cliente para una llamada a otro servicio
+// e inyecta traceparent/tracestate en las cabeceras de la solicitud.
+func startClientSpan(ctx context.Context, service string, operation string, req *http.Request) (*http.Request, trace.Span) {
+	ctx, span := tracer().Start(ctx, service+" "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.PeerService(service),
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLFull(req.URL.String()),
+			semconv.ServerAddress(req.URL.Hostname()),
+			attribute.String("duelig.operation", operation),
+		),
+	)
+
+	if requestID := req.Header.Get("X-Request-ID"); requestID != "" {
+		span.SetAttributes(requestIDAttribute.String(requestID))
+	}
+
+	req = req.WithContext(ctx)
+	tracePropagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return req, span
+}
+
+// endClientSpan registra el resultado de la llamada y cierra el span
+func endClientSpan(span trace.Span, resp *http.Response, err error) {
+	defer span.End()
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+}
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// initTestTracing configura el proveedor global con un exportador en memoria síncrono
+func initTestTracing(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := NewInMemoryExporter()
+	shutdown, err := InitTracing(TracingConfig{ServiceName: "test", Exporter: exporter, Synchronous: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { shutdown(context.Background()) })
+	return exporter
+}
+
+func spanAttribute(span tracetest.SpanStub, key attribute.Key) (attribute.Value, bool) {
+	for _, attr := range span.Attributes {
+		if attr.Key == key {
+			return attr.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	tests := []struct {
+		name        string
+		traceparent string
+		status      int
+		wantError   bool
+	}{
+		{"continúa la traza recibida", incoming, http.StatusOK, false},
+		{"traza nueva", "", http.StatusOK, false},
+		{"error del servidor", incoming, http.StatusBadGateway, true},
+		{"error del cliente no marca el span", "", http.StatusNotFound, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := initTestTracing(t)
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(TracingMiddleware())
+			router.GET("/items/:id", func(c *gin.Context) { c.Status(tt.status) })
+
+			req := httptest.NewRequest(http.MethodGet, "/items/7", nil)
+			req.Header.Set("X-Request-ID", "req-1")
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("se esperaba un span, hay %d", len(spans))
+			}
+			span := spans[0]
+			if span.Name != "GET /items/:id" || span.SpanKind != trace.SpanKindServer {
+				t.Errorf("span %q de tipo %v", span.Name, span.SpanKind)
+			}
+			if tt.traceparent != "" {
+				if span.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || span.Parent.SpanID().String() != "00f067aa0ba902b7" {
+					t.Errorf("el span no continúa la traza recibida: %s padre %s", span.SpanContext.TraceID(), span.Parent.SpanID())
+				}
+			} else if span.Parent.IsValid() {
+				t.Error("sin traceparent el span no debe tener padre")
+			}
+			if value, _ := spanAttribute(span, requestIDAttribute); value.AsString() != "req-1" {
+				t.Errorf("duelig.request_id = %q", value.AsString())
+			}
+			if value, _ := spanAttribute(span, "http.response.status_code"); value.AsInt64() != int64(tt.status) {
+				t.Errorf("http.response.status_code = %d, se esperaba %d", value.AsInt64(), tt.status)
+			}
+			if (span.Status.Code == codes.Error) != tt.wantError {
+				t.Errorf("status del span = %v", span.Status)
+			}
+
+			// La respuesta devuelve el contexto del span del servidor
+			returned := tracePropagator.Extract(context.Background(), propagation.HeaderCarrier(rec.Header()))
+			if trace.SpanContextFromContext(returned).SpanID() != span.SpanContext.SpanID() {
+				t.Errorf("traceparent de la respuesta = %q", rec.Header().Get("traceparent"))
+			}
+		})
+	}
+}
+
+// Las llamadas a otros servicios hechas dentro de una solicitud continúan su traza
+func TestDownstreamClientSpan(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		wantError bool
+	}{
+		{"respuesta exitosa", http.StatusOK, false},
+		{"respuesta con error", http.StatusInternalServerError, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := initTestTracing(t)
+
+			var received http.Header
+			downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r.Header.Clone()
+				w.WriteHeader(tt.status)
+			}))
+			defer downstream.Close()
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(TracingMiddleware())
+			router.GET("/proxy", func(c *gin.Context) {
+				req, _ := http.NewRequest(http.MethodGet, downstream.URL+"/health", nil)
+				resp, err := doDownstream(c.Request.Context(), serviceCD, "health", req)
+				if err != nil {
+					t.Errorf("doDownstream: %v", err)
+					return
+				}
+				resp.Body.Close()
+				c.Status(http.StatusOK)
+			})
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/proxy", nil))
+
+			spans := exporter.GetSpans()
+			if len(spans) != 2 {
+				t.Fatalf("se esperaban dos spans, hay %d", len(spans))
+			}
+			// El span de cliente termina primero
+			client, server := spans[0], spans[1]
+			if client.SpanKind != trace.SpanKindClient || client.Name != serviceCD+" health" {
+				t.Fatalf("span de cliente inesperado: %q %v", client.Name, client.SpanKind)
+			}
+			if client.Parent.SpanID() != server.SpanContext.SpanID() {
+				t.Error("el span de cliente debe ser hijo del span del servidor")
+			}
+			sent := tracePropagator.Extract(context.Background(), propagation.HeaderCarrier(received))
+			if trace.SpanContextFromContext(sent).SpanID() != client.SpanContext.SpanID() {
+				t.Errorf("traceparent enviado = %q", received.Get("traceparent"))
+			}
+			if (client.Status.Code == codes.Error) != tt.wantError {
+				t.Errorf("status del span de cliente = %v", client.Status)
+			}
+		})
+	}
+}
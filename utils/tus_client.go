@@ -0,0 +1,295 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Valores por defecto de TusClient
+const (
+	DefaultTusChunkSize  = 5 << 20
+	DefaultTusMaxRetries = 5
+	DefaultTusRetryDelay = time.Second
+	maxTusRetryDelay     = 30 * time.Second
+)
+
+// TusUploadError es una subida reanudable que no se pudo terminar. Con Location se puede
+// reanudar más tarde con TusClient.Resume.
+type TusUploadError struct {
+	Location string
+	Offset   int64
+	Err      error
+}
+
+func (e *TusUploadError) Error() string {
+	return fmt.Sprintf("subida reanudable %s interrumpida en el byte %d: %v", e.Location, e.Offset, e.Err)
+}
+
+func (e *TusUploadError) Unwrap() error {
+	return e.Err
+}
+
+// TusClient sube archivos a un servidor tus 1.0, como TusHandler, en fragmentos de ChunkSize.
+// Si un fragmento falla por la red o por un error temporal del servidor, consulta con HEAD
+// cuántos bytes llegaron y sigue desde ahí, hasta MaxRetries fallas seguidas.
+// Los campos en cero usan los valores por defecto (DefaultTus*).
+type TusClient struct {
+	// Endpoint es la URL donde se crean las subidas
+	Endpoint  string
+	ChunkSize int64
+	// MaxRetries es cuántas fallas seguidas se reintentan; negativo no reintenta
+	MaxRetries int
+	// RetryDelay es la espera antes del primer reintento; se duplica en cada falla seguida
+	RetryDelay time.Duration
+	// Headers se agregan a todas las solicitudes, por ejemplo las de ExtractHeaders
+	Headers map[string]string
+}
+
+// NewTusClient crea un cliente con los valores por defecto
+func NewTusClient(endpoint string) *TusClient {
+	return &TusClient{
+		Endpoint:   endpoint,
+		ChunkSize:  DefaultTusChunkSize,
+		MaxRetries: DefaultTusMaxRetries,
+		RetryDelay: DefaultTusRetryDelay,
+	}
+}
+
+func (t *TusClient) chunkSize() int64 {
+	if t.ChunkSize <= 0 {
+		return DefaultTusChunkSize
+	}
+	return t.ChunkSize
+}
+
+func (t *TusClient) maxRetries() int {
+	switch {
+	case t.MaxRetries < 0:
+		return 0
+	case t.MaxRetries == 0:
+		return DefaultTusMaxRetries
+	}
+	return t.MaxRetries
+}
+
+func (t *TusClient) retryDelay() time.Duration {
+	if t.RetryDelay <= 0 {
+		return DefaultTusRetryDelay
+	}
+	return t.RetryDelay
+}
+
+// Upload crea la subida y envía el contenido. metadata se agrega a Upload-Metadata junto con filename.
+func (t *TusClient) Upload(ctx context.Context, filename string, content io.ReaderAt, size int64, metadata map[string]string) (*UploadResult, error) {
+	location, err := t.create(ctx, filename, size, metadata)
+	if err != nil {
+		return nil, err
+	}
+	return t.Resume(ctx, location, content, size)
+}
+
+// Resume continúa una subida ya creada desde el byte que el servidor tiene guardado
+func (t *TusClient) Resume(ctx context.Context, location string, content io.ReaderAt, size int64) (*UploadResult, error) {
+	var offset, confirmed int64
+	failures := 0
+	for {
+		result, err := t.sync(ctx, location, content, size, &offset)
+		if result != nil {
+			return result, nil
+		}
+		// Si el servidor recibió algo desde la última falla, las fallas vuelven a contar desde cero
+		if offset > confirmed {
+			confirmed = offset
+			failures = 0
+		}
+		if !isRetryableTusError(err) || failures >= t.maxRetries() {
+			return nil, &TusUploadError{Location: location, Offset: offset, Err: err}
+		}
+
+		failures++
+		delay := t.retryDelay() << (failures - 1)
+		if delay <= 0 || delay > maxTusRetryDelay {
+			delay = maxTusRetryDelay
+		}
+		BaseLogger().Warn("Fragmento fallido, se reanuda", "location", location, "offset", offset, "attempt", failures, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return nil, &TusUploadError{Location: location, Offset: offset, Err: ctx.Err()}
+		case <-time.After(delay):
+		}
+	}
+}
+
+// sync consulta el offset del servidor y envía fragmentos hasta terminar o fallar.
+// offset queda con el último valor confirmado por el servidor.
+func (t *TusClient) sync(ctx context.Context, location string, content io.ReaderAt, size int64, offset *int64) (*UploadResult, error) {
+	serverOffset, result, err := t.head(ctx, location)
+	if err != nil || result != nil {
+		return result, err
+	}
+	*offset = serverOffset
+
+	for {
+		// Con el último byte enviado, un PATCH vacío pide que se repita el paso al servicio de archivos
+		n := min(t.chunkSize(), size-*offset)
+		newOffset, result, err := t.patch(ctx, location, io.NewSectionReader(content, *offset, n), *offset, n)
+		if err != nil {
+			return nil, err
+		}
+		if result != nil {
+			return result, nil
+		}
+		if newOffset >= size {
+			return nil, errors.New("el servidor recibió el archivo completo pero no retornó la ruta")
+		}
+		*offset = newOffset
+	}
+}
+
+func (t *TusClient) create(ctx context.Context, filename string, size int64, metadata map[string]string) (string, error) {
+	values := map[string]string{"filename": filename}
+	for key, value := range metadata {
+		values[key] = value
+	}
+
+	req, err := t.newRequest(ctx, http.MethodPost, t.Endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Upload-Length", strconv.FormatInt(size, 10))
+	req.Header.Set("Upload-Metadata", formatTusMetadata(values))
+
+	resp, err := doDownstream(ctx, serviceTus, "tus_create", req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", newUpstreamError(serviceTus, req, resp)
+	}
+
+	location, err := resp.Location()
+	if err != nil {
+		return "", fmt.Errorf("el servidor tus no retornó Location: %w", err)
+	}
+	return location.String(), nil
+}
+
+// head retorna el offset guardado en el servidor, o el resultado si la subida ya terminó
+func (t *TusClient) head(ctx context.Context, location string) (int64, *UploadResult, error) {
+	req, err := t.newRequest(ctx, http.MethodHead, location, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	resp, err := doDownstream(ctx, serviceTus, "tus_head", req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, nil, newUpstreamError(serviceTus, req, resp)
+	}
+	return parseTusResponse(resp)
+}
+
+func (t *TusClient) patch(ctx context.Context, location string, chunk io.Reader, offset int64, n int64) (int64, *UploadResult, error) {
+	req, err := t.newRequest(ctx, http.MethodPatch, location, chunk)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", tusContentType)
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	req.ContentLength = n
+
+	resp, err := doDownstream(ctx, serviceTus, "tus_patch", req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return 0, nil, newUpstreamError(serviceTus, req, resp)
+	}
+	return parseTusResponse(resp)
+}
+
+func (t *TusClient) newRequest(ctx context.Context, method string, target string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	ApplyHeaders(req, t.Headers)
+	req.Header.Set("Tus-Resumable", TusVersion)
+	return req, nil
+}
+
+// parseTusResponse lee Upload-Offset y, si la subida terminó, la ruta y el hash del archivo
+func parseTusResponse(resp *http.Response) (int64, *UploadResult, error) {
+	if path := resp.Header.Get(tusFilePathHeader); path != "" {
+		return 0, &UploadResult{Path: path, SHA256: resp.Header.Get(tusSHA256Header)}, nil
+	}
+	offset, err := strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("Upload-Offset inválido en la respuesta: %w", err)
+	}
+	return offset, nil, nil
+}
+
+// isRetryableTusError indica si vale la pena reanudar: fallas de red, errores temporales del
+// servidor, offset desincronizado (409) o la subida ocupada por otra solicitud (423)
+func isRetryableTusError(err error) bool {
+	if errors.Is(err, ErrUpstreamUnavailable) {
+		return true
+	}
+	var upstreamErr *UpstreamError
+	if errors.As(err, &upstreamErr) {
+		switch upstreamErr.StatusCode {
+		case http.StatusConflict, http.StatusLocked, http.StatusTooManyRequests, http.StatusInternalServerError:
+			return true
+		}
+	}
+	return false
+}
+
+// SaveFilesResumable funciona como SaveFilesWithResult, pero envía el archivo del campo Filename
+// en fragmentos a urltus, la ruta donde el servicio montó TusHandler. El archivo se valida aquí
+// antes de enviar el primer byte y otra vez en el servidor cuando se completa.
+func SaveFilesResumable(urltus string, c *gin.Context, Filename string, opts ...UploadOption) (*UploadResult, error) {
+	cfg := newUploadConfig(c, opts)
+
+	file, err := c.FormFile(Filename)
+	if err != nil {
+		Logger(c).Error("Error al obtener el archivo del formulario", "field", Filename, "error", err)
+		return nil, err
+	}
+
+	if _, _, err := prepareFileUpload(file, false, cfg); err != nil {
+		Logger(c).Warn("Archivo rechazado", "filename", file.Filename, "error", err)
+		return nil, err
+	}
+
+	content, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	client := NewTusClient(urltus)
+	client.Headers = ExtractHeaders(c)
+
+	result, err := client.Upload(requestContext(c), cfg.uploadFilename(file.Filename), content, file.Size, nil)
+	if err != nil {
+		Logger(c).Error("Error en la subida reanudable", "filename", file.Filename, "error", err)
+		return nil, err
+	}
+	Logger(c).Info("Archivo guardado con subida reanudable", "file_path", result.Path)
+	return result, nil
+}
@@ -0,0 +1,440 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// TusVersion es la versión del protocolo tus que implementan TusHandler y TusClient
+const TusVersion = "1.0.0"
+
+// tusExtensions son las extensiones de tus soportadas
+const tusExtensions = "creation,termination"
+
+// tusContentType es el Content-Type obligatorio de los PATCH
+const tusContentType = "application/offset+octet-stream"
+
+// Cabeceras con el resultado de la subida al servicio de archivos, en el último PATCH y en HEAD
+const (
+	tusFilePathHeader = "X-File-Path"
+	tusSHA256Header   = "X-File-Sha256"
+)
+
+// tusOwnerMetadata es la clave de Metadata con el ID del usuario que creó la subida.
+// La pone el servidor; si el cliente la envía en Upload-Metadata se descarta.
+const tusOwnerMetadata = "owner"
+
+// tusAssembleMemory es cuánto del archivo armado se mantiene en memoria antes de pasar a un temporal
+const tusAssembleMemory = 32 << 20
+
+// TusConfig configura las rutas de subidas reanudables
+type TusConfig struct {
+	// Store guarda los fragmentos hasta que la subida se completa
+	Store ChunkStore
+	// URLSaveFiles es el endpoint del servicio de archivos donde se sube el archivo completo,
+	// igual que en SaveFiles. Si es de imágenes, el archivo debe ser una imagen.
+	URLSaveFiles string
+	// MaxSize es el Upload-Length máximo en bytes; 0 es sin límite
+	MaxSize int64
+	// Options son las opciones de subida del archivo completo (WithPolicy, WithScanner, WithDedupe...)
+	Options []UploadOption
+	// OnComplete se llama cuando el archivo ya está en el servicio de archivos, por ejemplo para
+	// guardar upload.FilePath en Mongo. Si falla, el cliente recibe el error y, al repetir el último
+	// PATCH, se vuelve a llamar sin subir de nuevo el archivo. Como también se repite si no se pudo
+	// guardar que terminó, debe ser idempotente.
+	OnComplete func(c *gin.Context, upload TusUpload) error
+}
+
+// TusHandler atiende subidas reanudables con el protocolo tus 1.0 (https://tus.io/protocols/resumable-upload).
+// El cliente crea la subida con POST y envía el archivo en fragmentos con PATCH; si la conexión se
+// corta, consulta con HEAD cuántos bytes llegaron y sigue desde ahí. Cuando llega el último byte,
+// el archivo pasa por las mismas validaciones que SaveFiles y se sube al servicio de archivos.
+//
+// Cada subida queda a nombre del usuario del token que la creó, y HEAD, PATCH y DELETE de otro
+// usuario responden 404. Si se creó sin token, cualquiera con su URL puede continuarla; para exigir
+// sesión las rutas se montan detrás de ValidateSession.
+type TusHandler struct {
+	cfg TusConfig
+
+	mu     sync.Mutex
+	active map[string]bool
+}
+
+// NewTusHandler crea el handler con la configuración indicada
+func NewTusHandler(cfg TusConfig) *TusHandler {
+	return &TusHandler{cfg: cfg, active: make(map[string]bool)}
+}
+
+// Register monta las rutas de tus en el grupo, por ejemplo router.Group("/api/v1/uploads").
+// Los clientes que no pueden enviar PATCH o DELETE usan POST con X-HTTP-Method-Override.
+func (h *TusHandler) Register(group *gin.RouterGroup) {
+	group.OPTIONS("", h.options)
+	group.POST("", h.create)
+	group.OPTIONS("/:id", h.options)
+	group.HEAD("/:id", h.head)
+	group.PATCH("/:id", h.patch)
+	group.DELETE("/:id", h.terminate)
+	group.POST("/:id", h.methodOverride)
+}
+
+func (h *TusHandler) options(c *gin.Context) {
+	c.Header("Tus-Resumable", TusVersion)
+	c.Header("Tus-Version", TusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	if h.cfg.MaxSize > 0 {
+		c.Header("Tus-Max-Size", strconv.FormatInt(h.cfg.MaxSize, 10))
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// checkVersion responde 412 si el cliente no habla la versión soportada
+func (h *TusHandler) checkVersion(c *gin.Context) bool {
+	c.Header("Tus-Resumable", TusVersion)
+	if c.GetHeader("Tus-Resumable") != TusVersion {
+		c.Header("Tus-Version", TusVersion)
+		c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{"error": "Unsupported Tus-Resumable version"})
+		return false
+	}
+	return true
+}
+
+func (h *TusHandler) create(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid Upload-Length header"})
+		return
+	}
+	if h.cfg.MaxSize > 0 && length > h.cfg.MaxSize {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("upload too large: max %d bytes", h.cfg.MaxSize)})
+		return
+	}
+	// Con una política de tamaño se rechaza antes de recibir el primer byte
+	if policy := newUploadConfig(c, h.cfg.Options).policy; policy != nil && policy.MaxBytes > 0 && length > policy.MaxBytes {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("upload too large: max %d bytes", policy.MaxBytes)})
+		return
+	}
+
+	metadata, err := parseTusMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil || metadata["filename"] == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Upload-Metadata must include a base64 filename"})
+		return
+	}
+	delete(metadata, tusOwnerMetadata)
+	if userID := contextUserID(c); userID != "" {
+		metadata[tusOwnerMetadata] = userID
+	}
+
+	upload := TusUpload{
+		ID:        uuid.NewString(),
+		Length:    length,
+		Metadata:  metadata,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := h.cfg.Store.Create(requestContext(c), upload); err != nil {
+		Logger(c).Error("Error al crear la subida reanudable", "error", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Could not create upload"})
+		return
+	}
+
+	Logger(c).Info("Subida reanudable creada", "upload_id", upload.ID, "length", length, "filename", metadata["filename"])
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.ID)
+	c.Status(http.StatusCreated)
+}
+
+func (h *TusHandler) head(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+
+	upload, ok := h.getOwnUpload(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	setTusResultHeaders(c, upload)
+	c.Status(http.StatusOK)
+}
+
+func (h *TusHandler) patch(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+	if c.ContentType() != tusContentType {
+		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be " + tusContentType})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid Upload-Offset header"})
+		return
+	}
+
+	id := c.Param("id")
+	if !h.acquire(id) {
+		c.AbortWithStatusJSON(http.StatusLocked, gin.H{"error": "Upload is being written by another request"})
+		return
+	}
+	defer h.release(id)
+
+	ctx := requestContext(c)
+	upload, ok := h.getOwnUpload(c, id)
+	if !ok {
+		return
+	}
+	if offset != upload.Offset {
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "Upload-Offset does not match the current offset"})
+		return
+	}
+	if c.Request.ContentLength > upload.Length-offset {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Chunk exceeds Upload-Length"})
+		return
+	}
+	// Con todo el contenido recibido, el PATCH repite los pasos de finish que faltaron
+	if offset == upload.Length {
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		h.finish(c, upload)
+		return
+	}
+
+	n, err := h.cfg.Store.WriteChunk(ctx, id, offset, c.Request.Body)
+	upload.Offset = offset + n
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if err != nil {
+		// Lo recibido quedó guardado; el cliente consulta con HEAD y reanuda desde ahí
+		Logger(c).Warn("Fragmento interrumpido", "upload_id", id, "offset", upload.Offset, "error", err)
+		h.abortStoreError(c, err)
+		return
+	}
+
+	if upload.Offset < upload.Length {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	h.finish(c, upload)
+}
+
+// finish sube el archivo completo al servicio de archivos y llama a OnComplete. Cada paso queda
+// guardado en el Store, así que si el último PATCH se repite solo se hace lo que faltó: un archivo
+// ya subido no se vuelve a subir, y si OnComplete falló se llama de nuevo.
+func (h *TusHandler) finish(c *gin.Context, upload TusUpload) {
+	ctx := requestContext(c)
+
+	if upload.FilePath == "" {
+		result, err := h.assemble(c, upload)
+		if err != nil {
+			// Si el archivo se rechazó se descarta; ante cualquier otra falla, como un 500 del servicio
+			// de archivos, se conserva para que el cliente repita el último PATCH
+			if isUploadRejection(err) {
+				if deleteErr := h.cfg.Store.Delete(ctx, upload.ID); deleteErr != nil {
+					Logger(c).Warn("No se pudo descartar la subida rechazada", "upload_id", upload.ID, "error", deleteErr)
+				}
+			}
+			abortWithError(c, err)
+			return
+		}
+
+		if err := h.cfg.Store.Complete(ctx, upload.ID, *result); err != nil {
+			Logger(c).Error("No se pudo guardar el resultado de la subida reanudable", "upload_id", upload.ID, "file_path", result.Path, "error", err)
+			abortWithError(c, err)
+			return
+		}
+		upload.FilePath = result.Path
+		upload.SHA256 = result.SHA256
+		Logger(c).Info("Archivo de la subida reanudable guardado", "upload_id", upload.ID, "file_path", result.Path)
+	}
+
+	if !upload.Done {
+		if h.cfg.OnComplete != nil {
+			if err := h.cfg.OnComplete(c, upload); err != nil {
+				Logger(c).Error("Error al procesar la subida completada", "upload_id", upload.ID, "error", err)
+				abortWithError(c, err)
+				return
+			}
+		}
+		if err := h.cfg.Store.MarkDone(ctx, upload.ID); err != nil {
+			Logger(c).Error("No se pudo marcar la subida reanudable como terminada", "upload_id", upload.ID, "error", err)
+			abortWithError(c, err)
+			return
+		}
+		upload.Done = true
+		Logger(c).Info("Subida reanudable completada", "upload_id", upload.ID, "file_path", upload.FilePath)
+	}
+
+	setTusResultHeaders(c, upload)
+	c.Status(http.StatusNoContent)
+}
+
+// assemble pasa el archivo armado por prepareFileUpload y lo sube como en SaveFiles
+func (h *TusHandler) assemble(c *gin.Context, upload TusUpload) (*UploadResult, error) {
+	content, err := h.cfg.Store.Open(requestContext(c), upload.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	file, cleanup, err := fileHeaderFromReader(upload.Metadata["filename"], content, tusAssembleMemory)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	cfg := newUploadConfig(c, h.cfg.Options)
+	filekind, contentType, err := prepareFileUpload(file, isImageEndpoint(h.cfg.URLSaveFiles), cfg)
+	if err != nil {
+		Logger(c).Warn("Archivo rechazado", "upload_id", upload.ID, "filename", file.Filename, "error", err)
+		return nil, err
+	}
+	return uploadFile(h.cfg.URLSaveFiles, file, filekind, contentType, cfg, c)
+}
+
+// isUploadRejection indica si el archivo se rechazó por su contenido: tipo no permitido, tamaño,
+// política de subida o malware. Repetir el último PATCH daría el mismo resultado.
+func isUploadRejection(err error) bool {
+	return errors.Is(err, ErrUnsupportedFileType) || errors.Is(err, ErrFileTooLarge) || errors.Is(err, ErrInfected)
+}
+
+func (h *TusHandler) terminate(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+
+	id := c.Param("id")
+	if !h.acquire(id) {
+		c.AbortWithStatusJSON(http.StatusLocked, gin.H{"error": "Upload is being written by another request"})
+		return
+	}
+	defer h.release(id)
+
+	if _, ok := h.getOwnUpload(c, id); !ok {
+		return
+	}
+	if err := h.cfg.Store.Delete(requestContext(c), id); err != nil {
+		h.abortStoreError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// getOwnUpload obtiene la subida si la creó el usuario de la solicitud. La de otro usuario
+// responde 404, igual que una que no existe, para no confirmar que el ID es válido.
+func (h *TusHandler) getOwnUpload(c *gin.Context, id string) (TusUpload, bool) {
+	upload, err := h.cfg.Store.Get(requestContext(c), id)
+	if err != nil {
+		h.abortStoreError(c, err)
+		return TusUpload{}, false
+	}
+	if upload.Metadata[tusOwnerMetadata] != contextUserID(c) {
+		Logger(c).Warn("Acceso a una subida reanudable de otro usuario", "upload_id", id)
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return TusUpload{}, false
+	}
+	return upload, true
+}
+
+// methodOverride atiende PATCH y DELETE enviados como POST con X-HTTP-Method-Override
+func (h *TusHandler) methodOverride(c *gin.Context) {
+	switch strings.ToUpper(c.GetHeader("X-HTTP-Method-Override")) {
+	case http.MethodPatch:
+		h.patch(c)
+	case http.MethodDelete:
+		h.terminate(c)
+	default:
+		c.AbortWithStatusJSON(http.StatusMethodNotAllowed, gin.H{"error": "Method not allowed"})
+	}
+}
+
+// acquire evita que dos solicitudes escriban la misma subida a la vez
+func (h *TusHandler) acquire(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.active[id] {
+		return false
+	}
+	h.active[id] = true
+	return true
+}
+
+func (h *TusHandler) release(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.active, id)
+}
+
+func (h *TusHandler) abortStoreError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+	case errors.Is(err, ErrOffsetMismatch):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "Upload-Offset does not match the current offset"})
+	default:
+		Logger(c).Error("Error en el almacén de subidas reanudables", "error", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Upload storage error"})
+	}
+}
+
+// abortWithError responde con el status del error. Los errores del servidor no muestran
+// el detalle, que puede incluir URLs internas.
+func abortWithError(c *gin.Context, err error) {
+	status := HTTPStatusFromError(err)
+	message := err.Error()
+	if status >= http.StatusInternalServerError {
+		message = http.StatusText(status)
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": message})
+}
+
+// setTusResultHeaders agrega la ruta y el hash cuando la subida terminó, incluido OnComplete
+func setTusResultHeaders(c *gin.Context, upload TusUpload) {
+	if upload.Done {
+		c.Header(tusFilePathHeader, upload.FilePath)
+		c.Header(tusSHA256Header, upload.SHA256)
+	}
+}
+
+// parseTusMetadata lee Upload-Metadata: pares "clave valor-en-base64" separados por comas.
+// El valor puede faltar.
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("Upload-Metadata con una clave vacía")
+		}
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("Upload-Metadata con %s inválido: %w", key, err)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// formatTusMetadata arma Upload-Metadata con las claves ordenadas
+func formatTusMetadata(metadata map[string]string) string {
+	pairs := make([]string, 0, len(metadata))
+	for _, key := range sortedKeys(metadata) {
+		pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(metadata[key])))
+	}
+	return strings.Join(pairs, ",")
+}
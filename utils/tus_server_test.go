@@ -0,0 +1,367 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/edwinrubio/DueligUtils/testhelpers/fakes"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newTusTestRouter monta un TusHandler en /uploads con un LocalChunkStore temporal
+func newTusTestRouter(t *testing.T, cfg TusConfig) *gin.Engine {
+	t.Helper()
+	store, err := NewLocalChunkStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Store = store
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	NewTusHandler(cfg).Register(router.Group("/uploads"))
+	return router
+}
+
+// tusRequest envía una solicitud tus al router. Con offset negativo no se envía Upload-Offset.
+func tusRequest(router http.Handler, method string, target string, offset int64, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	req.Header.Set("Tus-Resumable", TusVersion)
+	if method == http.MethodPatch {
+		req.Header.Set("Content-Type", tusContentType)
+	}
+	if offset >= 0 {
+		req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// createTusUpload crea una subida y retorna su Location
+func createTusUpload(t *testing.T, router http.Handler, filename string, length int) string {
+	t.Helper()
+	rec := tusRequest(router, http.MethodPost, "/uploads", -1, nil, map[string]string{
+		"Upload-Length":   strconv.Itoa(length),
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte(filename)),
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body)
+	}
+	return rec.Header().Get("Location")
+}
+
+func TestTusHandlerFinishRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		// saveFilesFail es el status con el que el servicio de archivos responde la primera subida
+		saveFilesFail      int
+		onCompleteFailures int
+		wantFirst          int
+		// wantDiscarded indica que la subida se descarta y el PATCH repetido responde 404
+		wantDiscarded  bool
+		wantOnComplete int32
+	}{
+		{
+			name: "sin fallas, PATCH repetido", filename: "notas.txt", content: "hola mundo",
+			wantFirst: http.StatusNoContent, wantOnComplete: 1,
+		},
+		{
+			name: "OnComplete falla una vez", filename: "notas.txt", content: "hola mundo",
+			onCompleteFailures: 1, wantFirst: http.StatusInternalServerError, wantOnComplete: 2,
+		},
+		{
+			name: "servicio de archivos con 500", filename: "notas.txt", content: "hola mundo",
+			saveFilesFail: http.StatusInternalServerError, wantFirst: http.StatusBadGateway, wantOnComplete: 1,
+		},
+		{
+			name: "servicio de archivos no disponible", filename: "notas.txt", content: "hola mundo",
+			saveFilesFail: http.StatusServiceUnavailable, wantFirst: http.StatusBadGateway, wantOnComplete: 1,
+		},
+		{
+			name: "contenido rechazado", filename: "foto.jpg", content: "esto no es un jpeg",
+			wantFirst: http.StatusUnsupportedMediaType, wantDiscarded: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saveFiles := fakes.NewSaveFiles()
+			defer saveFiles.Close()
+
+			var calls atomic.Int32
+			router := newTusTestRouter(t, TusConfig{
+				URLSaveFiles: saveFiles.URL + "/SaveFiles",
+				OnComplete: func(c *gin.Context, upload TusUpload) error {
+					if calls.Add(1) <= int32(tt.onCompleteFailures) {
+						return errors.New("mongo no disponible")
+					}
+					if upload.FilePath == "" {
+						t.Error("OnComplete recibió la subida sin FilePath")
+					}
+					return nil
+				},
+			})
+			if tt.saveFilesFail != 0 {
+				saveFiles.FailNext(1, tt.saveFilesFail)
+			}
+
+			location := createTusUpload(t, router, tt.filename, len(tt.content))
+			length := int64(len(tt.content))
+
+			first := tusRequest(router, http.MethodPatch, location, 0, []byte(tt.content), nil)
+			if first.Code != tt.wantFirst {
+				t.Fatalf("primer PATCH = %d %s, se esperaba %d", first.Code, first.Body, tt.wantFirst)
+			}
+			if first.Code != http.StatusNoContent && first.Header().Get(tusFilePathHeader) != "" {
+				t.Error("un PATCH fallido no debe informar la ruta del archivo")
+			}
+
+			head := tusRequest(router, http.MethodHead, location, -1, nil, nil)
+			if tt.wantDiscarded {
+				if head.Code != http.StatusNotFound {
+					t.Fatalf("HEAD de la subida rechazada = %d, se esperaba 404", head.Code)
+				}
+				if retry := tusRequest(router, http.MethodPatch, location, length, nil, nil); retry.Code != http.StatusNotFound {
+					t.Errorf("PATCH repetido = %d, se esperaba 404", retry.Code)
+				}
+				if len(saveFiles.Requests()) != 0 {
+					t.Error("el archivo rechazado no debe llegar al servicio de archivos")
+				}
+				return
+			}
+			if head.Header().Get("Upload-Offset") != strconv.FormatInt(length, 10) {
+				t.Errorf("HEAD Upload-Offset = %q, se esperaba %d", head.Header().Get("Upload-Offset"), length)
+			}
+
+			// El cliente repite el último PATCH, vacío, con el offset en el final
+			retry := tusRequest(router, http.MethodPatch, location, length, nil, nil)
+			if retry.Code != http.StatusNoContent {
+				t.Fatalf("PATCH repetido = %d %s", retry.Code, retry.Body)
+			}
+			path := retry.Header().Get(tusFilePathHeader)
+			if path == "" || retry.Header().Get(tusSHA256Header) == "" {
+				t.Fatalf("el PATCH repetido no informó el resultado: %v", retry.Header())
+			}
+			if first.Code == http.StatusNoContent && first.Header().Get(tusFilePathHeader) != path {
+				t.Errorf("el PATCH repetido cambió la ruta: %q y %q", first.Header().Get(tusFilePathHeader), path)
+			}
+
+			files := saveFiles.Files()
+			if len(files) != 1 || string(files[path].Data) != tt.content {
+				t.Errorf("se esperaba un archivo en %s con el contenido, el servicio tiene %v", path, files)
+			}
+			if got := calls.Load(); got != tt.wantOnComplete {
+				t.Errorf("OnComplete se llamó %d veces, se esperaban %d", got, tt.wantOnComplete)
+			}
+
+			head = tusRequest(router, http.MethodHead, location, -1, nil, nil)
+			if head.Header().Get(tusFilePathHeader) != path {
+				t.Errorf("HEAD informa la ruta %q, se esperaba %q", head.Header().Get(tusFilePathHeader), path)
+			}
+		})
+	}
+}
+
+func TestTusHandlerPatchValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		// offset, body y headers del segundo PATCH, después de uno de 4 bytes
+		offset     int64
+		body       string
+		headers    map[string]string
+		wantStatus int
+		wantOffset string
+	}{
+		{name: "fragmento siguiente", offset: 4, body: "efgh", wantStatus: http.StatusNoContent, wantOffset: "8"},
+		{name: "offset repetido", offset: 0, body: "abcd", wantStatus: http.StatusConflict, wantOffset: "4"},
+		{name: "offset adelantado", offset: 6, body: "gh", wantStatus: http.StatusConflict, wantOffset: "4"},
+		{name: "fragmento mayor que lo que falta", offset: 4, body: "efghijklmnop", wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "sin Upload-Offset", offset: -1, body: "efgh", wantStatus: http.StatusBadRequest},
+		{name: "Content-Type incorrecto", offset: 4, body: "efgh", headers: map[string]string{"Content-Type": "application/octet-stream"}, wantStatus: http.StatusUnsupportedMediaType},
+		{name: "otra versión de tus", offset: 4, body: "efgh", headers: map[string]string{"Tus-Resumable": "0.2.2"}, wantStatus: http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saveFiles := fakes.NewSaveFiles()
+			defer saveFiles.Close()
+			router := newTusTestRouter(t, TusConfig{URLSaveFiles: saveFiles.URL + "/SaveFiles"})
+
+			location := createTusUpload(t, router, "notas.txt", 10)
+			if rec := tusRequest(router, http.MethodPatch, location, 0, []byte("abcd"), nil); rec.Code != http.StatusNoContent {
+				t.Fatalf("primer PATCH = %d %s", rec.Code, rec.Body)
+			}
+
+			rec := tusRequest(router, http.MethodPatch, location, tt.offset, []byte(tt.body), tt.headers)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("PATCH = %d %s, se esperaba %d", rec.Code, rec.Body, tt.wantStatus)
+			}
+			if tt.wantOffset != "" && rec.Header().Get("Upload-Offset") != tt.wantOffset {
+				t.Errorf("Upload-Offset = %q, se esperaba %q", rec.Header().Get("Upload-Offset"), tt.wantOffset)
+			}
+			if len(saveFiles.Requests()) != 0 {
+				t.Error("una subida incompleta no debe llegar al servicio de archivos")
+			}
+		})
+	}
+}
+
+// Un TusClient sin configurar reanuda cuando el servidor no pudo subir el archivo completo
+func TestTusClientRetriesFinish(t *testing.T) {
+	saveFiles := fakes.NewSaveFiles()
+	defer saveFiles.Close()
+	saveFiles.FailNext(1, http.StatusInternalServerError)
+
+	var calls atomic.Int32
+	router := newTusTestRouter(t, TusConfig{
+		URLSaveFiles: saveFiles.URL + "/SaveFiles",
+		OnComplete: func(c *gin.Context, upload TusUpload) error {
+			calls.Add(1)
+			return nil
+		},
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	content := strings.Repeat("fila,valor\n", 1000)
+	client := &TusClient{Endpoint: server.URL + "/uploads", ChunkSize: 4096, RetryDelay: time.Millisecond}
+	result, err := client.Upload(context.Background(), "datos.txt", strings.NewReader(content), int64(len(content)), nil)
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	stored, exists := saveFiles.Files()[result.Path]
+	if !exists || string(stored.Data) != content {
+		t.Fatalf("el archivo %q no se guardó completo", result.Path)
+	}
+	if len(saveFiles.Files()) != 1 || calls.Load() != 1 {
+		t.Errorf("se esperaba un archivo y una llamada a OnComplete, hay %d y %d", len(saveFiles.Files()), calls.Load())
+	}
+}
+
+// Solo el usuario que creó la subida puede consultarla, continuarla o cancelarla
+func TestTusHandlerOwnership(t *testing.T) {
+	usuarios := fakes.NewUsuarios()
+	defer usuarios.Close()
+	owner := primitive.NewObjectID()
+	ownerAuth := map[string]string{"Authorization": "Bearer " + usuarios.IssueToken(owner)}
+	otherAuth := map[string]string{"Authorization": "Bearer " + usuarios.IssueToken(primitive.NewObjectID())}
+
+	tests := []struct {
+		name       string
+		method     string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{name: "HEAD del dueño", method: http.MethodHead, headers: ownerAuth, wantStatus: http.StatusOK},
+		{name: "HEAD de otro usuario", method: http.MethodHead, headers: otherAuth, wantStatus: http.StatusNotFound},
+		{name: "HEAD sin token", method: http.MethodHead, wantStatus: http.StatusNotFound},
+		{name: "PATCH del dueño", method: http.MethodPatch, headers: ownerAuth, wantStatus: http.StatusNoContent},
+		{name: "PATCH de otro usuario", method: http.MethodPatch, headers: otherAuth, wantStatus: http.StatusNotFound},
+		{
+			name: "PATCH de otro usuario con X-HTTP-Method-Override", method: http.MethodPost,
+			headers:    map[string]string{"Authorization": otherAuth["Authorization"], "X-HTTP-Method-Override": http.MethodPatch, "Content-Type": tusContentType},
+			wantStatus: http.StatusNotFound,
+		},
+		{name: "DELETE del dueño", method: http.MethodDelete, headers: ownerAuth, wantStatus: http.StatusNoContent},
+		{name: "DELETE de otro usuario", method: http.MethodDelete, headers: otherAuth, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saveFiles := fakes.NewSaveFiles()
+			defer saveFiles.Close()
+			router := newTusTestRouter(t, TusConfig{URLSaveFiles: saveFiles.URL + "/SaveFiles"})
+
+			rec := tusRequest(router, http.MethodPost, "/uploads", -1, nil, map[string]string{
+				"Authorization":   ownerAuth["Authorization"],
+				"Upload-Length":   "8",
+				"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("notas.txt")),
+			})
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("POST = %d %s", rec.Code, rec.Body)
+			}
+			location := rec.Header().Get("Location")
+
+			rec = tusRequest(router, tt.method, location, 0, []byte("abcd"), tt.headers)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("%s = %d %s, se esperaba %d", tt.method, rec.Code, rec.Body, tt.wantStatus)
+			}
+
+			// La solicitud rechazada no cambia la subida: el dueño sigue en el byte 0
+			if tt.wantStatus == http.StatusNotFound {
+				if rec := tusRequest(router, http.MethodHead, location, -1, nil, ownerAuth); rec.Code != http.StatusOK || rec.Header().Get("Upload-Offset") != "0" {
+					t.Errorf("HEAD del dueño = %d, Upload-Offset %q", rec.Code, rec.Header().Get("Upload-Offset"))
+				}
+			}
+		})
+	}
+}
+
+// El dueño lo pone el servidor: un owner en Upload-Metadata no da acceso a la subida de otro
+func TestTusHandlerOwnerMetadata(t *testing.T) {
+	usuarios := fakes.NewUsuarios()
+	defer usuarios.Close()
+	owner := primitive.NewObjectID()
+	ownerAuth := map[string]string{"Authorization": "Bearer " + usuarios.IssueToken(owner)}
+
+	saveFiles := fakes.NewSaveFiles()
+	defer saveFiles.Close()
+	var completed TusUpload
+	router := newTusTestRouter(t, TusConfig{
+		URLSaveFiles: saveFiles.URL + "/SaveFiles",
+		OnComplete: func(c *gin.Context, upload TusUpload) error {
+			completed = upload
+			return nil
+		},
+	})
+
+	forged := "filename " + base64.StdEncoding.EncodeToString([]byte("notas.txt")) + ",owner " + base64.StdEncoding.EncodeToString([]byte(owner.Hex()))
+	rec := tusRequest(router, http.MethodPost, "/uploads", -1, nil, map[string]string{"Upload-Length": "4", "Upload-Metadata": forged})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body)
+	}
+	if rec := tusRequest(router, http.MethodHead, rec.Header().Get("Location"), -1, nil, ownerAuth); rec.Code != http.StatusNotFound {
+		t.Errorf("HEAD con owner falsificado = %d, se esperaba 404", rec.Code)
+	}
+
+	rec = tusRequest(router, http.MethodPost, "/uploads", -1, nil, map[string]string{
+		"Authorization":   ownerAuth["Authorization"],
+		"Upload-Length":   "4",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("notas.txt")),
+	})
+	if rec := tusRequest(router, http.MethodPatch, rec.Header().Get("Location"), 0, []byte("hola"), ownerAuth); rec.Code != http.StatusNoContent {
+		t.Fatalf("PATCH = %d %s", rec.Code, rec.Body)
+	}
+	if completed.Metadata[tusOwnerMetadata] != owner.Hex() {
+		t.Errorf("OnComplete recibió owner %q, se esperaba %s", completed.Metadata[tusOwnerMetadata], owner.Hex())
+	}
+}
+
+// TusClient registra sus llamadas con el servicio tus, no con el servicio de archivos
+func TestTusClientServiceLabel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	client := &TusClient{Endpoint: server.URL + "/uploads"}
+	_, err := client.Upload(context.Background(), "datos.txt", strings.NewReader("hola"), 4, nil)
+	var upstreamErr *UpstreamError
+	if !errors.As(err, &upstreamErr) || upstreamErr.Service != serviceTus {
+		t.Fatalf("Upload = %v, se esperaba un *UpstreamError del servicio %s", err, serviceTus)
+	}
+}
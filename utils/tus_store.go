@@ -0,0 +1,282 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrOffsetMismatch indica que un fragmento no empieza donde terminó el anterior
+var ErrOffsetMismatch = errors.New("upload offset mismatch")
+
+// TusUpload es el estado de una subida reanudable
+type TusUpload struct {
+	ID     string `json:"id"`
+	Length int64  `json:"length"`
+	// Offset es cuántos bytes se recibieron
+	Offset int64 `json:"offset"`
+	// Metadata es el Upload-Metadata de la creación; "filename" es obligatorio y "owner" es el ID del
+	// usuario que la creó, que pone TusHandler
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	// FilePath y SHA256 se completan cuando el archivo terminó de subirse al servicio de archivos
+	FilePath string `json:"file_path,omitempty"`
+	SHA256   string `json:"sha256,omitempty"`
+	// Done indica que OnComplete terminó sin error; solo entonces la subida se informa como terminada
+	Done bool `json:"done,omitempty"`
+}
+
+// ChunkStore guarda los fragmentos de las subidas reanudables hasta que se completan
+type ChunkStore interface {
+	// Create registra una subida nueva sin contenido
+	Create(ctx context.Context, upload TusUpload) error
+	// Get retorna el estado de la subida, o un error con ErrNotFound si no existe
+	Get(ctx context.Context, id string) (TusUpload, error)
+	// WriteChunk agrega el contenido de r a partir de offset y retorna cuántos bytes guardó.
+	// Si offset no es el Offset actual retorna ErrOffsetMismatch. Los bytes guardados cuentan
+	// aunque r falle a mitad de camino, así el cliente reanuda desde ahí.
+	WriteChunk(ctx context.Context, id string, offset int64, r io.Reader) (int64, error)
+	// Open abre el contenido recibido para leerlo completo
+	Open(ctx context.Context, id string) (io.ReadCloser, error)
+	// Complete guarda el resultado de subir el archivo al servicio de archivos. El contenido ya
+	// no se necesita y se puede liberar; el estado se conserva para responder HEAD.
+	Complete(ctx context.Context, id string, result UploadResult) error
+	// MarkDone marca la subida como terminada, después de que OnComplete se ejecutó sin error
+	MarkDone(ctx context.Context, id string) error
+	// Delete elimina la subida y su contenido
+	Delete(ctx context.Context, id string) error
+}
+
+// LocalChunkStore guarda cada subida en Dir como <id>.bin con el contenido y <id>.info con el estado.
+// Sirve para servicios de una sola instancia; con varias réplicas, cada subida debe llegar siempre a la misma.
+type LocalChunkStore struct {
+	Dir string
+
+	mu sync.Mutex
+}
+
+// NewLocalChunkStore crea el directorio si no existe
+func NewLocalChunkStore(dir string) (*LocalChunkStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &LocalChunkStore{Dir: dir}, nil
+}
+
+// paths retorna las rutas del contenido y del estado. El ID viene de la URL, así que solo se
+// aceptan UUID para que no pueda salir de Dir.
+func (s *LocalChunkStore) paths(id string) (string, string, error) {
+	if parsed, err := uuid.Parse(id); err != nil || parsed.String() != id {
+		return "", "", fmt.Errorf("subida %q: %w", id, ErrNotFound)
+	}
+	base := filepath.Join(s.Dir, id)
+	return base + ".bin", base + ".info", nil
+}
+
+func (s *LocalChunkStore) Create(_ context.Context, upload TusUpload) error {
+	binPath, _, err := s.paths(upload.ID)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(binPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return s.saveInfo(upload)
+}
+
+func (s *LocalChunkStore) Get(_ context.Context, id string) (TusUpload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadInfo(id)
+}
+
+func (s *LocalChunkStore) WriteChunk(_ context.Context, id string, offset int64, r io.Reader) (int64, error) {
+	binPath, _, err := s.paths(id)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	upload, err := s.loadInfo(id)
+	s.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	if offset != upload.Offset {
+		return 0, fmt.Errorf("se esperaba el offset %d y se recibió %d: %w", upload.Offset, offset, ErrOffsetMismatch)
+	}
+
+	f, err := os.OpenFile(binPath, os.O_WRONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	// Si el proceso murió después de escribir y antes de guardar el estado, el archivo puede tener
+	// bytes de más; se descartan para que coincida con el Offset guardado
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return 0, err
+	}
+
+	// El contenido se escribe sin el lock: la copia puede tardar lo que tarde la red del cliente
+	n, copyErr := io.Copy(f, io.LimitReader(r, upload.Length-offset))
+	if err := f.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	upload.Offset = offset + n
+	if err := s.saveInfo(upload); err != nil {
+		return 0, err
+	}
+	return n, copyErr
+}
+
+func (s *LocalChunkStore) Open(_ context.Context, id string) (io.ReadCloser, error) {
+	binPath, _, err := s.paths(id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(binPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("subida %s: %w", id, ErrNotFound)
+	}
+	return f, err
+}
+
+func (s *LocalChunkStore) Complete(_ context.Context, id string, result UploadResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	upload, err := s.loadInfo(id)
+	if err != nil {
+		return err
+	}
+	upload.FilePath = result.Path
+	upload.SHA256 = result.SHA256
+	if err := s.saveInfo(upload); err != nil {
+		return err
+	}
+
+	binPath, _, _ := s.paths(id)
+	if err := os.Remove(binPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalChunkStore) MarkDone(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	upload, err := s.loadInfo(id)
+	if err != nil {
+		return err
+	}
+	upload.Done = true
+	return s.saveInfo(upload)
+}
+
+func (s *LocalChunkStore) Delete(_ context.Context, id string) error {
+	binPath, infoPath, err := s.paths(id)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(infoPath); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("subida %s: %w", id, ErrNotFound)
+	} else if err != nil {
+		return err
+	}
+	if err := os.Remove(binPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Cleanup elimina las subidas creadas hace más de maxAge, terminadas o abandonadas,
+// y retorna cuántas eliminó. Se llama periódicamente para no llenar el disco.
+func (s *LocalChunkStore) Cleanup(ctx context.Context, maxAge time.Duration) (int, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".info")
+		if !ok {
+			continue
+		}
+		upload, err := s.Get(ctx, id)
+		if err != nil || upload.CreatedAt.After(cutoff) {
+			continue
+		}
+		if err := s.Delete(ctx, id); err != nil && !errors.Is(err, ErrNotFound) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// loadInfo lee el estado de la subida; se llama con s.mu tomado
+func (s *LocalChunkStore) loadInfo(id string) (TusUpload, error) {
+	_, infoPath, err := s.paths(id)
+	if err != nil {
+		return TusUpload{}, err
+	}
+	data, err := os.ReadFile(infoPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return TusUpload{}, fmt.Errorf("subida %s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return TusUpload{}, err
+	}
+
+	var upload TusUpload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return TusUpload{}, err
+	}
+	return upload, nil
+}
+
+// saveInfo escribe el estado en un archivo temporal y lo renombra, así nunca queda a medio escribir.
+// Se llama con s.mu tomado.
+func (s *LocalChunkStore) saveInfo(upload TusUpload) error {
+	_, infoPath, err := s.paths(upload.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	tmpPath := infoPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, infoPath)
+}
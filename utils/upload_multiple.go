@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Errores de SaveMultipleFiles con WithAllOrNothing
+var (
+	// ErrRolledBack indica que el archivo no quedó guardado porque otro archivo del lote falló:
+	// no se llegó a subir o se subió y se eliminó
+	ErrRolledBack = errors.New("upload rolled back")
+	// ErrRollbackFailed indica que el archivo se subió y no se pudo eliminar al revertir el lote.
+	// Si quedó en la cola de eliminación se reintenta; si no, el archivo quedó huérfano.
+	ErrRollbackFailed = errors.New("upload rollback failed")
+)
+
+// FileUploadResult es el resultado de un archivo dentro de SaveMultipleFiles
+type FileUploadResult struct {
+	Field        string
+	Filename     string
+	Path         string
+	SHA256       string
+	Deduplicated bool
+	Err          error
+}
+
+// SaveMultipleFiles sube todos los archivos de los campos del formulario indicados.
+// Primero valida todos los archivos y luego los sube en paralelo, con el límite de WithConcurrency.
+// Los resultados se retornan en el orden de los campos y, dentro de cada campo, en el orden del formulario.
+// Con WithPolicy se aplican los límites de tamaño, tipo y cantidad de archivos.
+// Con WithAllOrNothing, si algún archivo falla no se sube ninguno o se eliminan los ya subidos.
+// El error es nil solo si todos los archivos se guardaron.
+func SaveMultipleFiles(urlsavefiles string, c *gin.Context, fieldNames []string, opts ...UploadOption) ([]FileUploadResult, error) {
+	cfg := newUploadConfig(c, opts)
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		Logger(c).Error("Error al obtener el formulario multipart", "error", err)
+		return nil, err
+	}
+
+	var files []*multipart.FileHeader
+	var results []FileUploadResult
+	for _, field := range fieldNames {
+		for _, file := range form.File[field] {
+			files = append(files, file)
+			results = append(results, FileUploadResult{Field: field, Filename: file.Filename})
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no se encontraron archivos en los campos %v: %w", fieldNames, http.ErrMissingFile)
+	}
+	if cfg.policy != nil {
+		if err := cfg.policy.CheckCount(len(files)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Paso 1: validar todos los archivos antes de subir cualquiera
+	kinds := make([]string, len(files))
+	contentTypes := make([]string, len(files))
+	validationFailed := false
+	for i, file := range files {
+		kind, contentType, err := prepareFileUpload(file, isImageEndpoint(urlsavefiles), cfg)
+		if err != nil {
+			results[i].Err = err
+			validationFailed = true
+			continue
+		}
+		kinds[i] = kind
+		contentTypes[i] = contentType
+	}
+	if validationFailed && cfg.allOrNothing {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].Err = ErrRolledBack
+			}
+		}
+		return results, joinUploadErrors(results)
+	}
+
+	// Paso 2: subir en paralelo los archivos válidos
+	semaphore := make(chan struct{}, cfg.concurrency)
+	var wg sync.WaitGroup
+	for i, file := range files {
+		if results[i].Err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, file *multipart.FileHeader) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			result, err := uploadFile(urlsavefiles, file, kinds[i], contentTypes[i], cfg, c)
+			if err != nil {
+				results[i].Err = err
+				return
+			}
+			results[i].Path = result.Path
+			results[i].SHA256 = result.SHA256
+			results[i].Deduplicated = result.Deduplicated
+		}(i, file)
+	}
+	wg.Wait()
+
+	uploadErr := joinUploadErrors(results)
+	if uploadErr == nil {
+		return results, nil
+	}
+	Logger(c).Error("No se pudieron guardar todos los archivos", "error", uploadErr)
+
+	// Paso 3: en modo todo o nada, eliminar los archivos que sí se subieron. Los que no se
+	// pudieron eliminar se agregan al error con ErrRollbackFailed.
+	if cfg.allOrNothing {
+		rollbackUploads(results, cfg.urlDeleteFile, cfg, c)
+		uploadErr = joinUploadErrors(results)
+	}
+	return results, uploadErr
+}
+
+// rollbackUploads elimina con urlDeleteFile los archivos subidos con éxito y los marca con ErrRolledBack.
+// Los que no se pueden eliminar quedan en la cola de eliminación y se marcan con ErrRollbackFailed.
+// Los deduplicados no se eliminan: ya existían antes del lote y otros registros los pueden usar.
+func rollbackUploads(results []FileUploadResult, urlDeleteFile string, cfg *uploadConfig, c *gin.Context) {
+	for i := range results {
+		if results[i].Err != nil || results[i].Path == "" {
+			continue
+		}
+		if results[i].Deduplicated {
+			results[i].Err = ErrRolledBack
+			results[i].Path = ""
+			continue
+		}
+		if urlDeleteFile == "" {
+			Logger(c).Error("No hay URL para eliminar un archivo del lote fallido", "file_path", results[i].Path)
+			results[i].Err = fmt.Errorf("%w: %s quedó huérfano porque no se indicó la URL de eliminación (WithAllOrNothing)", ErrRollbackFailed, results[i].Path)
+			continue
+		}
+		deleted, err := deleteOrEnqueue(results[i].Path, urlDeleteFile, "rollback_batch", cfg, c)
+		switch {
+		case deleted:
+			results[i].Err = ErrRolledBack
+			results[i].Path = ""
+		case err != nil:
+			results[i].Err = fmt.Errorf("%w: %s quedó huérfano: %w", ErrRollbackFailed, results[i].Path, err)
+		default:
+			results[i].Err = fmt.Errorf("%w: %s quedó en la cola de eliminación", ErrRollbackFailed, results[i].Path)
+		}
+	}
+}
+
+// joinUploadErrors agrupa los errores de los archivos que fallaron, o nil si todos se guardaron
+func joinUploadErrors(results []FileUploadResult) error {
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil && !errors.Is(result.Err, ErrRolledBack) {
+			errs = append(errs, fmt.Errorf("%s (%s): %w", result.Filename, result.Field, result.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/edwinrubio/DueligUtils/testhelpers/fakes"
+	"github.com/gin-gonic/gin"
+)
+
+// formFile es un archivo del formulario que arma newMultiFormContext
+type formFile struct {
+	field    string
+	filename string
+	data     string
+}
+
+// newMultiFormContext crea un contexto de gin con un formulario multipart con los archivos en orden
+func newMultiFormContext(t *testing.T, headers map[string]string, files ...formFile) *gin.Context {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, file := range files {
+		part, err := writer.CreateFormFile(file.field, file.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(file.data))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/upload", &body)
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	for name, value := range headers {
+		c.Request.Header.Set(name, value)
+	}
+	return c
+}
+
+const (
+	testPDF  = "%PDF-1.7\n1 0 obj<<>>endobj\n%%EOF\n"
+	testText = "fila,valor\n1,2\n"
+)
+
+func TestSaveMultipleFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []formFile
+		opts  func(saveFiles *fakes.SaveFiles) []UploadOption
+		// setup prepara fallas en el servicio de archivos
+		setup func(saveFiles *fakes.SaveFiles)
+		// wantFilenames es el orden esperado de los resultados
+		wantFilenames []string
+		wantErr       error
+		// wantStored es la cantidad de archivos que quedan en el servicio
+		wantStored int
+	}{
+		{
+			name: "orden por campo y por formulario",
+			files: []formFile{
+				{"documentos", "b.pdf", testPDF}, {"fotos", "a.txt", testText}, {"documentos", "c.txt", testText},
+			},
+			wantFilenames: []string{"a.txt", "b.pdf", "c.txt"},
+			wantStored:    3,
+		},
+		{
+			name:          "un archivo rechazado no impide los demás",
+			files:         []formFile{{"fotos", "a.txt", testText}, {"documentos", "falso.png", testText}},
+			wantFilenames: []string{"a.txt", "falso.png"},
+			wantErr:       ErrContentMismatch,
+			wantStored:    1,
+		},
+		{
+			name:  "todo o nada con un archivo rechazado no sube ninguno",
+			files: []formFile{{"fotos", "a.txt", testText}, {"documentos", "falso.png", testText}},
+			opts: func(saveFiles *fakes.SaveFiles) []UploadOption {
+				return []UploadOption{WithAllOrNothing(saveFiles.URL + "/DeleteFile")}
+			},
+			wantFilenames: []string{"a.txt", "falso.png"},
+			wantErr:       ErrContentMismatch,
+		},
+		{
+			name:  "todo o nada con una subida fallida elimina las demás",
+			files: []formFile{{"fotos", "a.txt", testText}, {"documentos", "b.pdf", testPDF}, {"documentos", "c.txt", testText}},
+			opts: func(saveFiles *fakes.SaveFiles) []UploadOption {
+				return []UploadOption{WithAllOrNothing(saveFiles.URL + "/DeleteFile"), WithConcurrency(1)}
+			},
+			setup:         func(saveFiles *fakes.SaveFiles) { saveFiles.FailNext(1, http.StatusServiceUnavailable) },
+			wantFilenames: []string{"a.txt", "b.pdf", "c.txt"},
+			wantErr:       ErrUpstreamUnavailable,
+		},
+		{
+			name:  "demasiados archivos",
+			files: []formFile{{"fotos", "a.txt", testText}, {"fotos", "b.txt", testText}},
+			opts: func(*fakes.SaveFiles) []UploadOption {
+				return []UploadOption{WithPolicy(UploadPolicy{MaxFiles: 1})}
+			},
+			wantErr: ErrTooManyFiles,
+		},
+		{
+			name:    "sin archivos en los campos",
+			files:   []formFile{{"otro", "a.txt", testText}},
+			wantErr: http.ErrMissingFile,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saveFiles := fakes.NewSaveFiles()
+			defer saveFiles.Close()
+			var opts []UploadOption
+			if tt.opts != nil {
+				opts = tt.opts(saveFiles)
+			}
+			if tt.setup != nil {
+				tt.setup(saveFiles)
+			}
+
+			c := newMultiFormContext(t, nil, tt.files...)
+			results, err := SaveMultipleFiles(saveFiles.URL+"/SaveFiles", c, []string{"fotos", "documentos"}, opts...)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("SaveMultipleFiles: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SaveMultipleFiles = %v, se esperaba %v", err, tt.wantErr)
+			}
+
+			if len(results) != len(tt.wantFilenames) {
+				t.Fatalf("se obtuvieron %d resultados, se esperaban %d", len(results), len(tt.wantFilenames))
+			}
+			for i, result := range results {
+				if result.Filename != tt.wantFilenames[i] {
+					t.Errorf("resultado %d es %q, se esperaba %q", i, result.Filename, tt.wantFilenames[i])
+				}
+				if result.Err == nil && !saveFiles.HasFile(result.Path) {
+					t.Errorf("%s: la ruta %q no está en el servicio", result.Filename, result.Path)
+				}
+				if result.Err != nil && result.Path != "" {
+					t.Errorf("%s falló y conserva la ruta %q", result.Filename, result.Path)
+				}
+			}
+			if got := len(saveFiles.Files()); got != tt.wantStored {
+				t.Errorf("el servicio tiene %d archivos, se esperaban %d", got, tt.wantStored)
+			}
+		})
+	}
+}
+
+// Si no se puede eliminar un archivo del lote fallido, queda en la cola con ErrRollbackFailed
+func TestSaveMultipleFilesRollbackFailed(t *testing.T) {
+	saveFiles := fakes.NewSaveFiles()
+	defer saveFiles.Close()
+	queue := startedDeletionQueue(t)
+
+	c := newMultiFormContext(t, map[string]string{"Authorization": "Bearer usuario", "X-Request-ID": "req-1"},
+		formFile{"fotos", "a.txt", testText}, formFile{"fotos", "b.txt", testText})
+	saveFiles.FailNext(1, http.StatusServiceUnavailable)
+	saveFiles.On(http.MethodDelete, "/DeleteFile", fakes.Response{Status: http.StatusInternalServerError})
+
+	results, err := SaveMultipleFiles(saveFiles.URL+"/SaveFiles", c, []string{"fotos"},
+		WithAllOrNothing(saveFiles.URL+"/DeleteFile"), WithConcurrency(1), WithDeletionQueue(queue))
+	if !errors.Is(err, ErrRollbackFailed) || !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Fatalf("SaveMultipleFiles = %v, se esperaba ErrRollbackFailed y ErrUpstreamUnavailable", err)
+	}
+
+	var orphan string
+	for _, result := range results {
+		if errors.Is(result.Err, ErrRollbackFailed) {
+			orphan = result.Path
+		}
+	}
+	pending := queue.Pending()
+	if orphan == "" || len(pending) != 1 || pending[0].FilePath != orphan || pending[0].Reason != "rollback_batch" {
+		t.Fatalf("se esperaba %q en la cola, hay %+v", orphan, pending)
+	}
+	if _, leaked := pending[0].Headers["Authorization"]; leaked || pending[0].Headers["X-Request-ID"] != "req-1" {
+		t.Errorf("cabeceras del job inesperadas: %v", pending[0].Headers)
+	}
+}
+
+// Los nombres con comillas o saltos de línea no pueden cerrar la cabecera ni agregar partes
+func TestWriteMultipartFormEscapesNames(t *testing.T) {
+	const filename = "a\".txt\r\nContent-Disposition: form-data; name=\"Kindfile\"\r\n\r\nImages"
+
+	body := newMultipartBody(filename, "text/plain", -1, io.NopCloser(strings.NewReader(testText)),
+		[]formField{{name: "Kindfile", value: KindDocuments}}, "")
+	raw, file, fields := readMultipartBody(t, body)
+
+	if string(file) != testText || fields["Kindfile"] != KindDocuments || len(fields) != 2 {
+		t.Fatalf("el nombre alteró el formulario: campos %v", fields)
+	}
+	if !bytes.Contains(raw, []byte(`filename="a%22.txt%0D%0AContent-Disposition: form-data; name=%22Kindfile%22%0D%0A%0D%0AImages"`)) {
+		t.Errorf("el nombre no se escapó según RFC 7578:\n%s", raw)
+	}
+}
@@ -0,0 +1,143 @@
+package utils
+
+import "github.com/gin-gonic/gin"
+
+// DefaultUploadConcurrency es la cantidad de archivos que SaveMultipleFiles sube en paralelo por defecto
+const DefaultUploadConcurrency = 4
+
+// UploadOption configura las funciones de subida de archivos
+type UploadOption func(*uploadConfig)
+
+// uploadConfig reúne las opciones de una subida
+type uploadConfig struct {
+	concurrency    int
+	allOrNothing   bool
+	urlDeleteFile  string
+	policy         *UploadPolicy
+	imageVariants  []ImageVariant
+	imageQuality   int
+	stripMetadata  bool
+	scanner        Scanner
+	scanFailure    ScanFailurePolicy
+	generateNames  bool
+	dedupe         DedupeStore
+	dedupeScope    string
+	deletionQueue  DeletionQueue
+	fetcher        *SafeFetcher
+	fetchUploadURL string
+	c              *gin.Context
+}
+
+// newUploadConfig arma la configuración de una subida. Si UploadPolicyMiddleware dejó una
+// política en el contexto se usa por defecto; WithPolicy la reemplaza.
+func newUploadConfig(c *gin.Context, opts []UploadOption) *uploadConfig {
+	cfg := &uploadConfig{concurrency: DefaultUploadConcurrency, policy: policyFromContext(c), deletionQueue: DefaultDeletionQueue, c: c}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithConcurrency limita cuántos archivos se suben en paralelo
+func WithConcurrency(n int) UploadOption {
+	return func(cfg *uploadConfig) {
+		if n > 0 {
+			cfg.concurrency = n
+		}
+	}
+}
+
+// WithAllOrNothing hace que, si algún archivo falla, se eliminen los que ya se subieron
+// usando urlDeleteFile, igual que en DeleteFile
+func WithAllOrNothing(urlDeleteFile string) UploadOption {
+	return func(cfg *uploadConfig) {
+		cfg.allOrNothing = true
+		cfg.urlDeleteFile = urlDeleteFile
+	}
+}
+
+// WithPolicy aplica una UploadPolicy a los archivos de la subida
+func WithPolicy(policy UploadPolicy) UploadOption {
+	return func(cfg *uploadConfig) {
+		cfg.policy = &policy
+	}
+}
+
+// WithImageVariants reemplaza las variantes que genera SaveImageVariants
+func WithImageVariants(variants ...ImageVariant) UploadOption {
+	return func(cfg *uploadConfig) {
+		cfg.imageVariants = variants
+	}
+}
+
+// WithImageQuality define la calidad JPEG (1 a 100) de las variantes que no indican la suya
+func WithImageQuality(quality int) UploadOption {
+	return func(cfg *uploadConfig) {
+		if quality > 0 {
+			cfg.imageQuality = min(quality, 100)
+		}
+	}
+}
+
+// WithStripImageMetadata hace que los JPEG que se suben como imagen pierdan EXIF, XMP y GPS
+// y queden con la orientación aplicada a los píxeles, conservando el perfil ICC
+func WithStripImageMetadata() UploadOption {
+	return func(cfg *uploadConfig) {
+		cfg.stripMetadata = true
+	}
+}
+
+// WithScanner analiza cada archivo con el Scanner antes de subirlo. Los archivos infectados se rechazan
+// con *InfectedFileError; onFailure decide qué pasa si el Scanner no responde.
+func WithScanner(scanner Scanner, onFailure ScanFailurePolicy) UploadOption {
+	return func(cfg *uploadConfig) {
+		cfg.scanner = scanner
+		cfg.scanFailure = onFailure
+	}
+}
+
+// WithGeneratedFilenames envía los archivos con un nombre aleatorio que conserva la extensión,
+// en lugar del nombre limpio que eligió el cliente
+func WithGeneratedFilenames() UploadOption {
+	return func(cfg *uploadConfig) {
+		cfg.generateNames = true
+	}
+}
+
+// WithDedupe evita subir de nuevo un contenido que ya se guardó: si el SHA-256 ya está en el store
+// para el mismo scope, endpoint y Kindfile, se retorna la ruta existente sin enviar los bytes.
+// scope es obligatorio e identifica al dueño del archivo, por ejemplo "usuario:<id>:foto". Dentro
+// de un scope la ruta se comparte, y BeginFileUpdate y UpdateFile eliminan la ruta anterior sin
+// saber si otro registro la usa; por eso un scope nunca debe abarcar archivos de distintos dueños.
+// Con scope vacío la subida falla. Quien elimine archivos fuera de UpdateFile debe llamar a
+// store.Forget con la ruta.
+func WithDedupe(store DedupeStore, scope string) UploadOption {
+	return func(cfg *uploadConfig) {
+		cfg.dedupe = store
+		cfg.dedupeScope = scope
+	}
+}
+
+// WithDeletionQueue indica la cola donde BeginFileUpdate y UpdateFile dejan las eliminaciones que fallaron.
+// Por defecto se usa DefaultDeletionQueue.
+func WithDeletionQueue(q DeletionQueue) UploadOption {
+	return func(cfg *uploadConfig) {
+		if q != nil {
+			cfg.deletionQueue = q
+		}
+	}
+}
+
+// WithLocalFetch hace que SaveImageFromUrl descargue la imagen en este servicio con fetcher
+// (NewAvatarFetcher si es nil) y la suba a uploadURL como cualquier imagen, en vez de enviarle la URL
+// al servicio de archivos. uploadURL es el endpoint completo de imágenes y define si quedan públicas
+// o privadas, así que en este modo el parámetro acl no se usa.
+func WithLocalFetch(fetcher *SafeFetcher, uploadURL string) UploadOption {
+	return func(cfg *uploadConfig) {
+		if fetcher == nil {
+			fetcher = NewAvatarFetcher()
+		}
+		cfg.fetcher = fetcher
+		cfg.fetchUploadURL = uploadURL
+	}
+}
@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadPolicyContextKey guarda en el contexto de Gin la política de UploadPolicyMiddleware
+const uploadPolicyContextKey = "duelig.upload_policy"
+
+// multipartOverheadBytes es el margen para cabeceras y campos de texto del formulario
+const multipartOverheadBytes = 1 << 20
+
+// UploadPolicy define qué archivos acepta un endpoint. Los campos vacíos o en cero no se validan.
+type UploadPolicy struct {
+	// MaxBytes es el tamaño máximo por archivo
+	MaxBytes int64
+	// MaxFiles es la cantidad máxima de archivos por solicitud
+	MaxFiles int
+	// AllowedKinds son los Kindfile permitidos, por ejemplo "Images" o "Documents"
+	AllowedKinds []string
+	// AllowedMIMETypes son los Content-Type detectados permitidos, por ejemplo "image/png"
+	AllowedMIMETypes []string
+	// AllowedExtensions son las extensiones permitidas, con o sin punto
+	AllowedExtensions []string
+}
+
+// PolicyError describe un archivo que no cumple la UploadPolicy.
+// Envuelve ErrFileTooLarge, ErrUnsupportedFileType o ErrTooManyFiles.
+type PolicyError struct {
+	Filename string
+	Reason   string
+	Err      error
+}
+
+func (e *PolicyError) Error() string {
+	if e.Filename == "" {
+		return fmt.Sprintf("%s: %v", e.Reason, e.Err)
+	}
+	return fmt.Sprintf("%s: %s: %v", e.Filename, e.Reason, e.Err)
+}
+
+func (e *PolicyError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode retorna el status HTTP con el que se debe responder (413, 415 o 400)
+func (e *PolicyError) StatusCode() int {
+	return HTTPStatusFromError(e.Err)
+}
+
+// Check valida un archivo contra la política. kind es el Kindfile y contentType el tipo detectado.
+func (p UploadPolicy) Check(file *multipart.FileHeader, kind string, contentType string) error {
+	if p.MaxBytes > 0 && file.Size > p.MaxBytes {
+		return &PolicyError{
+			Filename: file.Filename,
+			Reason:   fmt.Sprintf("el archivo pesa %d bytes y el máximo es %d", file.Size, p.MaxBytes),
+			Err:      ErrFileTooLarge,
+		}
+	}
+
+	if len(p.AllowedKinds) > 0 && !containsFold(p.AllowedKinds, kind) {
+		return &PolicyError{
+			Filename: file.Filename,
+			Reason:   fmt.Sprintf("tipo de archivo %q no permitido", kind),
+			Err:      ErrUnsupportedFileType,
+		}
+	}
+
+	if len(p.AllowedMIMETypes) > 0 {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			mediaType = contentType
+		}
+		if !containsFold(p.AllowedMIMETypes, mediaType) {
+			return &PolicyError{
+				Filename: file.Filename,
+				Reason:   fmt.Sprintf("Content-Type %q no permitido", mediaType),
+				Err:      ErrUnsupportedFileType,
+			}
+		}
+	}
+
+	if len(p.AllowedExtensions) > 0 {
+		ext := strings.ToLower(filepath.Ext(file.Filename))
+		allowed := false
+		for _, candidate := range p.AllowedExtensions {
+			if strings.EqualFold(ext, "."+strings.TrimPrefix(candidate, ".")) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return &PolicyError{
+				Filename: file.Filename,
+				Reason:   fmt.Sprintf("extensión %q no permitida", ext),
+				Err:      ErrUnsupportedFileType,
+			}
+		}
+	}
+
+	return nil
+}
+
+// CheckCount valida la cantidad de archivos de una solicitud
+func (p UploadPolicy) CheckCount(n int) error {
+	if p.MaxFiles > 0 && n > p.MaxFiles {
+		return &PolicyError{
+			Reason: fmt.Sprintf("se recibieron %d archivos y el máximo es %d", n, p.MaxFiles),
+			Err:    ErrTooManyFiles,
+		}
+	}
+	return nil
+}
+
+// maxRequestBytes es el tamaño máximo del cuerpo de la solicitud según la política, o 0 si no hay límite
+func (p UploadPolicy) maxRequestBytes() int64 {
+	if p.MaxBytes <= 0 {
+		return 0
+	}
+	files := int64(max(p.MaxFiles, 1))
+	return p.MaxBytes*files + multipartOverheadBytes
+}
+
+// UploadPolicyMiddleware rechaza con 413 las solicitudes cuyo Content-Length supera la política
+// antes de leer el cuerpo, y limita la lectura de las que no lo declaran.
+// La política queda en el contexto y SaveFiles, SaveFilesAsImage, SaveMultipleFiles y UpdateFile
+// la aplican a cada archivo aunque no reciban WithPolicy.
+func UploadPolicyMiddleware(policy UploadPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limit := policy.maxRequestBytes(); limit > 0 {
+			if c.Request.ContentLength > limit {
+				Logger(c).Warn("Solicitud rechazada por tamaño", "content_length", c.Request.ContentLength, "limit", limit)
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+					"error": fmt.Sprintf("request body too large: max %d bytes", limit),
+				})
+				return
+			}
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
+
+		c.Set(uploadPolicyContextKey, policy)
+		c.Next()
+	}
+}
+
+// policyFromContext obtiene la política que dejó UploadPolicyMiddleware, o nil
+func policyFromContext(c *gin.Context) *UploadPolicy {
+	if c == nil {
+		return nil
+	}
+	value, exists := c.Get(uploadPolicyContextKey)
+	if !exists {
+		return nil
+	}
+	policy, ok := value.(UploadPolicy)
+	if !ok {
+		return nil
+	}
+	return &policy
+}
+
+func containsFold(values []string, target string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, target) {
+			return true
+		}
+	}
+	return false
+}
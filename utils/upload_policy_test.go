@@ -0,0 +1,164 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/edwinrubio/DueligUtils/testhelpers/fakes"
+	"github.com/gin-gonic/gin"
+)
+
+func TestUploadPolicyCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      UploadPolicy
+		filename    string
+		size        int64
+		kind        string
+		contentType string
+		wantErr     error
+		wantStatus  int
+	}{
+		{name: "sin restricciones", filename: "a.exe", size: 1 << 30, kind: KindDocuments, contentType: "application/octet-stream"},
+		{name: "en el límite", policy: UploadPolicy{MaxBytes: 100}, filename: "a.png", size: 100, kind: KindImages, contentType: "image/png"},
+		{
+			name: "demasiado grande", policy: UploadPolicy{MaxBytes: 100}, filename: "a.png", size: 101, kind: KindImages, contentType: "image/png",
+			wantErr: ErrFileTooLarge, wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "Kindfile no permitido", policy: UploadPolicy{AllowedKinds: []string{KindImages}}, filename: "a.pdf", kind: KindDocuments, contentType: "application/pdf",
+			wantErr: ErrUnsupportedFileType, wantStatus: http.StatusUnsupportedMediaType,
+		},
+		{name: "Kindfile sin distinguir mayúsculas", policy: UploadPolicy{AllowedKinds: []string{"images"}}, filename: "a.png", kind: KindImages, contentType: "image/png"},
+		{name: "MIME con parámetros", policy: UploadPolicy{AllowedMIMETypes: []string{"text/plain"}}, filename: "a.txt", kind: KindDocuments, contentType: "text/plain; charset=utf-8"},
+		{
+			name: "MIME no permitido", policy: UploadPolicy{AllowedMIMETypes: []string{"image/png", "image/jpeg"}}, filename: "a.gif", kind: KindImages, contentType: "image/gif",
+			wantErr: ErrUnsupportedFileType, wantStatus: http.StatusUnsupportedMediaType,
+		},
+		{name: "extensión sin punto", policy: UploadPolicy{AllowedExtensions: []string{"pdf"}}, filename: "Reporte.PDF", kind: KindDocuments, contentType: "application/pdf"},
+		{name: "extensión con punto", policy: UploadPolicy{AllowedExtensions: []string{".jpg", ".png"}}, filename: "a.png", kind: KindImages, contentType: "image/png"},
+		{
+			name: "extensión no permitida", policy: UploadPolicy{AllowedExtensions: []string{"jpg"}}, filename: "a.jpeg", kind: KindImages, contentType: "image/jpeg",
+			wantErr: ErrUnsupportedFileType, wantStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name: "sin extensión", policy: UploadPolicy{AllowedExtensions: []string{"txt"}}, filename: "notas", kind: KindDocuments, contentType: "text/plain",
+			wantErr: ErrUnsupportedFileType, wantStatus: http.StatusUnsupportedMediaType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := &multipart.FileHeader{Filename: tt.filename, Size: tt.size}
+			err := tt.policy.Check(file, tt.kind, tt.contentType)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Check = %v, se esperaba nil", err)
+				}
+				return
+			}
+
+			var policyErr *PolicyError
+			if !errors.As(err, &policyErr) || !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Check = %v, se esperaba un *PolicyError con %v", err, tt.wantErr)
+			}
+			if policyErr.Filename != tt.filename || !strings.Contains(err.Error(), tt.filename) {
+				t.Errorf("el error no identifica el archivo: %v", err)
+			}
+			if policyErr.StatusCode() != tt.wantStatus || HTTPStatusFromError(err) != tt.wantStatus {
+				t.Errorf("StatusCode = %d, se esperaba %d", policyErr.StatusCode(), tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestUploadPolicyCheckCount(t *testing.T) {
+	tests := []struct {
+		policy  UploadPolicy
+		n       int
+		wantErr bool
+	}{
+		{UploadPolicy{}, 100, false},
+		{UploadPolicy{MaxFiles: 3}, 3, false},
+		{UploadPolicy{MaxFiles: 3}, 4, true},
+	}
+	for _, tt := range tests {
+		err := tt.policy.CheckCount(tt.n)
+		if tt.wantErr != errors.Is(err, ErrTooManyFiles) {
+			t.Errorf("CheckCount(%d) con MaxFiles %d = %v", tt.n, tt.policy.MaxFiles, err)
+		}
+		if tt.wantErr && HTTPStatusFromError(err) != http.StatusBadRequest {
+			t.Errorf("demasiados archivos debe responder 400, responde %d", HTTPStatusFromError(err))
+		}
+	}
+}
+
+func TestUploadPolicyMiddleware(t *testing.T) {
+	policy := UploadPolicy{MaxBytes: 64, AllowedKinds: []string{KindDocuments}}
+
+	tests := []struct {
+		name     string
+		filename string
+		data     string
+		// chunked envía el cuerpo sin Content-Length
+		chunked    bool
+		wantStatus int
+		// wantHandler indica que el handler llegó a ejecutarse
+		wantHandler bool
+	}{
+		{name: "permitido", filename: "a.txt", data: testText, wantStatus: http.StatusOK, wantHandler: true},
+		{name: "Content-Length mayor al límite", filename: "a.txt", data: strings.Repeat("x", 2<<20), wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "chunked mayor al límite", filename: "a.txt", data: strings.Repeat("x", 2<<20), chunked: true, wantStatus: http.StatusRequestEntityTooLarge, wantHandler: true},
+		{name: "archivo mayor a MaxBytes", filename: "a.txt", data: strings.Repeat("x", 65), wantStatus: http.StatusRequestEntityTooLarge, wantHandler: true},
+		{name: "tipo no permitido por la política del contexto", filename: "a.png", data: "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 16), wantStatus: http.StatusUnsupportedMediaType, wantHandler: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saveFiles := fakes.NewSaveFiles()
+			defer saveFiles.Close()
+
+			handlerCalled := false
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/upload", UploadPolicyMiddleware(policy), func(c *gin.Context) {
+				handlerCalled = true
+				if _, err := SaveFiles(saveFiles.URL+"/SaveFiles", c, "file"); err != nil {
+					c.AbortWithStatusJSON(HTTPStatusFromError(err), gin.H{"error": err.Error()})
+					return
+				}
+				c.Status(http.StatusOK)
+			})
+
+			var body bytes.Buffer
+			writer := multipart.NewWriter(&body)
+			part, _ := writer.CreateFormFile("file", tt.filename)
+			part.Write([]byte(tt.data))
+			writer.Close()
+
+			var reader io.Reader = &body
+			if tt.chunked {
+				// Sin Len(), httptest.NewRequest no puede calcular el Content-Length
+				reader = io.MultiReader(&body)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/upload", reader)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d %s, se esperaba %d", rec.Code, rec.Body, tt.wantStatus)
+			}
+			if handlerCalled != tt.wantHandler {
+				t.Errorf("handler ejecutado = %v, se esperaba %v", handlerCalled, tt.wantHandler)
+			}
+			if wantStored := tt.wantStatus == http.StatusOK; wantStored != (len(saveFiles.Files()) == 1) {
+				t.Errorf("el servicio de archivos tiene %d archivos", len(saveFiles.Files()))
+			}
+		})
+	}
+}